@@ -2,7 +2,9 @@ package cadence_client
 
 import (
 	"context"
+	"crypto/ed25519"
 	"fmt"
+	"github.com/cadence-workflow/starlark-worker/cadence"
 	"github.com/cadence-workflow/starlark-worker/ext"
 	"github.com/cadence-workflow/starlark-worker/service"
 	"github.com/cadence-workflow/starlark-worker/star"
@@ -10,6 +12,7 @@ import (
 	cadenceshared "go.uber.org/cadence/.gen/go/shared"
 	cadenceclient "go.uber.org/cadence/client"
 	"go.uber.org/cadence/workflow"
+	"go.uber.org/zap"
 	"io"
 	"log"
 	"os"
@@ -20,6 +23,13 @@ import (
 
 var WorkflowFunc any = (*service.Service)(nil).Run
 
+// FollowInterval is the polling interval of the log entries query (see service.LogEntriesQueryName) used by Follow.
+var FollowInterval = time.Second
+
+// DataConverter renders the payloads printed by Run and History. Encrypted payloads are decrypted with
+// encoded.DefaultKeys, unless the converter has its own keys.
+var DataConverter = &cadence.DataConverter{Logger: zap.NewNop()}
+
 func Run(
 	tar []byte,
 	file string,
@@ -29,11 +39,15 @@ func Run(
 	env *starlark.Dict,
 	cadenceClient cadenceclient.Client,
 	cadenceTaskList string,
+	follow bool,
 ) error {
 	opt := cadenceclient.StartWorkflowOptions{
 		TaskList:                     cadenceTaskList,
 		ExecutionStartToCloseTimeout: time.Hour * 24 * 365 * 10,
 	}
+	if timeout := service.ExecutionTimeout(tar, file, function); timeout > 0 {
+		opt.ExecutionStartToCloseTimeout = timeout // declared by the entrypoint in meta.json
+	}
 
 	ctx := context.Background()
 	var exec *workflow.Execution
@@ -55,6 +69,12 @@ func Run(
 	log.Printf("%-15s :: %s", "Execution.ID", exec.ID)
 	log.Printf("%-15s :: %s", "Execution.RunID", exec.RunID)
 
+	if follow {
+		if err := Follow(ctx, cadenceClient, exec.ID, exec.RunID, service.LogsQuery{}); err != nil {
+			return err
+		}
+	}
+
 	iter := cadenceClient.GetWorkflowHistory(ctx, exec.ID, exec.RunID, true, cadenceshared.HistoryEventFilterTypeCloseEvent)
 	for iter.HasNext() {
 		event, err := iter.Next()
@@ -62,24 +82,163 @@ func Run(
 			return err
 		}
 		if event.WorkflowExecutionCompletedEventAttributes != nil {
-			result := string(event.WorkflowExecutionCompletedEventAttributes.GetResult())
+			result := DataConverter.ToString(event.WorkflowExecutionCompletedEventAttributes.GetResult())
 			log.Printf("%-15s ::", "Result")
 			log.Println(result)
 		}
 		if event.WorkflowExecutionFailedEventAttributes != nil {
 			log.Printf("%-15s :: %s", "Fail.Reason", event.WorkflowExecutionFailedEventAttributes.GetReason())
 			log.Printf("%-15s ::", "Fail.Details")
-			log.Println(string(event.WorkflowExecutionFailedEventAttributes.GetDetails()))
+			log.Println(DataConverter.ToString(event.WorkflowExecutionFailedEventAttributes.GetDetails()))
 		}
 	}
 	return nil
 }
 
-func Package(root, path string, out io.Writer) error {
+// Follow tails the log entries query of the given execution and prints new entries until the execution is closed.
+// Entries are polled every FollowInterval, starting from query.Offset; other query filters are applied as-is.
+func Follow(
+	ctx context.Context,
+	cadenceClient cadenceclient.Client,
+	workflowID string,
+	runID string,
+	query service.LogsQuery,
+) error {
+	ticker := time.NewTicker(FollowInterval)
+	defer ticker.Stop()
+	for {
+		// Check the status before the query, so the last query after the close sees all the logs.
+		desc, err := cadenceClient.DescribeWorkflowExecution(ctx, workflowID, runID)
+		if err != nil {
+			return err
+		}
+		closed := desc.GetWorkflowExecutionInfo().CloseStatus != nil
+
+		v, err := cadenceClient.QueryWorkflow(ctx, workflowID, runID, service.LogEntriesQueryName, query)
+		if err != nil {
+			return err
+		}
+		var entries []service.LogEntry
+		if err := v.Get(&entries); err != nil {
+			return err
+		}
+		for _, e := range entries {
+			log.Println(e.String())
+			query.Offset = e.Seq + 1
+		}
+
+		if query.Limit > 0 && len(entries) == query.Limit {
+			continue // a full page: more entries are likely available
+		}
+		if closed {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// History prints the history events of the given execution along with their decoded payloads: activity and
+// child workflow inputs, results and failure details, signals, markers and the execution result. The workflow
+// input is not printed: it holds the package.
+func History(ctx context.Context, cadenceClient cadenceclient.Client, workflowID string, runID string) error {
+	iter := cadenceClient.GetWorkflowHistory(ctx, workflowID, runID, false, cadenceshared.HistoryEventFilterTypeAllEvent)
+	for iter.HasNext() {
+		event, err := iter.Next()
+		if err != nil {
+			return err
+		}
+		log.Printf("%5d  %s  %s", event.GetEventId(), time.Unix(0, event.GetTimestamp()).Format(time.RFC3339Nano), event.GetEventType())
+		for _, p := range eventPayloads(event) {
+			if p.text != "" {
+				log.Printf("%-15s :: %s", p.name, p.text)
+			} else if len(p.data) > 0 {
+				log.Printf("%-15s ::", p.name)
+				log.Println(DataConverter.ToString(p.data))
+			}
+		}
+	}
+	return nil
+}
+
+// eventPayload is a named event attribute: plain text, or a payload to decode.
+type eventPayload struct {
+	name string
+	text string
+	data []byte
+}
+
+func eventPayloads(e *cadenceshared.HistoryEvent) []eventPayload {
+	switch {
+	case e.ActivityTaskScheduledEventAttributes != nil:
+		a := e.ActivityTaskScheduledEventAttributes
+		return []eventPayload{{name: "Activity", text: a.GetActivityType().GetName()}, {name: "Input", data: a.GetInput()}}
+	case e.ActivityTaskCompletedEventAttributes != nil:
+		return []eventPayload{{name: "Result", data: e.ActivityTaskCompletedEventAttributes.GetResult()}}
+	case e.ActivityTaskFailedEventAttributes != nil:
+		a := e.ActivityTaskFailedEventAttributes
+		return []eventPayload{{name: "Fail.Reason", text: a.GetReason()}, {name: "Fail.Details", data: a.GetDetails()}}
+	case e.ActivityTaskTimedOutEventAttributes != nil:
+		return []eventPayload{{name: "Details", data: e.ActivityTaskTimedOutEventAttributes.GetDetails()}}
+	case e.ActivityTaskCanceledEventAttributes != nil:
+		return []eventPayload{{name: "Details", data: e.ActivityTaskCanceledEventAttributes.GetDetails()}}
+	case e.StartChildWorkflowExecutionInitiatedEventAttributes != nil:
+		return []eventPayload{{name: "Input", data: e.StartChildWorkflowExecutionInitiatedEventAttributes.GetInput()}}
+	case e.ChildWorkflowExecutionCompletedEventAttributes != nil:
+		return []eventPayload{{name: "Result", data: e.ChildWorkflowExecutionCompletedEventAttributes.GetResult()}}
+	case e.ChildWorkflowExecutionFailedEventAttributes != nil:
+		a := e.ChildWorkflowExecutionFailedEventAttributes
+		return []eventPayload{{name: "Fail.Reason", text: a.GetReason()}, {name: "Fail.Details", data: a.GetDetails()}}
+	case e.WorkflowExecutionSignaledEventAttributes != nil:
+		a := e.WorkflowExecutionSignaledEventAttributes
+		return []eventPayload{{name: "Signal", text: a.GetSignalName()}, {name: "Input", data: a.GetInput()}}
+	case e.MarkerRecordedEventAttributes != nil:
+		a := e.MarkerRecordedEventAttributes
+		return []eventPayload{{name: "Marker", text: a.GetMarkerName()}, {name: "Details", data: a.GetDetails()}}
+	case e.WorkflowExecutionCompletedEventAttributes != nil:
+		return []eventPayload{{name: "Result", data: e.WorkflowExecutionCompletedEventAttributes.GetResult()}}
+	case e.WorkflowExecutionFailedEventAttributes != nil:
+		a := e.WorkflowExecutionFailedEventAttributes
+		return []eventPayload{{name: "Fail.Reason", text: a.GetReason()}, {name: "Fail.Details", data: a.GetDetails()}}
+	case e.WorkflowExecutionTerminatedEventAttributes != nil:
+		return []eventPayload{{name: "Details", data: e.WorkflowExecutionTerminatedEventAttributes.GetDetails()}}
+	default:
+		return nil
+	}
+}
+
+// Package builds the package (tar) of the given main file, see PackageFiles. The package is signed with
+// the given key, if any (see star.Sign).
+func Package(root, path string, key ed25519.PrivateKey, out io.Writer) error {
+	files, err := PackageFiles(root, path)
+	if err != nil {
+		return err
+	}
+	if key != nil {
+		if files[star.SignaturePath[1:]], err = star.Sign(files, key); err != nil {
+			return err
+		}
+		log.Printf("[+] %s (key_id: %s)", star.SignaturePath[1:], star.KeyID(key.Public().(ed25519.PublicKey)))
+	}
+	return ext.WriteTar(files, out)
+}
+
+// PackageFiles returns the package files by path relative to the root: the main file and the files it loads,
+// meta.json, and the files included by the package manifest (see star.Manifest). Loading an excluded file
+// is an error.
+func PackageFiles(root, path string) (map[string][]byte, error) {
 
 	var err error
 	if root, err = filepath.Abs(root); err != nil {
-		return err
+		return nil, err
+	}
+
+	manifest, err := star.ReadManifest(root)
+	if err != nil {
+		return nil, err
 	}
 
 	files := map[string][]byte{}
@@ -91,6 +250,10 @@ func Package(root, path string, out io.Writer) error {
 			return err
 		}
 
+		if manifest.Excluded(filepath.ToSlash(rel)) {
+			return fmt.Errorf("excluded file is loaded: %s", rel)
+		}
+
 		log.Printf("[+] %s", rel)
 
 		if content, err := os.ReadFile(p); err != nil {
@@ -101,13 +264,37 @@ func Package(root, path string, out io.Writer) error {
 		return nil
 	}
 
-	if err = load(root, path, map[string]bool{}, onLoad); err != nil {
-		return err
+	cache := map[string]bool{}
+	if err = load(root, path, manifest.Repositories, cache, onLoad); err != nil {
+		return nil, err
 	}
-	return ext.WriteTar(files, out)
+
+	included, err := manifest.Files(&star.LocalFS{Root: root})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(root, star.MetaFile)); err == nil && !manifest.Excluded(star.MetaFile) {
+		included = append(included, "/"+star.MetaFile)
+		// the files of the declared entrypoints, along with the files they load
+		meta, err := service.ReadMeta(&star.LocalFS{Root: root})
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range meta.EntrypointNames() {
+			if p, _, _ := meta.Entrypoint("", name); p != "" {
+				included = append(included, "/"+strings.TrimPrefix(filepath.ToSlash(p), "/"))
+			}
+		}
+	}
+	for _, p := range included {
+		if err = load(root, filepath.Join(root, filepath.FromSlash(p)), manifest.Repositories, cache, onLoad); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
 }
 
-func load(root string, path string, cache map[string]bool, callback func(string) error) error {
+func load(root string, path string, repos map[string]string, cache map[string]bool, callback func(string) error) error {
 
 	if strings.HasPrefix(path, star.PluginPrefix) { // skip modules
 		return nil
@@ -127,7 +314,11 @@ func load(root string, path string, cache map[string]bool, callback func(string)
 		return err
 	}
 
-	if !strings.HasPrefix(path, root) { // file must be within the root
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) { // file must be within the root
 		return fmt.Errorf("out-of-root: root: %s, path: %s", root, path)
 	}
 
@@ -135,7 +326,7 @@ func load(root string, path string, cache map[string]bool, callback func(string)
 		return nil
 	}
 
-	if !strings.HasSuffix(path, ".star") {
+	if !strings.HasSuffix(path, ".star") { // data files (.txt, .json, .yaml, .toml, .csv, raw bytes) are packaged as is
 		cache[path] = true
 		if err := callback(path); err != nil {
 			return err
@@ -151,9 +342,24 @@ func load(root string, path string, cache map[string]bool, callback func(string)
 		if err := callback(path); err != nil {
 			return err
 		}
+		from := "/" + filepath.ToSlash(rel)
 		for i := 0; i < p.NumLoads(); i++ {
 			l, _ := p.Load(i)
-			if err := load(root, l, cache, callback); err != nil {
+			if star.IsPlugin(l) {
+				continue
+			}
+			if alias, _, ok := star.SplitRepo(l); ok { // resolved on the worker
+				if _, pinned := repos[alias]; !pinned {
+					return fmt.Errorf("repository is not pinned in %s: %s: %s", star.MetaFile, alias, l)
+				}
+				continue
+			}
+			// resolve the same way the worker does: relative to the loading file or to the package root
+			resolved, err := star.ResolveLoad(from, l)
+			if err != nil {
+				return err
+			}
+			if err := load(root, filepath.Join(root, filepath.FromSlash(resolved)), repos, cache, callback); err != nil {
 				return err
 			}
 		}
@@ -0,0 +1,120 @@
+package cadence_client
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/cadence-workflow/starlark-worker/service"
+	"go.starlark.net/starlark"
+	cadenceclient "go.uber.org/cadence/client"
+	"go.uber.org/cadence/workflow"
+	"io"
+	"log"
+	"strings"
+	"time"
+)
+
+var REPLWorkflowFunc any = (*service.Service)(nil).REPL
+
+// REPLPollInterval is the polling interval of the REPL output query.
+var REPLPollInterval = time.Millisecond * 100
+
+// REPL starts a REPL workflow and runs an interactive session: reads code chunks from in, sends them to the
+// workflow and prints the outcome to out. The session ends on exit() or at the end of the input. Chunks are sent
+// to the latest run of the workflow, as the session continues as new (see service.REPLState).
+func REPL(
+	tar []byte,
+	env *starlark.Dict,
+	cadenceClient cadenceclient.Client,
+	cadenceTaskList string,
+	in io.Reader,
+	out io.Writer,
+) error {
+	opt := cadenceclient.StartWorkflowOptions{
+		TaskList:                     cadenceTaskList,
+		ExecutionStartToCloseTimeout: time.Hour * 24 * 365 * 10,
+	}
+
+	ctx := context.Background()
+	var exec *workflow.Execution
+	var err error
+	if exec, err = cadenceClient.StartWorkflow(ctx, opt, REPLWorkflowFunc, tar, env, nil); err != nil {
+		return err
+	}
+
+	log.Printf("%-15s :: %s", "Execution.ID", exec.ID)
+	log.Printf("%-15s :: %s", "Execution.RunID", exec.RunID)
+
+	scanner := bufio.NewScanner(in)
+	for seq := int64(0); ; seq++ {
+		chunk, ok := readChunk(scanner, out)
+		if !ok {
+			chunk = "exit()"
+		}
+		if err := cadenceClient.SignalWorkflow(ctx, exec.ID, "", service.REPLSignalName, chunk); err != nil {
+			return err
+		}
+		var res service.REPLOutput
+		for {
+			v, err := cadenceClient.QueryWorkflow(ctx, exec.ID, "", service.REPLQueryName, seq)
+			if err != nil {
+				return err
+			}
+			var outputs []service.REPLOutput
+			if err := v.Get(&outputs); err != nil {
+				return err
+			}
+			if len(outputs) > 0 {
+				res = outputs[0]
+				break
+			}
+			time.Sleep(REPLPollInterval)
+		}
+		printREPLOutput(out, res)
+		if !ok || res.Exited {
+			return nil
+		}
+	}
+}
+
+func printREPLOutput(out io.Writer, res service.REPLOutput) {
+	_, _ = fmt.Fprint(out, res.Output)
+	if res.Result != "" {
+		_, _ = fmt.Fprintln(out, res.Result)
+	}
+	if res.Error != "" {
+		_, _ = fmt.Fprintln(out, res.Error)
+	}
+}
+
+// readChunk reads the next code chunk: a single line, or a block that starts with a line ending with ':' and
+// continues until an empty line. Returns false at the end of the input.
+func readChunk(scanner *bufio.Scanner, out io.Writer) (string, bool) {
+	var lines []string
+	for {
+		if len(lines) == 0 {
+			_, _ = fmt.Fprint(out, ">>> ")
+		} else {
+			_, _ = fmt.Fprint(out, "... ")
+		}
+		if !scanner.Scan() {
+			_, _ = fmt.Fprintln(out)
+			if len(lines) == 0 {
+				return "", false
+			}
+			return strings.Join(lines, "\n") + "\n", true
+		}
+		line := scanner.Text()
+		if len(lines) == 0 {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			if !strings.HasSuffix(strings.TrimSpace(line), ":") {
+				return line, true
+			}
+		} else if strings.TrimSpace(line) == "" {
+			return strings.Join(lines, "\n") + "\n", true
+		}
+		lines = append(lines, line)
+	}
+}
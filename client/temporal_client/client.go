@@ -2,23 +2,36 @@ package cadence_client
 
 import (
 	"context"
+	"crypto/ed25519"
 	"fmt"
 	"github.com/cadence-workflow/starlark-worker/ext"
 	"github.com/cadence-workflow/starlark-worker/service"
 	"github.com/cadence-workflow/starlark-worker/star"
+	"github.com/cadence-workflow/starlark-worker/temporal"
 	"go.starlark.net/starlark"
+	commonpb "go.temporal.io/api/common/v1"
 	enumspb "go.temporal.io/api/enums/v1"
+	failurepb "go.temporal.io/api/failure/v1"
+	historypb "go.temporal.io/api/history/v1"
 	tempclient "go.temporal.io/sdk/client"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 )
 
 var WorkflowFunc any = (*service.Service)(nil).Run
 
+// FollowInterval is the polling interval of the log entries query (see service.LogEntriesQueryName) used by Follow.
+var FollowInterval = time.Second
+
+// DataConverter renders the payloads printed by Run and History. Encrypted payloads are decrypted with
+// encoded.DefaultKeys, unless the converter has its own keys.
+var DataConverter = temporal.DataConverter{}
+
 func Run(
 	tar []byte,
 	file string,
@@ -28,11 +41,15 @@ func Run(
 	env *starlark.Dict,
 	temporalClient tempclient.Client,
 	taskQueue string,
+	follow bool,
 ) error {
 	opt := tempclient.StartWorkflowOptions{
 		TaskQueue:                taskQueue,
 		WorkflowExecutionTimeout: time.Hour * 24 * 365 * 10,
 	}
+	if timeout := service.ExecutionTimeout(tar, file, function); timeout > 0 {
+		opt.WorkflowExecutionTimeout = timeout // declared by the entrypoint in meta.json
+	}
 
 	ctx := context.Background()
 	workflowRun, err := temporalClient.ExecuteWorkflow(
@@ -53,6 +70,12 @@ func Run(
 	log.Printf("%-15s :: %s", "Execution.ID", workflowRun.GetID())
 	log.Printf("%-15s :: %s", "Execution.RunID", workflowRun.GetRunID())
 
+	if follow {
+		if err := Follow(ctx, temporalClient, workflowRun.GetID(), workflowRun.GetRunID(), service.LogsQuery{}); err != nil {
+			return err
+		}
+	}
+
 	iter := temporalClient.GetWorkflowHistory(ctx, workflowRun.GetID(), workflowRun.GetRunID(), true,
 		enumspb.HISTORY_EVENT_FILTER_TYPE_CLOSE_EVENT)
 	for iter.HasNext() {
@@ -63,21 +86,189 @@ func Run(
 		if event.GetWorkflowExecutionCompletedEventAttributes() != nil {
 			result := event.GetWorkflowExecutionCompletedEventAttributes().GetResult()
 			log.Printf("%-15s ::", "Result")
-			log.Println(result.String())
+			log.Println(strings.Join(DataConverter.ToStrings(result), "\n"))
 		}
 		if event.GetWorkflowExecutionFailedEventAttributes() != nil {
+			failure := event.GetWorkflowExecutionFailedEventAttributes().GetFailure()
 			log.Printf("%-15s :: %s", "Retry.State", event.GetWorkflowExecutionFailedEventAttributes().GetRetryState().String())
-			log.Printf("%-15s :: %s", "Fail.Reason", event.GetWorkflowExecutionFailedEventAttributes().GetFailure())
+			log.Printf("%-15s :: %s", "Fail.Reason", failure.GetMessage())
+			if details := failureDetails(failure); details != nil {
+				log.Printf("%-15s ::", "Fail.Details")
+				log.Println(strings.Join(DataConverter.ToStrings(details), "\n"))
+			}
 		}
 	}
 	return nil
 }
 
-func Package(root, path string, out io.Writer) error {
+// Follow tails the log entries query of the given execution and prints new entries until the execution is closed.
+// Entries are polled every FollowInterval, starting from query.Offset; other query filters are applied as-is.
+func Follow(
+	ctx context.Context,
+	temporalClient tempclient.Client,
+	workflowID string,
+	runID string,
+	query service.LogsQuery,
+) error {
+	ticker := time.NewTicker(FollowInterval)
+	defer ticker.Stop()
+	for {
+		// Check the status before the query, so the last query after the close sees all the logs.
+		desc, err := temporalClient.DescribeWorkflowExecution(ctx, workflowID, runID)
+		if err != nil {
+			return err
+		}
+		closed := desc.GetWorkflowExecutionInfo().GetStatus() != enumspb.WORKFLOW_EXECUTION_STATUS_RUNNING
+
+		v, err := temporalClient.QueryWorkflow(ctx, workflowID, runID, service.LogEntriesQueryName, query)
+		if err != nil {
+			return err
+		}
+		var entries []service.LogEntry
+		if err := v.Get(&entries); err != nil {
+			return err
+		}
+		for _, e := range entries {
+			log.Println(e.String())
+			query.Offset = e.Seq + 1
+		}
+
+		if query.Limit > 0 && len(entries) == query.Limit {
+			continue // a full page: more entries are likely available
+		}
+		if closed {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// History prints the history events of the given execution along with their decoded payloads: activity and
+// child workflow inputs, results and failure details, signals, markers and the execution result. The workflow
+// input is not printed: it holds the package.
+func History(ctx context.Context, temporalClient tempclient.Client, workflowID string, runID string) error {
+	iter := temporalClient.GetWorkflowHistory(ctx, workflowID, runID, false, enumspb.HISTORY_EVENT_FILTER_TYPE_ALL_EVENT)
+	for iter.HasNext() {
+		event, err := iter.Next()
+		if err != nil {
+			return err
+		}
+		log.Printf("%5d  %s  %s", event.GetEventId(), event.GetEventTime().AsTime().Format(time.RFC3339Nano), event.GetEventType())
+		for _, p := range eventPayloads(event) {
+			if p.text != "" {
+				log.Printf("%-15s :: %s", p.name, p.text)
+			} else if len(p.data.GetPayloads()) > 0 {
+				log.Printf("%-15s ::", p.name)
+				log.Println(strings.Join(DataConverter.ToStrings(p.data), "\n"))
+			}
+		}
+	}
+	return nil
+}
+
+// eventPayload is a named event attribute: plain text, or payloads to decode.
+type eventPayload struct {
+	name string
+	text string
+	data *commonpb.Payloads
+}
+
+func eventPayloads(e *historypb.HistoryEvent) []eventPayload {
+	switch {
+	case e.GetActivityTaskScheduledEventAttributes() != nil:
+		a := e.GetActivityTaskScheduledEventAttributes()
+		return []eventPayload{{name: "Activity", text: a.GetActivityType().GetName()}, {name: "Input", data: a.GetInput()}}
+	case e.GetActivityTaskCompletedEventAttributes() != nil:
+		return []eventPayload{{name: "Result", data: e.GetActivityTaskCompletedEventAttributes().GetResult()}}
+	case e.GetActivityTaskFailedEventAttributes() != nil:
+		return failurePayloads(e.GetActivityTaskFailedEventAttributes().GetFailure())
+	case e.GetActivityTaskTimedOutEventAttributes() != nil:
+		return failurePayloads(e.GetActivityTaskTimedOutEventAttributes().GetFailure())
+	case e.GetActivityTaskCanceledEventAttributes() != nil:
+		return []eventPayload{{name: "Details", data: e.GetActivityTaskCanceledEventAttributes().GetDetails()}}
+	case e.GetStartChildWorkflowExecutionInitiatedEventAttributes() != nil:
+		return []eventPayload{{name: "Input", data: e.GetStartChildWorkflowExecutionInitiatedEventAttributes().GetInput()}}
+	case e.GetChildWorkflowExecutionCompletedEventAttributes() != nil:
+		return []eventPayload{{name: "Result", data: e.GetChildWorkflowExecutionCompletedEventAttributes().GetResult()}}
+	case e.GetChildWorkflowExecutionFailedEventAttributes() != nil:
+		return failurePayloads(e.GetChildWorkflowExecutionFailedEventAttributes().GetFailure())
+	case e.GetWorkflowExecutionSignaledEventAttributes() != nil:
+		a := e.GetWorkflowExecutionSignaledEventAttributes()
+		return []eventPayload{{name: "Signal", text: a.GetSignalName()}, {name: "Input", data: a.GetInput()}}
+	case e.GetMarkerRecordedEventAttributes() != nil:
+		a := e.GetMarkerRecordedEventAttributes()
+		res := []eventPayload{{name: "Marker", text: a.GetMarkerName()}}
+		keys := make([]string, 0, len(a.GetDetails()))
+		for k := range a.GetDetails() {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			res = append(res, eventPayload{name: "Details." + k, data: a.GetDetails()[k]})
+		}
+		return res
+	case e.GetWorkflowExecutionCompletedEventAttributes() != nil:
+		return []eventPayload{{name: "Result", data: e.GetWorkflowExecutionCompletedEventAttributes().GetResult()}}
+	case e.GetWorkflowExecutionFailedEventAttributes() != nil:
+		return failurePayloads(e.GetWorkflowExecutionFailedEventAttributes().GetFailure())
+	case e.GetWorkflowExecutionTerminatedEventAttributes() != nil:
+		return []eventPayload{{name: "Details", data: e.GetWorkflowExecutionTerminatedEventAttributes().GetDetails()}}
+	default:
+		return nil
+	}
+}
+
+func failurePayloads(f *failurepb.Failure) []eventPayload {
+	return []eventPayload{{name: "Fail.Reason", text: f.GetMessage()}, {name: "Fail.Details", data: failureDetails(f)}}
+}
+
+// failureDetails returns the details of an application, canceled or timeout failure.
+func failureDetails(f *failurepb.Failure) *commonpb.Payloads {
+	switch {
+	case f.GetApplicationFailureInfo() != nil:
+		return f.GetApplicationFailureInfo().GetDetails()
+	case f.GetCanceledFailureInfo() != nil:
+		return f.GetCanceledFailureInfo().GetDetails()
+	case f.GetTimeoutFailureInfo() != nil:
+		return f.GetTimeoutFailureInfo().GetLastHeartbeatDetails()
+	default:
+		return nil
+	}
+}
+
+// Package builds the package (tar) of the given main file, see PackageFiles. The package is signed with
+// the given key, if any (see star.Sign).
+func Package(root, path string, key ed25519.PrivateKey, out io.Writer) error {
+	files, err := PackageFiles(root, path)
+	if err != nil {
+		return err
+	}
+	if key != nil {
+		if files[star.SignaturePath[1:]], err = star.Sign(files, key); err != nil {
+			return err
+		}
+		log.Printf("[+] %s (key_id: %s)", star.SignaturePath[1:], star.KeyID(key.Public().(ed25519.PublicKey)))
+	}
+	return ext.WriteTar(files, out)
+}
+
+// PackageFiles returns the package files by path relative to the root: the main file and the files it loads,
+// meta.json, and the files included by the package manifest (see star.Manifest). Loading an excluded file
+// is an error.
+func PackageFiles(root, path string) (map[string][]byte, error) {
 
 	var err error
 	if root, err = filepath.Abs(root); err != nil {
-		return err
+		return nil, err
+	}
+
+	manifest, err := star.ReadManifest(root)
+	if err != nil {
+		return nil, err
 	}
 
 	files := map[string][]byte{}
@@ -89,6 +280,10 @@ func Package(root, path string, out io.Writer) error {
 			return err
 		}
 
+		if manifest.Excluded(filepath.ToSlash(rel)) {
+			return fmt.Errorf("excluded file is loaded: %s", rel)
+		}
+
 		log.Printf("[+] %s", rel)
 
 		if content, err := os.ReadFile(p); err != nil {
@@ -99,13 +294,37 @@ func Package(root, path string, out io.Writer) error {
 		return nil
 	}
 
-	if err = load(root, path, map[string]bool{}, onLoad); err != nil {
-		return err
+	cache := map[string]bool{}
+	if err = load(root, path, manifest.Repositories, cache, onLoad); err != nil {
+		return nil, err
 	}
-	return ext.WriteTar(files, out)
+
+	included, err := manifest.Files(&star.LocalFS{Root: root})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(root, star.MetaFile)); err == nil && !manifest.Excluded(star.MetaFile) {
+		included = append(included, "/"+star.MetaFile)
+		// the files of the declared entrypoints, along with the files they load
+		meta, err := service.ReadMeta(&star.LocalFS{Root: root})
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range meta.EntrypointNames() {
+			if p, _, _ := meta.Entrypoint("", name); p != "" {
+				included = append(included, "/"+strings.TrimPrefix(filepath.ToSlash(p), "/"))
+			}
+		}
+	}
+	for _, p := range included {
+		if err = load(root, filepath.Join(root, filepath.FromSlash(p)), manifest.Repositories, cache, onLoad); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
 }
 
-func load(root string, path string, cache map[string]bool, callback func(string) error) error {
+func load(root string, path string, repos map[string]string, cache map[string]bool, callback func(string) error) error {
 
 	if strings.HasPrefix(path, star.PluginPrefix) { // skip modules
 		return nil
@@ -125,7 +344,11 @@ func load(root string, path string, cache map[string]bool, callback func(string)
 		return err
 	}
 
-	if !strings.HasPrefix(path, root) { // file must be within the root
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) { // file must be within the root
 		return fmt.Errorf("out-of-root: root: %s, path: %s", root, path)
 	}
 
@@ -133,7 +356,7 @@ func load(root string, path string, cache map[string]bool, callback func(string)
 		return nil
 	}
 
-	if !strings.HasSuffix(path, ".star") {
+	if !strings.HasSuffix(path, ".star") { // data files (.txt, .json, .yaml, .toml, .csv, raw bytes) are packaged as is
 		cache[path] = true
 		if err := callback(path); err != nil {
 			return err
@@ -149,9 +372,24 @@ func load(root string, path string, cache map[string]bool, callback func(string)
 		if err := callback(path); err != nil {
 			return err
 		}
+		from := "/" + filepath.ToSlash(rel)
 		for i := 0; i < p.NumLoads(); i++ {
 			l, _ := p.Load(i)
-			if err := load(root, l, cache, callback); err != nil {
+			if star.IsPlugin(l) {
+				continue
+			}
+			if alias, _, ok := star.SplitRepo(l); ok { // resolved on the worker
+				if _, pinned := repos[alias]; !pinned {
+					return fmt.Errorf("repository is not pinned in %s: %s: %s", star.MetaFile, alias, l)
+				}
+				continue
+			}
+			// resolve the same way the worker does: relative to the loading file or to the package root
+			resolved, err := star.ResolveLoad(from, l)
+			if err != nil {
+				return err
+			}
+			if err := load(root, filepath.Join(root, filepath.FromSlash(resolved)), repos, cache, callback); err != nil {
 				return err
 			}
 		}
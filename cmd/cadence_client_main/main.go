@@ -2,10 +2,15 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/ed25519"
 	"flag"
 	"fmt"
 	"github.com/cadence-workflow/starlark-worker/cadence"
 	cadenceclient "github.com/cadence-workflow/starlark-worker/client/cadence_client"
+	"github.com/cadence-workflow/starlark-worker/encoded"
+	"github.com/cadence-workflow/starlark-worker/ext"
+	"github.com/cadence-workflow/starlark-worker/service"
 	"github.com/cadence-workflow/starlark-worker/star"
 	"github.com/uber-go/tally"
 	"go.starlark.net/starlark"
@@ -15,7 +20,9 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 )
 
 const help = `
@@ -25,8 +32,13 @@ Options:
   --help  Show this message and exit.
 
 Targets:
-  package    Create a starlark package file.
-  run        Run a starlark package.
+  package      Create a starlark package file.
+  run          Run a starlark package.
+  logs         Print (or follow) the logs of a workflow execution.
+  repl         Start an interactive starlark session (REPL workflow).
+  history      Print the history events of a workflow execution with their decoded payloads.
+  digest       Print the canonical package hash (sha256:...).
+  entrypoints  List the entrypoints declared in the package meta.json.
 
 `
 
@@ -46,8 +58,13 @@ func (r *StringSliceValue) Set(value string) error {
 }
 
 var targets = map[string]func(args []string){
-	"package": __package__,
-	"run":     __run__,
+	"package":     __package__,
+	"run":         __run__,
+	"logs":        __logs__,
+	"repl":        __repl__,
+	"digest":      __digest__,
+	"history":     __history__,
+	"entrypoints": __entrypoints__,
 }
 
 func main() {
@@ -76,10 +93,13 @@ func __package__(args []string) {
 
 	fs := flag.NewFlagSet("tar", flag.ExitOnError)
 
-	var rootDir, file string
+	var rootDir, file, signKey string
+	var list bool
 
 	fs.StringVar(&rootDir, "root-dir", ".", "Root directory to build a package (tar archive) from.")
 	fs.StringVar(&file, "file", "", "main file to create a package for")
+	fs.StringVar(&signKey, "sign-key", "", "PEM-encoded ed25519 private key file (e.g. generated by openssl genpkey -algorithm ed25519) to sign the package with. Workers verify the signature against their trusted public keys.")
+	fs.BoolVar(&list, "list", false, "Dry run: print the package files and the total size instead of the package. Besides the files loaded from --file, the package includes meta.json and the files matching the include globs of its \"package\" section, minus the excludes and the .starignore patterns.")
 
 	if err := fs.Parse(args); err != nil {
 		log.Fatal(err)
@@ -92,36 +112,102 @@ func __package__(args []string) {
 		log.Fatal("ERROR: --file required")
 	}
 
-	if err := cadenceclient.Package(rootDir, file, os.Stdout); err != nil {
+	if list {
+		files, err := cadenceclient.PackageFiles(rootDir, file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		printPackageFiles(files)
+		return
+	}
+
+	if err := cadenceclient.Package(rootDir, file, loadSignKey(signKey), os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func printPackageFiles(files map[string][]byte) {
+	paths := make([]string, 0, len(files))
+	var size int
+	for p, content := range files {
+		paths = append(paths, p)
+		size += len(content)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		fmt.Printf("%10d  %s\n", len(files[p]), p)
+	}
+	fmt.Printf("%10d  total (%d files)\n", size, len(files))
+}
+
+func __digest__(args []string) {
+
+	fs := flag.NewFlagSet("digest", flag.ExitOnError)
+
+	var _package, rootDir, file, signKey string
+
+	fs.StringVar(&_package, "package", "", "Package file to hash, or - (single hyphen) to read the package from stdin. If not set, the package is built from --root-dir and --file, the same way as the package target does.")
+	fs.StringVar(&rootDir, "root-dir", ".", "Root directory to build a package (tar archive) from.")
+	fs.StringVar(&file, "file", "", "main file to create a package for")
+	fs.StringVar(&signKey, "sign-key", "", "PEM-encoded ed25519 private key file to sign the package with. Signatures are deterministic, so signed packages are reproducible as well.")
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+
+	var _tar []byte
+	var err error
+	switch {
+	case _package == "-":
+		_tar, err = io.ReadAll(os.Stdin)
+	case _package != "":
+		_tar, err = os.ReadFile(_package)
+	case file == "":
+		log.Fatal("ERROR: --file or --package required")
+	default:
+		buf := bytes.Buffer{}
+		err = cadenceclient.Package(rootDir, file, loadSignKey(signKey), &buf)
+		_tar = buf.Bytes()
+	}
+	if err != nil {
 		log.Fatal(err)
 	}
+	fmt.Println(service.PackageRef(_tar))
 }
 
 func __run__(_args []string) {
 
 	fs := flag.NewFlagSet("run", flag.ExitOnError)
 
-	var _package, file, function, args, kwargs, cadenceEndpoint, domain, tasklist string
+	var _package, file, function, entrypoint, args, kwargs, cadenceEndpoint, domain, tasklist, packageStore, signKey, payloadKeys, blobStore string
 	var env StringSliceValue
+	var follow bool
 
 	fs.StringVar(&_package, "package", ".", "Package path. Package is a *.tar.gz file used to aggregate *.star files and associated resources into one file for distribution. There are 3 ways to specify the package: 1) file path (reads package directly from the file); 2) directory path (builds package from the directory); 3) - (single hyphen, reads package from stdin)")
 	fs.StringVar(&file, "file", "", "Entry point *.star file that defines a function to run (see --function). This file must exist in the package file (see --package-root, --package).")
 	fs.StringVar(&function, "function", "main", "Entry point function to run. The function must be defined in the entry point *.star file (see --file).")
+	fs.StringVar(&entrypoint, "entrypoint", "", "Name of the entrypoint declared in the package meta.json to run, instead of --file and --function (see the entrypoints target). The arguments are checked against the entrypoint parameters.")
 	fs.StringVar(&args, "args", "[]", "Function's positional arguments. Format: JSON array. Example: '[\"foo\", 100, true]'")
 	fs.StringVar(&kwargs, "kwargs", "[]", "Function's keyword arguments.Format: JSON array or arrays. Example: [[\"country_code\", \"US\"], [\"item_id\", 101]]")
 	fs.Var(&env, "env", "Environment variables to be set for the run")
 	fs.StringVar(&cadenceEndpoint, "cadence-url", "grpc://localhost:7833", "")
 	fs.StringVar(&domain, "domain", "default", "")
 	fs.StringVar(&tasklist, "tasklist", "default", "")
+	fs.BoolVar(&follow, "follow", false, "Tail the execution logs until the execution is closed.")
+	fs.StringVar(&packageStore, "package-store", "", "Directory of the content-addressed package store shared with the workers. If set, the package is uploaded to the store once and the run is started with the package reference (sha256:...) instead of the package content.")
+	fs.StringVar(&signKey, "sign-key", "", "PEM-encoded ed25519 private key file to sign the package with, if the package is built from a directory (see --package).")
+	fs.StringVar(&payloadKeys, "payload-keys", "", payloadKeysUsage)
+	fs.StringVar(&blobStore, "blob-store", "", blobStoreUsage)
 
 	if err := fs.Parse(_args); err != nil {
 		log.Fatal(err)
 	}
+	setPayloadOptions(payloadKeys, blobStore)
 
 	_help := fmt.Sprintf("Run `%s run --help` for help.", os.Args[0])
 
-	if file == "" {
-		log.Fatalf("ERROR: Required: --file. %s", _help)
+	if file == "" && entrypoint == "" {
+		log.Fatalf("ERROR: Required: --file or --entrypoint. %s", _help)
 	}
 
 	var _tar []byte
@@ -142,9 +228,14 @@ func __run__(_args []string) {
 		}
 		if fi.IsDir() {
 
+			if file == "" {
+				if file, err = service.EntrypointFile(_package, entrypoint); err != nil {
+					log.Fatal(err)
+				}
+			}
 			log.Printf("Create package: %s, file: %s", _package, file)
 			buf := bytes.Buffer{}
-			if err := cadenceclient.Package(_package, file, &buf); err != nil {
+			if err := cadenceclient.Package(_package, file, loadSignKey(signKey), &buf); err != nil {
 				log.Fatal(err)
 			}
 			_tar = buf.Bytes()
@@ -162,21 +253,12 @@ func __run__(_args []string) {
 	}
 	log.Printf("Package size: %d bytes", len(_tar))
 
-	log.Printf("Parse --env: %s", env)
-	var _env *starlark.Dict
-	if len(env) > 0 {
-		_env = &starlark.Dict{}
-		sep := "="
-		for _, kv := range env {
-			k, v, found := strings.Cut(kv, sep)
-			if !found {
-				log.Fatalf("ERROR: Bad env format: separator '%s' not found: %s", sep, kv)
-			}
-			if err := _env.SetKey(starlark.String(k), starlark.String(v)); err != nil {
-				log.Fatal(err)
-			}
-		}
+	if packageStore != "" {
+		_tar = uploadPackage(packageStore, _tar)
 	}
+
+	log.Printf("Parse --env: %s", env)
+	_env := parseEnv(env)
 	log.Printf("Env: %s", _env)
 
 	log.Printf("Parse --args: %s", args)
@@ -199,6 +281,253 @@ func __run__(_args []string) {
 
 	log.Printf("Cadence endpoint: %s, domain: %s, tasklist: %s", cadenceEndpoint, domain, tasklist)
 
+	cadenceCli := newCadenceClient(cadenceEndpoint, domain)
+
+	if entrypoint != "" {
+		file, function = "", entrypoint // resolved by the worker
+	}
+	log.Printf("Entrypoint function: %s", function)
+	if err := cadenceclient.Run(_tar, file, function, argsP, kwargsP, _env, cadenceCli, tasklist, follow); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func __entrypoints__(args []string) {
+
+	fs := flag.NewFlagSet("entrypoints", flag.ExitOnError)
+
+	var _package string
+
+	fs.StringVar(&_package, "package", ".", "Package file, directory with meta.json, or - (single hyphen) to read the package from stdin.")
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+
+	meta, err := service.LoadMeta(_package)
+	if err != nil {
+		log.Fatal(err)
+	}
+	service.PrintEntrypoints(os.Stdout, meta)
+}
+
+func __logs__(_args []string) {
+
+	fs := flag.NewFlagSet("logs", flag.ExitOnError)
+
+	var workflowID, runID, level, since, contains, cadenceEndpoint, domain, payloadKeys, blobStore string
+	var offset int64
+	var limit int
+	var follow bool
+
+	fs.StringVar(&workflowID, "workflow-id", "", "Workflow execution ID.")
+	fs.StringVar(&runID, "run-id", "", "Workflow execution run ID. Optional: the latest run is used if not set.")
+	fs.Int64Var(&offset, "offset", 0, "Sequence number of the first log entry to print.")
+	fs.IntVar(&limit, "limit", 0, "Max number of log entries to print (per poll with --follow). 0 means no limit.")
+	fs.StringVar(&level, "level", "", "Minimal log level: debug, info, warning or error.")
+	fs.StringVar(&since, "since", "", "Print entries logged at or after the given time. Format: RFC3339.")
+	fs.StringVar(&contains, "contains", "", "Print entries whose message contains the given substring.")
+	fs.BoolVar(&follow, "follow", false, "Keep polling for new log entries until the execution is closed.")
+	fs.StringVar(&cadenceEndpoint, "cadence-url", "grpc://localhost:7833", "")
+	fs.StringVar(&domain, "domain", "default", "")
+	fs.StringVar(&payloadKeys, "payload-keys", "", payloadKeysUsage)
+	fs.StringVar(&blobStore, "blob-store", "", blobStoreUsage)
+
+	if err := fs.Parse(_args); err != nil {
+		log.Fatal(err)
+	}
+	setPayloadOptions(payloadKeys, blobStore)
+
+	_help := fmt.Sprintf("Run `%s logs --help` for help.", os.Args[0])
+
+	if workflowID == "" {
+		log.Fatalf("ERROR: Required: --workflow-id. %s", _help)
+	}
+
+	query := service.LogsQuery{
+		Offset:   offset,
+		Limit:    limit,
+		Level:    level,
+		Contains: contains,
+	}
+	if since != "" {
+		var err error
+		if query.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			log.Fatalf("ERROR: Bad --since format: %s. %s", err, _help)
+		}
+	}
+
+	cadenceCli := newCadenceClient(cadenceEndpoint, domain)
+	ctx := context.Background()
+
+	if follow {
+		if err := cadenceclient.Follow(ctx, cadenceCli, workflowID, runID, query); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	v, err := cadenceCli.QueryWorkflow(ctx, workflowID, runID, service.LogEntriesQueryName, query)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var entries []service.LogEntry
+	if err := v.Get(&entries); err != nil {
+		log.Fatal(err)
+	}
+	for _, e := range entries {
+		log.Println(e.String())
+	}
+}
+
+func __history__(_args []string) {
+
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+
+	var workflowID, runID, cadenceEndpoint, domain, payloadKeys, blobStore string
+
+	fs.StringVar(&workflowID, "workflow-id", "", "Workflow execution ID.")
+	fs.StringVar(&runID, "run-id", "", "Workflow execution run ID. Optional: the latest run is used if not set.")
+	fs.StringVar(&cadenceEndpoint, "cadence-url", "grpc://localhost:7833", "")
+	fs.StringVar(&domain, "domain", "default", "")
+	fs.StringVar(&payloadKeys, "payload-keys", "", payloadKeysUsage)
+	fs.StringVar(&blobStore, "blob-store", "", blobStoreUsage)
+
+	if err := fs.Parse(_args); err != nil {
+		log.Fatal(err)
+	}
+	setPayloadOptions(payloadKeys, blobStore)
+
+	_help := fmt.Sprintf("Run `%s history --help` for help.", os.Args[0])
+
+	if workflowID == "" {
+		log.Fatalf("ERROR: Required: --workflow-id. %s", _help)
+	}
+
+	cadenceCli := newCadenceClient(cadenceEndpoint, domain)
+	if err := cadenceclient.History(context.Background(), cadenceCli, workflowID, runID); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func __repl__(_args []string) {
+
+	fs := flag.NewFlagSet("repl", flag.ExitOnError)
+
+	var _package, file, cadenceEndpoint, domain, tasklist, payloadKeys, blobStore string
+	var env StringSliceValue
+
+	fs.StringVar(&_package, "package", "", "Package path to load modules from. Optional. Either a *.tar.gz package file, or a directory to build the package from (see --file).")
+	fs.StringVar(&file, "file", "", "*.star file to build the package from, along with the files it loads. Required if --package is a directory.")
+	fs.Var(&env, "env", "Environment variables to be set for the session")
+	fs.StringVar(&cadenceEndpoint, "cadence-url", "grpc://localhost:7833", "")
+	fs.StringVar(&domain, "domain", "default", "")
+	fs.StringVar(&tasklist, "tasklist", "default", "")
+	fs.StringVar(&payloadKeys, "payload-keys", "", payloadKeysUsage)
+	fs.StringVar(&blobStore, "blob-store", "", blobStoreUsage)
+
+	if err := fs.Parse(_args); err != nil {
+		log.Fatal(err)
+	}
+	setPayloadOptions(payloadKeys, blobStore)
+
+	_help := fmt.Sprintf("Run `%s repl --help` for help.", os.Args[0])
+
+	buf := bytes.Buffer{}
+	if _package == "" {
+		if err := ext.WriteTar(map[string][]byte{}, &buf); err != nil {
+			log.Fatal(err)
+		}
+	} else if fi, err := os.Stat(_package); err != nil {
+		log.Fatal(err)
+	} else if fi.IsDir() {
+		if file == "" {
+			log.Fatalf("ERROR: Required: --file. %s", _help)
+		}
+		log.Printf("Create package: %s, file: %s", _package, file)
+		if err := cadenceclient.Package(_package, file, nil, &buf); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		log.Printf("Read package: %s", _package)
+		b, err := os.ReadFile(_package)
+		if err != nil {
+			log.Fatal(err)
+		}
+		buf.Write(b)
+	}
+	log.Printf("Package size: %d bytes", buf.Len())
+
+	_env := parseEnv(env)
+	log.Printf("Env: %s", _env)
+
+	log.Printf("Cadence endpoint: %s, domain: %s, tasklist: %s", cadenceEndpoint, domain, tasklist)
+
+	cadenceCli := newCadenceClient(cadenceEndpoint, domain)
+
+	if err := cadenceclient.REPL(buf.Bytes(), _env, cadenceCli, tasklist, os.Stdin, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+const (
+	payloadKeysUsage = "File of the AES keys to decrypt the payloads with, the same as the workers' --payload-keys. Defaults to the " + encoded.KeysEnv + " environment variable."
+	blobStoreUsage   = "Directory of the blob store the workers offload large payloads to, the same as the workers' --blob-store."
+)
+
+// setPayloadOptions sets the keys the client data converter encrypts and decrypts payloads with, and the blob
+// store it offloads large payloads to.
+func setPayloadOptions(keysFile string, blobStore string) {
+	keys, err := encoded.LoadKeys(keysFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	encoded.DefaultKeys = keys
+	if blobStore != "" {
+		encoded.DefaultBlobs = &encoded.LocalBlobStore{Dir: blobStore}
+	}
+}
+
+func loadSignKey(file string) ed25519.PrivateKey {
+	if file == "" {
+		return nil
+	}
+	key, err := star.LoadPrivateKey(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return key
+}
+
+func uploadPackage(packageStore string, tar []byte) []byte {
+	store := &service.LocalPackageStore{Dir: packageStore}
+	ref, err := store.Put(context.Background(), tar)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Package ref: %s", ref)
+	return []byte(ref)
+}
+
+func parseEnv(env StringSliceValue) *starlark.Dict {
+	if len(env) == 0 {
+		return nil
+	}
+	_env := &starlark.Dict{}
+	sep := "="
+	for _, kv := range env {
+		k, v, found := strings.Cut(kv, sep)
+		if !found {
+			log.Fatalf("ERROR: Bad env format: separator '%s' not found: %s", sep, kv)
+		}
+		if err := _env.SetKey(starlark.String(k), starlark.String(v)); err != nil {
+			log.Fatal(err)
+		}
+	}
+	return _env
+}
+
+func newCadenceClient(cadenceEndpoint string, domain string) client.Client {
 	z := zap.NewDevelopmentConfig()
 	z.Level = zap.NewAtomicLevelAt(zap.InfoLevel)
 	logger, err := z.Build()
@@ -206,16 +535,11 @@ func __run__(_args []string) {
 		log.Fatal(err)
 	}
 
-	cadenceInterface := cadence.NewInterface(cadenceEndpoint)
-	cadenceCli := client.NewClient(cadenceInterface, domain, &client.Options{
+	cadenceInterface := cadence.NewWorkflowServiceClient(cadenceEndpoint)
+	return client.NewClient(cadenceInterface, domain, &client.Options{
 		MetricsScope: tally.NoopScope,
 		DataConverter: &cadence.DataConverter{
 			Logger: logger,
 		},
 	})
-
-	log.Printf("Entrypoint function: %s", function)
-	if err := cadenceclient.Run(_tar, file, function, argsP, kwargsP, _env, cadenceCli, tasklist); err != nil {
-		log.Fatal(err)
-	}
 }
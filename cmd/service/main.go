@@ -4,14 +4,17 @@ import (
 	"crypto/tls"
 	"flag"
 	"github.com/cadence-workflow/starlark-worker/cadence"
+	"github.com/cadence-workflow/starlark-worker/encoded"
 	"github.com/cadence-workflow/starlark-worker/plugin"
 	"github.com/cadence-workflow/starlark-worker/service"
+	"github.com/cadence-workflow/starlark-worker/star"
 	"github.com/cadence-workflow/starlark-worker/temporal"
 	"github.com/cadence-workflow/starlark-worker/worker"
 	"go.uber.org/zap"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 )
 
@@ -21,6 +24,21 @@ type _Options struct {
 	CadenceDomain   string
 	CadenceTaskList string
 	ClientTaskList  string
+	Limits          service.Limits
+	PackageStore    string
+	FetchPackages   bool
+	TrustedKeys     string
+	RequireSigned   bool
+	Repositories    string
+	PayloadFormat   string
+	TypedPayloads   bool
+	PayloadKeys     string
+	BlobStore       string
+	BlobThreshold   int
+	Compression     int
+	PayloadLimit    int
+	RetryConfig     string
+	NonRetriable    string
 }
 
 func (r *_Options) BindFlags(fs *flag.FlagSet) {
@@ -55,6 +73,114 @@ func (r *_Options) BindFlags(fs *flag.FlagSet) {
 		"",
 		"TaskList used by Cadence client to call user activities and workflows",
 	)
+	fs.StringVar(
+		&r.PackageStore,
+		"package-store",
+		"",
+		"Directory of the content-addressed package store used to resolve package references (sha256:...). All the workers must share it, unless --fetch-packages is set",
+	)
+	fs.BoolVar(
+		&r.FetchPackages,
+		"fetch-packages",
+		false,
+		"Fetch referenced packages missing from the in-memory cache via an activity instead of reading the package store directly; history then records the package content. Otherwise, workers replaying a workflow must read the same (shared) package store",
+	)
+	fs.StringVar(
+		&r.TrustedKeys,
+		"trusted-keys",
+		"",
+		"Comma-separated list of PEM-encoded ed25519 public key files package signatures are verified against",
+	)
+	fs.StringVar(
+		&r.Repositories,
+		"repositories",
+		"",
+		"Comma-separated list of external repositories loaded as @alias//path: alias=directory. The directory has a subdirectory per version; packages pin the version in meta.json. All the workers must share the directories",
+	)
+	fs.StringVar(
+		&r.PayloadFormat,
+		"payload-format",
+		"json",
+		"Format of the values passed between workflows and activities: 'json' or 'msgpack'. Payloads of any format are decoded",
+	)
+	fs.BoolVar(
+		&r.TypedPayloads,
+		"typed-payloads",
+		false,
+		"Encode Starlark values type-preserving: nested tuples, sets, bytes and dicts with non-string keys are __codec__ objects instead of plain JSON. Only if Starlark code reads all the payloads, no Go activities or clients",
+	)
+	fs.StringVar(
+		&r.PayloadKeys,
+		"payload-keys",
+		"",
+		"File of the AES keys payloads are encrypted with: 'id:base64-key' lines, the first key is current, the others decrypt payloads of rotated keys. Defaults to the "+encoded.KeysEnv+" environment variable (comma-separated entries); no encryption if neither is set",
+	)
+	fs.StringVar(
+		&r.BlobStore,
+		"blob-store",
+		"",
+		"Directory of the blob store large payloads are offloaded to; history keeps a reference instead (see --blob-threshold). All the workers and clients must share it, e.g. a network mount. No offloading if not set",
+	)
+	fs.IntVar(
+		&r.BlobThreshold,
+		"blob-threshold",
+		0,
+		"Payload size in bytes above which payloads are offloaded to the blob store (0: 256KiB, negative: no offloading)",
+	)
+	fs.IntVar(
+		&r.Compression,
+		"payload-compression-threshold",
+		-1,
+		"Payload size in bytes above which payloads are gzip-compressed (negative: no compression). Workers that predate compression can't decode compressed payloads: upgrade all the workers first, then enable it",
+	)
+	fs.IntVar(
+		&r.PayloadLimit,
+		"payload-size-limit",
+		-1,
+		"Payload size in bytes above which payloads fail before submission, e.g. 2097152 to match the default server limit (0 or negative: no limit)",
+	)
+	fs.StringVar(
+		&r.RetryConfig,
+		"retry-config",
+		"",
+		"JSON file overriding the default activity options, retry policy and non-retriable reasons: the default_activity_options, default_retry_policy and non_retriable_reasons sections of meta.json. Packages may override it",
+	)
+	fs.StringVar(
+		&r.NonRetriable,
+		"non-retriable-reasons",
+		"",
+		"Comma-separated list of error reasons not retried, replacing the defaults and those of --retry-config",
+	)
+	fs.BoolVar(
+		&r.RequireSigned,
+		"require-signed",
+		false,
+		"Reject packages without a signature by a trusted key (see --trusted-keys)",
+	)
+	fs.Uint64Var(
+		&r.Limits.MaxStepsPerDecision,
+		"max-steps-per-decision",
+		0,
+		"Max starlark execution steps per thread within a single decision task (0: no limit)",
+	)
+	fs.Uint64Var(
+		&r.Limits.MaxSteps,
+		"max-steps",
+		0,
+		"Max total starlark execution steps per thread (0: no limit)",
+	)
+	fs.IntVar(
+		&r.Limits.MaxRecursionDepth,
+		"max-recursion-depth",
+		0,
+		"Max starlark call stack depth (0: no limit)",
+	)
+	fs.IntVar(
+		&r.Limits.MaxPayloadSize,
+		"max-payload-size",
+		0,
+		"Max size in bytes of the encoded run arguments and result (0: no limit)",
+	)
 }
 
 func init() {
@@ -83,8 +209,30 @@ func main() {
 		panic(err)
 	}
 
+	zap.ReplaceGlobals(logger) // the logger of the Temporal data converter, see temporal.NewDataConverter
 	logger.Info("Options", zap.Any("Options", opt))
 
+	format, found := encoded.FormatByName(opt.PayloadFormat)
+	if !found {
+		logger.Fatal("not supported payload format", zap.String("payload_format", opt.PayloadFormat))
+	}
+	encoded.DefaultFormat = format
+	encoded.TypedStarlarkValues = opt.TypedPayloads
+
+	if encoded.DefaultKeys, err = encoded.LoadKeys(opt.PayloadKeys); err != nil {
+		logger.Fatal("bad payload keys", zap.Error(err))
+	}
+	if opt.BlobStore != "" {
+		encoded.DefaultBlobs = &encoded.LocalBlobStore{Dir: opt.BlobStore}
+	}
+	if opt.BlobThreshold != 0 {
+		encoded.DefaultBlobThreshold = opt.BlobThreshold
+	}
+	encoded.DefaultCompressionThreshold = opt.Compression
+	if opt.PayloadLimit > 0 {
+		encoded.DefaultMaxPayloadSize = opt.PayloadLimit
+	}
+
 	var newWorker worker.Worker
 	var backend service.BackendType
 	var deferFunc func()
@@ -101,6 +249,46 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	workerService.Limits = opt.Limits
+	if opt.PackageStore != "" {
+		workerService.PackageStore = &service.LocalPackageStore{Dir: opt.PackageStore}
+	}
+	workerService.FetchPackagesViaActivity = opt.FetchPackages
+	if opt.TrustedKeys != "" {
+		for _, file := range strings.Split(opt.TrustedKeys, ",") {
+			key, err := star.LoadPublicKey(strings.TrimSpace(file))
+			if err != nil {
+				logger.Fatal("trusted-keys", zap.Error(err))
+			}
+			logger.Info("trusted-key", zap.String("file", file), zap.String("key_id", star.KeyID(key)))
+			workerService.TrustedKeys = append(workerService.TrustedKeys, key)
+		}
+	}
+	workerService.RequireSignedPackages = opt.RequireSigned
+	if opt.Repositories != "" {
+		workerService.Repositories = map[string]string{}
+		for _, repo := range strings.Split(opt.Repositories, ",") {
+			alias, dir, ok := strings.Cut(strings.TrimSpace(repo), "=")
+			if !ok || alias == "" || dir == "" {
+				logger.Fatal("repositories", zap.String("repository", repo))
+			}
+			workerService.Repositories[alias] = dir
+		}
+	}
+	if opt.RetryConfig != "" {
+		if workerService.Retry, err = service.LoadRetryConfig(opt.RetryConfig); err != nil {
+			logger.Fatal("retry-config", zap.Error(err))
+		}
+	}
+	if opt.NonRetriable != "" {
+		workerService.Retry.NonRetriableReasons = nil
+		for _, reason := range strings.Split(opt.NonRetriable, ",") {
+			workerService.Retry.NonRetriableReasons = append(workerService.Retry.NonRetriableReasons, strings.TrimSpace(reason))
+		}
+	}
+	if err := workerService.Retry.Validate(); err != nil {
+		logger.Fatal("retry-config", zap.Error(err))
+	}
 	workerService.Register(newWorker)
 
 	if err := newWorker.Start(); err != nil {
@@ -2,15 +2,22 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/ed25519"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	temporalclient "github.com/cadence-workflow/starlark-worker/client/temporal_client"
+	"github.com/cadence-workflow/starlark-worker/encoded"
+	"github.com/cadence-workflow/starlark-worker/ext"
+	"github.com/cadence-workflow/starlark-worker/service"
 	"github.com/cadence-workflow/starlark-worker/star"
 	"github.com/cadence-workflow/starlark-worker/temporal"
 
@@ -26,8 +33,13 @@ Options:
   --help  Show this message and exit.
 
 Targets:
-  package    Create a starlark package file.
-  run        Run a starlark package.
+  package      Create a starlark package file.
+  run          Run a starlark package.
+  logs         Print (or follow) the logs of a workflow execution.
+  repl         Start an interactive starlark session (REPL workflow).
+  history      Print the history events of a workflow execution with their decoded payloads.
+  digest       Print the canonical package hash (sha256:...).
+  entrypoints  List the entrypoints declared in the package meta.json.
 `
 
 type StringSliceValue []string
@@ -41,8 +53,13 @@ func (r *StringSliceValue) Set(value string) error {
 }
 
 var targets = map[string]func(args []string){
-	"package": __package__,
-	"run":     __run__,
+	"package":     __package__,
+	"run":         __run__,
+	"logs":        __logs__,
+	"repl":        __repl__,
+	"digest":      __digest__,
+	"history":     __history__,
+	"entrypoints": __entrypoints__,
 }
 
 func main() {
@@ -69,42 +86,106 @@ func main() {
 
 func __package__(args []string) {
 	fs := flag.NewFlagSet("tar", flag.ExitOnError)
-	var rootDir, file string
+	var rootDir, file, signKey string
+	var list bool
 	fs.StringVar(&rootDir, "root-dir", ".", "Root directory to build a package from.")
 	fs.StringVar(&file, "file", "", "main file to create a package for")
+	fs.StringVar(&signKey, "sign-key", "", "PEM-encoded ed25519 private key file to sign the package with")
+	fs.BoolVar(&list, "list", false, "Print the package files and the total size instead of the package")
 	if err := fs.Parse(args); err != nil {
 		log.Fatal(err)
 	}
 	if file == "" {
 		log.Fatal("ERROR: --file required")
 	}
-	if err := temporalclient.Package(rootDir, file, os.Stdout); err != nil {
+	if list {
+		files, err := temporalclient.PackageFiles(rootDir, file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		printPackageFiles(files)
+		return
+	}
+	if err := temporalclient.Package(rootDir, file, loadSignKey(signKey), os.Stdout); err != nil {
 		log.Fatal(err)
 	}
 }
 
+func printPackageFiles(files map[string][]byte) {
+	paths := make([]string, 0, len(files))
+	var size int
+	for p, content := range files {
+		paths = append(paths, p)
+		size += len(content)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		fmt.Printf("%10d  %s\n", len(files[p]), p)
+	}
+	fmt.Printf("%10d  total (%d files)\n", size, len(files))
+}
+
+func __digest__(args []string) {
+	fs := flag.NewFlagSet("digest", flag.ExitOnError)
+	var _package, rootDir, file, signKey string
+	fs.StringVar(&_package, "package", "", "Package file to hash (- for stdin); built from --root-dir and --file if not set")
+	fs.StringVar(&rootDir, "root-dir", ".", "Root directory to build a package from.")
+	fs.StringVar(&file, "file", "", "main file to create a package for")
+	fs.StringVar(&signKey, "sign-key", "", "PEM-encoded ed25519 private key file to sign the package with")
+	if err := fs.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+
+	var _tar []byte
+	var err error
+	switch {
+	case _package == "-":
+		_tar, err = io.ReadAll(os.Stdin)
+	case _package != "":
+		_tar, err = os.ReadFile(_package)
+	case file == "":
+		log.Fatal("ERROR: --file or --package required")
+	default:
+		buf := bytes.Buffer{}
+		err = temporalclient.Package(rootDir, file, loadSignKey(signKey), &buf)
+		_tar = buf.Bytes()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(service.PackageRef(_tar))
+}
+
 func __run__(_args []string) {
 	fs := flag.NewFlagSet("run", flag.ExitOnError)
 
-	var _package, file, function, args, kwargs, temporalEndpoint, namespace, taskqueue string
+	var _package, file, function, entrypoint, args, kwargs, temporalEndpoint, namespace, taskqueue, packageStore, signKey, payloadKeys, blobStore string
 	var env StringSliceValue
+	var follow bool
 
 	fs.StringVar(&_package, "package", ".", "Path to package file or directory")
 	fs.StringVar(&file, "file", "", "Entrypoint .star file")
 	fs.StringVar(&function, "function", "main", "Entrypoint function name")
+	fs.StringVar(&entrypoint, "entrypoint", "", "Name of the entrypoint declared in the package meta.json to run, instead of --file and --function (see the entrypoints target)")
 	fs.StringVar(&args, "args", "[]", "Function positional args (JSON array)")
 	fs.StringVar(&kwargs, "kwargs", "[]", "Function keyword args (JSON array of arrays)")
 	fs.Var(&env, "env", "Environment variables (KEY=VALUE format)")
 	fs.StringVar(&temporalEndpoint, "temporal-url", "localhost:7233", "")
 	fs.StringVar(&namespace, "namespace", "default", "")
 	fs.StringVar(&taskqueue, "taskqueue", "default", "")
+	fs.BoolVar(&follow, "follow", false, "Tail the execution logs until the execution is closed")
+	fs.StringVar(&packageStore, "package-store", "", "Package store directory shared with the workers: upload the package once and run it by reference")
+	fs.StringVar(&signKey, "sign-key", "", "PEM-encoded ed25519 private key file to sign the package built from a directory")
+	fs.StringVar(&payloadKeys, "payload-keys", "", payloadKeysUsage)
+	fs.StringVar(&blobStore, "blob-store", "", blobStoreUsage)
 
 	if err := fs.Parse(_args); err != nil {
 		log.Fatal(err)
 	}
+	setPayloadOptions(payloadKeys, blobStore)
 
-	if file == "" {
-		log.Fatal("ERROR: --file required")
+	if file == "" && entrypoint == "" {
+		log.Fatal("ERROR: --file or --entrypoint required")
 	}
 
 	var _tar []byte
@@ -112,8 +193,13 @@ func __run__(_args []string) {
 	if _package == "-" {
 		_tar, err = io.ReadAll(os.Stdin)
 	} else if fi, err := os.Stat(_package); err == nil && fi.IsDir() {
+		if file == "" {
+			if file, err = service.EntrypointFile(_package, entrypoint); err != nil {
+				log.Fatal(err)
+			}
+		}
 		buf := bytes.Buffer{}
-		if err := temporalclient.Package(_package, file, &buf); err != nil {
+		if err := temporalclient.Package(_package, file, loadSignKey(signKey), &buf); err != nil {
 			log.Fatal(err)
 		}
 		_tar = buf.Bytes()
@@ -128,20 +214,12 @@ func __run__(_args []string) {
 	}
 	log.Printf("Package size: %d bytes", len(_tar))
 
-	var _env *starlark.Dict
-	if len(env) > 0 {
-		_env = &starlark.Dict{}
-		for _, kv := range env {
-			k, v, found := strings.Cut(kv, "=")
-			if !found {
-				log.Fatalf("Bad env format: %s", kv)
-			}
-			if err := _env.SetKey(starlark.String(k), starlark.String(v)); err != nil {
-				log.Fatal(err)
-			}
-		}
+	if packageStore != "" {
+		_tar = uploadPackage(packageStore, _tar)
 	}
 
+	_env := parseEnv(env)
+
 	var argsP starlark.Tuple
 	if err = star.Decode([]byte(args), &argsP); err != nil {
 		log.Fatal(err)
@@ -165,8 +243,254 @@ func __run__(_args []string) {
 	}
 	defer c.Close()
 
+	if entrypoint != "" {
+		file, function = "", entrypoint // resolved by the worker
+	}
 	log.Printf("Running entrypoint: %s", function)
-	if err := temporalclient.Run(_tar, file, function, argsP, kwargsP, _env, c, taskqueue); err != nil {
+	if err := temporalclient.Run(_tar, file, function, argsP, kwargsP, _env, c, taskqueue, follow); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func __entrypoints__(args []string) {
+
+	fs := flag.NewFlagSet("entrypoints", flag.ExitOnError)
+
+	var _package string
+
+	fs.StringVar(&_package, "package", ".", "Package file, directory with meta.json, or - (single hyphen) to read the package from stdin.")
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+
+	meta, err := service.LoadMeta(_package)
+	if err != nil {
+		log.Fatal(err)
+	}
+	service.PrintEntrypoints(os.Stdout, meta)
+}
+
+func __logs__(_args []string) {
+	fs := flag.NewFlagSet("logs", flag.ExitOnError)
+
+	var workflowID, runID, level, since, contains, temporalEndpoint, namespace, payloadKeys, blobStore string
+	var offset int64
+	var limit int
+	var follow bool
+
+	fs.StringVar(&workflowID, "workflow-id", "", "Workflow execution ID")
+	fs.StringVar(&runID, "run-id", "", "Workflow run ID (latest run if empty)")
+	fs.Int64Var(&offset, "offset", 0, "Sequence number of the first log entry")
+	fs.IntVar(&limit, "limit", 0, "Max number of log entries (per poll with --follow)")
+	fs.StringVar(&level, "level", "", "Minimal log level: debug, info, warning or error")
+	fs.StringVar(&since, "since", "", "Entries logged at or after the given time (RFC3339)")
+	fs.StringVar(&contains, "contains", "", "Entries whose message contains the given substring")
+	fs.BoolVar(&follow, "follow", false, "Keep polling for new entries until the execution is closed")
+	fs.StringVar(&temporalEndpoint, "temporal-url", "localhost:7233", "")
+	fs.StringVar(&namespace, "namespace", "default", "")
+	fs.StringVar(&payloadKeys, "payload-keys", "", payloadKeysUsage)
+	fs.StringVar(&blobStore, "blob-store", "", blobStoreUsage)
+
+	if err := fs.Parse(_args); err != nil {
+		log.Fatal(err)
+	}
+	setPayloadOptions(payloadKeys, blobStore)
+
+	if workflowID == "" {
+		log.Fatal("ERROR: --workflow-id required")
+	}
+
+	query := service.LogsQuery{
+		Offset:   offset,
+		Limit:    limit,
+		Level:    level,
+		Contains: contains,
+	}
+	if since != "" {
+		var err error
+		if query.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	c, err := client.Dial(client.Options{
+		HostPort:      temporalEndpoint,
+		Namespace:     namespace,
+		DataConverter: temporal.DataConverter{},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx := context.Background()
+	if follow {
+		if err := temporalclient.Follow(ctx, c, workflowID, runID, query); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	v, err := c.QueryWorkflow(ctx, workflowID, runID, service.LogEntriesQueryName, query)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var entries []service.LogEntry
+	if err := v.Get(&entries); err != nil {
+		log.Fatal(err)
+	}
+	for _, e := range entries {
+		log.Println(e.String())
+	}
+}
+
+func __history__(_args []string) {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+
+	var workflowID, runID, temporalEndpoint, namespace, payloadKeys, blobStore string
+
+	fs.StringVar(&workflowID, "workflow-id", "", "Workflow execution ID")
+	fs.StringVar(&runID, "run-id", "", "Workflow run ID (latest run if empty)")
+	fs.StringVar(&temporalEndpoint, "temporal-url", "localhost:7233", "")
+	fs.StringVar(&namespace, "namespace", "default", "")
+	fs.StringVar(&payloadKeys, "payload-keys", "", payloadKeysUsage)
+	fs.StringVar(&blobStore, "blob-store", "", blobStoreUsage)
+
+	if err := fs.Parse(_args); err != nil {
 		log.Fatal(err)
 	}
+	setPayloadOptions(payloadKeys, blobStore)
+
+	if workflowID == "" {
+		log.Fatal("ERROR: --workflow-id required")
+	}
+
+	c, err := client.Dial(client.Options{
+		HostPort:      temporalEndpoint,
+		Namespace:     namespace,
+		DataConverter: temporal.DataConverter{},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := temporalclient.History(context.Background(), c, workflowID, runID); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func __repl__(_args []string) {
+	fs := flag.NewFlagSet("repl", flag.ExitOnError)
+
+	var _package, file, temporalEndpoint, namespace, taskqueue, payloadKeys, blobStore string
+	var env StringSliceValue
+
+	fs.StringVar(&_package, "package", "", "Path to package file or directory to load modules from (optional)")
+	fs.StringVar(&file, "file", "", ".star file to build the package from (required if --package is a directory)")
+	fs.Var(&env, "env", "Environment variables (KEY=VALUE format)")
+	fs.StringVar(&temporalEndpoint, "temporal-url", "localhost:7233", "")
+	fs.StringVar(&namespace, "namespace", "default", "")
+	fs.StringVar(&taskqueue, "taskqueue", "default", "")
+	fs.StringVar(&payloadKeys, "payload-keys", "", payloadKeysUsage)
+	fs.StringVar(&blobStore, "blob-store", "", blobStoreUsage)
+
+	if err := fs.Parse(_args); err != nil {
+		log.Fatal(err)
+	}
+	setPayloadOptions(payloadKeys, blobStore)
+
+	buf := bytes.Buffer{}
+	if _package == "" {
+		if err := ext.WriteTar(map[string][]byte{}, &buf); err != nil {
+			log.Fatal(err)
+		}
+	} else if fi, err := os.Stat(_package); err != nil {
+		log.Fatal(err)
+	} else if fi.IsDir() {
+		if file == "" {
+			log.Fatal("ERROR: --file required")
+		}
+		if err := temporalclient.Package(_package, file, nil, &buf); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		b, err := os.ReadFile(_package)
+		if err != nil {
+			log.Fatal(err)
+		}
+		buf.Write(b)
+	}
+	log.Printf("Package size: %d bytes", buf.Len())
+
+	c, err := client.Dial(client.Options{
+		HostPort:      temporalEndpoint,
+		Namespace:     namespace,
+		DataConverter: temporal.DataConverter{},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := temporalclient.REPL(buf.Bytes(), parseEnv(env), c, taskqueue, os.Stdin, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+const (
+	payloadKeysUsage = "File of the AES keys to decrypt the payloads with, the same as the workers' --payload-keys. Defaults to the " + encoded.KeysEnv + " environment variable."
+	blobStoreUsage   = "Directory of the blob store the workers offload large payloads to, the same as the workers' --blob-store."
+)
+
+// setPayloadOptions sets the keys the client data converter encrypts and decrypts payloads with, and the blob
+// store it offloads large payloads to.
+func setPayloadOptions(keysFile string, blobStore string) {
+	keys, err := encoded.LoadKeys(keysFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	encoded.DefaultKeys = keys
+	if blobStore != "" {
+		encoded.DefaultBlobs = &encoded.LocalBlobStore{Dir: blobStore}
+	}
+}
+
+func loadSignKey(file string) ed25519.PrivateKey {
+	if file == "" {
+		return nil
+	}
+	key, err := star.LoadPrivateKey(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return key
+}
+
+func uploadPackage(packageStore string, tar []byte) []byte {
+	store := &service.LocalPackageStore{Dir: packageStore}
+	ref, err := store.Put(context.Background(), tar)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Package ref: %s", ref)
+	return []byte(ref)
+}
+
+func parseEnv(env StringSliceValue) *starlark.Dict {
+	if len(env) == 0 {
+		return nil
+	}
+	_env := &starlark.Dict{}
+	for _, kv := range env {
+		k, v, found := strings.Cut(kv, "=")
+		if !found {
+			log.Fatalf("Bad env format: %s", kv)
+		}
+		if err := _env.SetKey(starlark.String(k), starlark.String(v)); err != nil {
+			log.Fatal(err)
+		}
+	}
+	return _env
 }
@@ -0,0 +1,185 @@
+package encoded
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// BlobRefPrefix is the prefix of content-addressed blob references: "sha256:<hex digest>".
+const BlobRefPrefix = "sha256:"
+
+// BlobStore stores the large payloads the data converters offload: history keeps a small reference instead of
+// the payload (claim check). Blobs are content-addressed, and offloaded payloads are encrypted deterministically,
+// so that encoding the same value again, e.g. on replay, references the same blob. Every worker and client
+// reading the histories must read the same store.
+//
+// Blobs are reference-counted: each Put holds a reference to the blob until Release. Workflow replays encode
+// values again and add references, so counts are an upper bound: a referenced blob is never deleted, an
+// unreferenced one may be kept.
+type BlobStore interface {
+	// Put stores the blob and returns its reference. Storing the same content again adds a reference.
+	Put(ctx context.Context, data []byte) (string, error)
+	// Get returns the blob by reference. Returns an error wrapping os.ErrNotExist if the blob is unknown.
+	Get(ctx context.Context, ref string) ([]byte, error)
+	// Release drops a reference to the blob. The blob is deleted once it is no longer referenced.
+	Release(ctx context.Context, ref string) error
+}
+
+var (
+	// DefaultBlobs is the blob store of the data converters without an explicit store. Nil disables offloading.
+	DefaultBlobs BlobStore
+	// DefaultBlobThreshold is the payload size (bytes) above which the data converters without an explicit
+	// threshold offload payloads to the blob store.
+	DefaultBlobThreshold = 256 << 10
+)
+
+// BlobRef returns the content-addressed reference of the given blob.
+func BlobRef(data []byte) string {
+	sum := sha256.Sum256(data)
+	return BlobRefPrefix + hex.EncodeToString(sum[:])
+}
+
+// ParseBlobRef returns the blob reference if the given bytes are a well-formed reference.
+func ParseBlobRef(b []byte) (string, bool) {
+	if len(b) != len(BlobRefPrefix)+sha256.Size*2 || !bytes.HasPrefix(b, []byte(BlobRefPrefix)) {
+		return "", false
+	}
+	if _, err := hex.DecodeString(string(b[len(BlobRefPrefix):])); err != nil {
+		return "", false
+	}
+	return string(b), true
+}
+
+// LocalBlobStore is a BlobStore backed by a local (or mounted) directory: blobs are stored as
+// Dir/sha256/<hex digest> files, their reference counts as <hex digest>.refs files next to them. All the workers
+// and clients must share the directory, e.g. a network mount: payloads offloaded to a worker-local directory
+// can't be decoded by other workers replaying the workflow.
+//
+// Reference counts are guarded by an in-process lock: workers sharing the directory must not release the same
+// blobs concurrently.
+type LocalBlobStore struct {
+	Dir string
+	// OnDelete is called with the reference of each deleted blob, e.g. to clean up caches or replicas.
+	OnDelete func(ref string)
+
+	mu sync.Mutex
+}
+
+var _ BlobStore = (*LocalBlobStore)(nil)
+
+func (r *LocalBlobStore) Put(_ context.Context, data []byte) (string, error) {
+	ref := BlobRef(data)
+	p, err := r.path(ref)
+	if err != nil {
+		return "", err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := os.Stat(p); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			return "", err
+		}
+		if err := writeFile(p, data); err != nil {
+			return "", err
+		}
+	} else if err != nil {
+		return "", err
+	}
+	n, err := r.refs(p)
+	if err != nil {
+		return "", err
+	}
+	if err := writeFile(p+".refs", []byte(strconv.Itoa(n+1))); err != nil {
+		return "", err
+	}
+	return ref, nil
+}
+
+func (r *LocalBlobStore) Get(_ context.Context, ref string) ([]byte, error) {
+	p, err := r.path(ref)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	if actual := BlobRef(data); actual != ref {
+		return nil, fmt.Errorf("blob digest mismatch: expected: %s, actual: %s", ref, actual)
+	}
+	return data, nil
+}
+
+func (r *LocalBlobStore) Release(_ context.Context, ref string) error {
+	p, err := r.path(ref)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n, err := r.refs(p)
+	if err != nil {
+		return err
+	}
+	if n > 1 {
+		return writeFile(p+".refs", []byte(strconv.Itoa(n-1)))
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Remove(p + ".refs"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if r.OnDelete != nil {
+		r.OnDelete(ref)
+	}
+	return nil
+}
+
+// refs returns the reference count of the blob file; zero if the count file is missing.
+func (r *LocalBlobStore) refs(p string) (int, error) {
+	b, err := os.ReadFile(p + ".refs")
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return 0, fmt.Errorf("bad blob reference count: %s: %w", p, err)
+	}
+	return n, nil
+}
+
+func (r *LocalBlobStore) path(ref string) (string, error) {
+	if _, ok := ParseBlobRef([]byte(ref)); !ok {
+		return "", fmt.Errorf("bad blob reference: %s", ref)
+	}
+	return filepath.Join(r.Dir, "sha256", strings.TrimPrefix(ref, BlobRefPrefix)), nil
+}
+
+// writeFile writes to a temp file first, so concurrent readers never see a partial file.
+func writeFile(p string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
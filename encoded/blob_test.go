@@ -0,0 +1,53 @@
+package encoded
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalBlobStore(t *testing.T) {
+	ctx := context.Background()
+	var deleted []string
+	store := &LocalBlobStore{Dir: t.TempDir(), OnDelete: func(ref string) { deleted = append(deleted, ref) }}
+
+	ref, err := store.Put(ctx, []byte("blob"))
+	require.NoError(t, err)
+	require.Equal(t, BlobRef([]byte("blob")), ref)
+	ref2, err := store.Put(ctx, []byte("blob"))
+	require.NoError(t, err)
+	require.Equal(t, ref, ref2)
+
+	data, err := store.Get(ctx, ref)
+	require.NoError(t, err)
+	require.Equal(t, []byte("blob"), data)
+
+	// Assert the blob is deleted once the last reference is released.
+	require.NoError(t, store.Release(ctx, ref))
+	_, err = store.Get(ctx, ref)
+	require.NoError(t, err)
+	require.Empty(t, deleted)
+	require.NoError(t, store.Release(ctx, ref))
+	_, err = store.Get(ctx, ref)
+	require.ErrorIs(t, err, os.ErrNotExist)
+	require.Equal(t, []string{ref}, deleted)
+
+	_, err = store.Get(ctx, "sha256:bad")
+	require.Error(t, err)
+	_, err = store.Get(ctx, BlobRef([]byte("unknown")))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestParseBlobRef(t *testing.T) {
+	ref := BlobRef([]byte("blob"))
+	r, ok := ParseBlobRef([]byte(ref))
+	require.True(t, ok)
+	require.Equal(t, ref, r)
+
+	for _, s := range []string{"", "sha256:", ref[:len(ref)-1], "md5:" + ref[7:], ref[:len(ref)-1] + "x"} {
+		_, ok := ParseBlobRef([]byte(s))
+		require.False(t, ok, s)
+	}
+}
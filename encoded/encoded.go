@@ -13,3 +13,14 @@ type Values interface {
 	// Get extract the encoded values into strong typed value pointers.
 	Get(valuePtr ...interface{}) error
 }
+
+var (
+	// DefaultCompressionThreshold is the encoded payload size (bytes) above which the data converters without an
+	// explicit threshold gzip-compress payloads. Negative (default) disables compression: workers that predate
+	// compression fail to decode compressed payloads, so enable it only once all the workers decode them.
+	DefaultCompressionThreshold = -1
+	// DefaultMaxPayloadSize is the payload size (bytes) above which the data converters without an explicit limit
+	// fail before submission. Negative (default) disables the check; the default blob size limit of Cadence and
+	// Temporal servers is 2MiB.
+	DefaultMaxPayloadSize = -1
+)
@@ -0,0 +1,229 @@
+package encoded
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"reflect"
+	"sync"
+
+	"github.com/cadence-workflow/starlark-worker/ext"
+	"github.com/cadence-workflow/starlark-worker/star"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/vmihailenco/msgpack/v5"
+	"go.starlark.net/starlark"
+)
+
+// PayloadFormat encodes the values passed between workflows and activities by the data converters.
+//
+// Decoding detects the format of each payload: Temporal payloads carry the format name in the "encoding" metadata,
+// Cadence payloads start with the format header byte. Formats other than JSON and MsgPack must be registered with
+// RegisterFormat on both workers and clients.
+type PayloadFormat interface {
+	// Name identifies the format, e.g. in the Temporal "encoding" payload metadata.
+	Name() string
+	// Header is the first byte of the Cadence payloads of the format. JSON payloads have no header: zero.
+	Header() byte
+	// Encode encodes the values into a single payload.
+	Encode(values []any) ([]byte, error)
+	// Decode decodes the payload into the output pointers.
+	Decode(data []byte, to []any) error
+}
+
+var (
+	// JSON is the default payload format: newline-delimited JSON. Starlark values are encoded with star.Encode,
+	// other Go values with jsoniter.
+	JSON PayloadFormat = jsonFormat{}
+	// MsgPack is the compact binary payload format: a sequence of MessagePack values. Starlark values are encoded
+	// with star.EncodeMsgPack, other Go values follow their "json" struct tags.
+	MsgPack PayloadFormat = msgpackFormat{}
+
+	// DefaultFormat is the payload format of the data converters without an explicit format.
+	DefaultFormat = JSON
+
+	// TypedStarlarkValues makes the payload formats encode Starlark values type-preserving (see star.EncodeTyped)
+	// rather than as plain JSON: nested tuples, sets, bytes and dicts with non-string keys are codec dictionaries.
+	// Enable it only if Starlark code decodes all the payloads, e.g. no Go activities, workflows or clients.
+	TypedStarlarkValues = false
+)
+
+var formats = struct {
+	sync.RWMutex
+	list []PayloadFormat
+}{list: []PayloadFormat{JSON, MsgPack}}
+
+// RegisterFormat makes a custom payload format available for decoding. It panics if the format name or header is
+// already in use.
+func RegisterFormat(f PayloadFormat) {
+	formats.Lock()
+	defer formats.Unlock()
+	for _, r := range formats.list {
+		if r.Name() == f.Name() || r.Header() == f.Header() {
+			panic(fmt.Errorf("payload format is already registered: %s", f.Name()))
+		}
+	}
+	formats.list = append(formats.list, f)
+}
+
+// FormatByName returns the registered payload format of the given name.
+func FormatByName(name string) (PayloadFormat, bool) {
+	formats.RLock()
+	defer formats.RUnlock()
+	for _, f := range formats.list {
+		if f.Name() == name {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+// FormatByHeader returns the payload format of a Cadence payload: JSON unless the first byte is the header of
+// a registered format.
+func FormatByHeader(data []byte) PayloadFormat {
+	if len(data) == 0 {
+		return JSON
+	}
+	formats.RLock()
+	defer formats.RUnlock()
+	for _, f := range formats.list {
+		if f.Header() != 0 && f.Header() == data[0] {
+			return f
+		}
+	}
+	return JSON
+}
+
+const jsonDelimiter byte = '\n'
+
+type jsonFormat struct{}
+
+func (jsonFormat) Name() string { return "json" }
+func (jsonFormat) Header() byte { return 0 }
+
+func (jsonFormat) Encode(values []any) ([]byte, error) {
+	var buf bytes.Buffer
+	encode := star.Encode
+	if TypedStarlarkValues {
+		encode = star.EncodeTyped
+	}
+	for _, v := range values {
+		b, err := encode(v) // try star encoder
+		if _, ok := err.(star.UnsupportedTypeError); ok {
+			b, err = jsoniter.Marshal(v) // go encoder fallback
+		}
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(b)
+		buf.WriteByte(jsonDelimiter)
+	}
+	return buf.Bytes(), nil
+}
+
+func (jsonFormat) Decode(data []byte, to []any) error {
+	r := bufio.NewReader(bytes.NewReader(data))
+	for i := 0; i < len(to); i++ {
+		line, err := r.ReadBytes(jsonDelimiter)
+		var eof bool
+		if err == io.EOF {
+			eof = true
+			err = nil
+		}
+		if err != nil {
+			return err
+		}
+		ll := len(line)
+		if eof && ll == 0 {
+			break
+		}
+		if line[ll-1] == jsonDelimiter {
+			line = line[:ll-1]
+		}
+		out := to[i]
+
+		// First try to decode the value using Starlark decoder, and if it fails, fall back to JSON decoder.
+		err = star.Decode(line, out)
+		if _, ok := err.(star.UnsupportedTypeError); ok {
+			err = ext.JSONNumber.Unmarshal(line, out) // numbers into interfaces are json.Number: exact integers
+		}
+		if err != nil {
+			return err
+		}
+		if eof {
+			break
+		}
+	}
+	return nil
+}
+
+type msgpackFormat struct{}
+
+func (msgpackFormat) Name() string { return "msgpack" }
+func (msgpackFormat) Header() byte { return 0x01 }
+
+func (msgpackFormat) Encode(values []any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.UseCompactInts(true)
+	enc.SetSortMapKeys(true)
+	enc.SetCustomStructTag("json")
+	encode := star.EncodeMsgPack
+	if TypedStarlarkValues {
+		encode = star.EncodeMsgPackTyped
+	}
+	for _, v := range values {
+		err := encode(enc, v) // try star encoder
+		if _, ok := err.(star.UnsupportedTypeError); ok {
+			err = enc.Encode(v) // go encoder fallback
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackFormat) Decode(data []byte, to []any) error {
+	r := bytes.NewReader(data)
+	dec := msgpack.NewDecoder(r)
+	dec.SetCustomStructTag("json")
+	dec.UseLooseInterfaceDecoding(true)
+	for _, out := range to {
+		if r.Len() == 0 {
+			break
+		}
+		err := star.DecodeMsgPack(dec, out) // try star decoder
+		if _, ok := err.(star.UnsupportedTypeError); ok {
+			err = dec.Decode(out) // go decoder fallback
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func init() {
+	// json.Number, see ext.JSONNumber, is a number rather than a string. Integers are exact, see star.EncodeMsgPack.
+	msgpack.Register(json.Number(""), func(enc *msgpack.Encoder, v reflect.Value) error {
+		n := json.Number(v.String())
+		if i, ok := new(big.Int).SetString(n.String(), 10); ok {
+			return star.EncodeMsgPack(enc, starlark.MakeBigInt(i))
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return err
+		}
+		return enc.EncodeFloat64(f)
+	}, func(dec *msgpack.Decoder, v reflect.Value) error {
+		var n starlark.Value
+		if err := star.DecodeMsgPack(dec, &n); err != nil {
+			return err
+		}
+		v.SetString(n.String())
+		return nil
+	})
+}
@@ -0,0 +1,191 @@
+package encoded
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// KeysEnv is the environment variable of the payload encryption keys, see KeyRingFromEnv.
+const KeysEnv = "STAR_PAYLOAD_KEYS"
+
+// KeyProvider provides the AES keys the data converters encrypt payloads with. Each encrypted payload records
+// the ID of its key, so that keys can be rotated: payloads are encrypted with the current key and decrypted with
+// the key of the recorded ID.
+type KeyProvider interface {
+	// CurrentKey returns the key new payloads are encrypted with, and its ID.
+	CurrentKey() (id string, key []byte, err error)
+	// Key returns the key of the given ID.
+	Key(id string) ([]byte, error)
+}
+
+// DefaultKeys is the key provider of the data converters without explicit keys. Nil disables encryption.
+var DefaultKeys KeyProvider
+
+// KeyRing is a static KeyProvider: the first key is current, the others only decrypt payloads of previous keys.
+type KeyRing struct {
+	ids  []string
+	keys map[string][]byte
+}
+
+var _ KeyProvider = (*KeyRing)(nil)
+
+// ParseKeyRing parses "id:base64-key" entries separated by newlines or commas. Empty lines and lines starting
+// with '#' are skipped. Keys are 16, 24 or 32 bytes long: AES-128, AES-192 or AES-256.
+func ParseKeyRing(s string) (*KeyRing, error) {
+	r := &KeyRing{keys: map[string][]byte{}}
+	for _, line := range strings.FieldsFunc(s, func(c rune) bool { return c == '\n' || c == ',' }) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		id, b64, found := strings.Cut(line, ":")
+		id = strings.TrimSpace(id)
+		if !found || id == "" {
+			return nil, fmt.Errorf("bad payload key entry: expected: id:base64-key")
+		}
+		if len(id) > 255 {
+			return nil, fmt.Errorf("bad payload key id: longer than 255 bytes: %s", id)
+		}
+		if _, found := r.keys[id]; found {
+			return nil, fmt.Errorf("duplicate payload key id: %s", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(b64))
+		if err != nil {
+			return nil, fmt.Errorf("bad payload key: %s: %w", id, err)
+		}
+		if _, err := aes.NewCipher(key); err != nil {
+			return nil, fmt.Errorf("bad payload key: %s: %w", id, err)
+		}
+		r.ids = append(r.ids, id)
+		r.keys[id] = key
+	}
+	if len(r.ids) == 0 {
+		return nil, errors.New("no payload keys")
+	}
+	return r, nil
+}
+
+// LoadKeyRing reads the key ring from a file, see ParseKeyRing.
+func LoadKeyRing(file string) (*KeyRing, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKeyRing(string(b))
+}
+
+// KeyRingFromEnv reads the key ring from an environment variable, see ParseKeyRing. Returns nil if the variable
+// is not set.
+func KeyRingFromEnv(name string) (*KeyRing, error) {
+	s, found := os.LookupEnv(name)
+	if !found {
+		return nil, nil
+	}
+	return ParseKeyRing(s)
+}
+
+// LoadKeys returns the key ring of the file, or of the KeysEnv environment variable if the file is not set.
+// Returns nil if neither is set: no encryption.
+func LoadKeys(file string) (KeyProvider, error) {
+	if file != "" {
+		return LoadKeyRing(file)
+	}
+	r, err := KeyRingFromEnv(KeysEnv)
+	if r == nil || err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// CurrentKey returns the first key of the ring.
+func (r *KeyRing) CurrentKey() (string, []byte, error) {
+	return r.ids[0], r.keys[r.ids[0]], nil
+}
+
+// Key returns the key of the given ID.
+func (r *KeyRing) Key(id string) ([]byte, error) {
+	key, found := r.keys[id]
+	if !found {
+		return nil, fmt.Errorf("unknown payload key: %s", id)
+	}
+	return key, nil
+}
+
+// Encrypt encrypts the data with the current key using AES-GCM. Returns the key ID and the random nonce followed
+// by the ciphertext. The key ID is authenticated as additional data.
+func Encrypt(keys KeyProvider, data []byte) (string, []byte, error) {
+	id, key, err := keys.CurrentKey()
+	if err != nil {
+		return "", nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(data)+gcm.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, err
+	}
+	return id, gcm.Seal(nonce, nonce, data, []byte(id)), nil
+}
+
+// EncryptDeterministic is Encrypt with a synthetic nonce derived from the key ID and the data by HMAC-SHA256 rather
+// than a random one: the same data encrypted with the same key gives the same result, so that encrypted payloads
+// are content-addressable, e.g. by the blob store. It reveals which payloads are equal. Decrypt decrypts the result.
+func EncryptDeterministic(keys KeyProvider, data []byte) (string, []byte, error) {
+	id, key, err := keys.CurrentKey()
+	if err != nil {
+		return "", nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", nil, err
+	}
+	// derive the nonce key, so that the AES key itself is not used for HMAC
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("payload-nonce"))
+	mac = hmac.New(sha256.New, mac.Sum(nil))
+	mac.Write([]byte{byte(len(id))})
+	mac.Write([]byte(id))
+	mac.Write(data)
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(data)+gcm.Overhead())
+	copy(nonce, mac.Sum(nil))
+	return id, gcm.Seal(nonce, nonce, data, []byte(id)), nil
+}
+
+// Decrypt decrypts data returned by Encrypt or EncryptDeterministic with the key of the given ID.
+func Decrypt(keys KeyProvider, id string, data []byte) ([]byte, error) {
+	key, err := keys.Key(id)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("bad encrypted payload: too short")
+	}
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	res, err := gcm.Open(nil, nonce, ciphertext, []byte(id))
+	if err != nil {
+		return nil, fmt.Errorf("decrypt payload: key: %s: %w", id, err)
+	}
+	return res, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
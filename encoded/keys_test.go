@@ -0,0 +1,123 @@
+package encoded
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyRing(t *testing.T) {
+	key1 := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("1", 32)))
+	key2 := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("2", 16)))
+
+	t.Run("parse", func(t *testing.T) {
+		r, err := ParseKeyRing("# rotated 2026-10\nk2:" + key2 + "\n\nk1:" + key1 + "\n")
+		require.NoError(t, err)
+		id, key, err := r.CurrentKey()
+		require.NoError(t, err)
+		require.Equal(t, "k2", id)
+		require.Equal(t, []byte(strings.Repeat("2", 16)), key)
+		key, err = r.Key("k1")
+		require.NoError(t, err)
+		require.Equal(t, []byte(strings.Repeat("1", 32)), key)
+		_, err = r.Key("k3")
+		require.Error(t, err)
+	})
+
+	t.Run("bad", func(t *testing.T) {
+		for _, s := range []string{
+			"",
+			"k1",
+			":" + key1,
+			"k1:not-base64",
+			"k1:" + base64.StdEncoding.EncodeToString([]byte("short")),
+			"k1:" + key1 + ",k1:" + key2,
+		} {
+			_, err := ParseKeyRing(s)
+			require.Error(t, err, s)
+		}
+	})
+
+	t.Run("file", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "keys")
+		require.NoError(t, os.WriteFile(file, []byte("k1:"+key1+"\n"), 0o600))
+		r, err := LoadKeyRing(file)
+		require.NoError(t, err)
+		id, _, err := r.CurrentKey()
+		require.NoError(t, err)
+		require.Equal(t, "k1", id)
+	})
+
+	t.Run("env", func(t *testing.T) {
+		t.Setenv(KeysEnv, "k2:"+key2+",k1:"+key1)
+		r, err := KeyRingFromEnv(KeysEnv)
+		require.NoError(t, err)
+		id, _, err := r.CurrentKey()
+		require.NoError(t, err)
+		require.Equal(t, "k2", id)
+
+		keys, err := LoadKeys("")
+		require.NoError(t, err)
+		id, _, err = keys.CurrentKey()
+		require.NoError(t, err)
+		require.Equal(t, "k2", id)
+
+		r, err = KeyRingFromEnv("STAR_PAYLOAD_KEYS_UNSET")
+		require.NoError(t, err)
+		require.Nil(t, r)
+	})
+
+	t.Run("unset", func(t *testing.T) {
+		t.Setenv(KeysEnv, "")
+		require.NoError(t, os.Unsetenv(KeysEnv))
+		keys, err := LoadKeys("")
+		require.NoError(t, err)
+		require.Nil(t, keys) // a nil interface: no encryption
+	})
+}
+
+func TestEncrypt(t *testing.T) {
+	r, err := ParseKeyRing("k1:" + base64.StdEncoding.EncodeToString([]byte(strings.Repeat("1", 32))))
+	require.NoError(t, err)
+
+	id, data, err := Encrypt(r, []byte("secret"))
+	require.NoError(t, err)
+	require.Equal(t, "k1", id)
+	require.NotContains(t, string(data), "secret")
+
+	_, data2, err := Encrypt(r, []byte("secret"))
+	require.NoError(t, err)
+	require.NotEqual(t, data, data2) // random nonce
+
+	res, err := Decrypt(r, id, data)
+	require.NoError(t, err)
+	require.Equal(t, []byte("secret"), res)
+
+	data[len(data)-1] ^= 1
+	_, err = Decrypt(r, id, data)
+	require.Error(t, err)
+	_, err = Decrypt(r, id, data[:4])
+	require.Error(t, err)
+
+	t.Run("deterministic", func(t *testing.T) {
+		id, data, err := EncryptDeterministic(r, []byte("secret"))
+		require.NoError(t, err)
+		require.Equal(t, "k1", id)
+		require.NotContains(t, string(data), "secret")
+
+		_, data2, err := EncryptDeterministic(r, []byte("secret"))
+		require.NoError(t, err)
+		require.Equal(t, data, data2)
+		_, data3, err := EncryptDeterministic(r, []byte("secret2"))
+		require.NoError(t, err)
+		require.NotEqual(t, data[:12], data3[:12]) // nonce derived from the data
+
+		res, err := Decrypt(r, id, data)
+		require.NoError(t, err)
+		require.Equal(t, []byte("secret"), res)
+	})
+}
@@ -0,0 +1,21 @@
+package ext
+
+import (
+	jsoniter "github.com/json-iterator/go"
+)
+
+// JSON is the Go-side JSON codec: it is compatible with encoding/json, with sorted map keys. See also: JSONNumber
+var JSON = jsoniter.Config{
+	EscapeHTML:             true,
+	SortMapKeys:            true,
+	ValidateJsonRawMessage: true,
+}.Froze()
+
+// JSONNumber is JSON, except that numbers decoded into interface values are json.Number rather than float64, so
+// that large integers keep their precision. The data converter fallbacks use it. See also: JP
+var JSONNumber = jsoniter.Config{
+	EscapeHTML:             true,
+	SortMapKeys:            true,
+	ValidateJsonRawMessage: true,
+	UseNumber:              true,
+}.Froze()
@@ -1,11 +1,15 @@
 package ext
 
 import (
+	"encoding/json"
 	"fmt"
+	"math/big"
 	"strconv"
 	"strings"
 )
 
+// JP returns the value of the given path in the decoded JSON object. Numbers decoded as json.Number, see JSONNumber,
+// are converted to the numeric type T: int, int64, uint64, float64 or *big.Int; integers are never rounded.
 func JP[T any](obj any, path string) (T, error) {
 	// [!] Limited json path support
 	// TODO: [oss] full json path support
@@ -58,9 +62,40 @@ func JP[T any](obj any, path string) (T, error) {
 			res = _res[idx]
 		}
 	}
+	if n, ok := res.(json.Number); ok {
+		if v, err := numberAs[T](n); err != nil {
+			return zeroT, fmt.Errorf("jp: bad-number: %w, path: %s", err, path)
+		} else if v != nil {
+			res = v
+		}
+	}
 	resT, ok := res.(T)
 	if !ok {
 		return zeroT, fmt.Errorf("jp: bad-type: expected: %T, got: %T, path: %s", zeroT, res, path)
 	}
 	return resT, nil
 }
+
+// numberAs converts the number to the numeric type T, or returns nil if T is not numeric.
+func numberAs[T any](n json.Number) (any, error) {
+	var zeroT T
+	switch any(zeroT).(type) {
+	case int:
+		v, err := strconv.ParseInt(n.String(), 10, 0)
+		return int(v), err
+	case int64:
+		return strconv.ParseInt(n.String(), 10, 64)
+	case uint64:
+		return strconv.ParseUint(n.String(), 10, 64)
+	case float64:
+		return n.Float64()
+	case *big.Int:
+		v, ok := new(big.Int).SetString(n.String(), 10)
+		if !ok {
+			return nil, fmt.Errorf("not an integer: %s", n)
+		}
+		return v, nil
+	default:
+		return nil, nil
+	}
+}
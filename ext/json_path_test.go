@@ -1,7 +1,9 @@
 package ext
 
 import (
+	"encoding/json"
 	"github.com/stretchr/testify/require"
+	"math/big"
 	"testing"
 )
 
@@ -63,3 +65,42 @@ func Test_JP(t *testing.T) {
 		require.Equal(t, "quick brown fox", res)
 	})
 }
+
+func Test_JP_Number(t *testing.T) {
+	var data any
+	require.NoError(t, JSONNumber.Unmarshal([]byte(`{"id":9007199254740993,"big":340282366920938463463374607431768211457,"pi":3.14}`), &data))
+
+	t.Run("int", func(t *testing.T) {
+		res, err := JP[int](data, "id")
+		require.NoError(t, err)
+		require.Equal(t, 9007199254740993, res)
+	})
+	t.Run("int64", func(t *testing.T) {
+		res, err := JP[int64](data, "$.id")
+		require.NoError(t, err)
+		require.Equal(t, int64(9007199254740993), res)
+	})
+	t.Run("big-int", func(t *testing.T) {
+		res, err := JP[*big.Int](data, "big")
+		require.NoError(t, err)
+		require.Equal(t, "340282366920938463463374607431768211457", res.String())
+	})
+	t.Run("float", func(t *testing.T) {
+		res, err := JP[float64](data, "pi")
+		require.NoError(t, err)
+		require.Equal(t, 3.14, res)
+	})
+	t.Run("number", func(t *testing.T) {
+		res, err := JP[any](data, "big")
+		require.NoError(t, err)
+		require.Equal(t, json.Number("340282366920938463463374607431768211457"), res)
+	})
+	t.Run("overflow", func(t *testing.T) {
+		_, err := JP[int64](data, "big")
+		require.Error(t, err)
+	})
+	t.Run("not-an-int", func(t *testing.T) {
+		_, err := JP[int](data, "pi")
+		require.Error(t, err)
+	})
+}
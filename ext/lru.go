@@ -0,0 +1,101 @@
+package ext
+
+import (
+	"container/list"
+	"sync"
+)
+
+// LRU is a size-bounded, concurrency-safe least-recently-used cache.
+// The size of an entry is given by the size function; entries are evicted once the total size exceeds maxSize.
+type LRU[K comparable, V any] struct {
+	mu      sync.Mutex
+	maxSize int64
+	sizeOf  func(V) int64
+	size    int64
+	ll      *list.List
+	items   map[K]*list.Element
+	stats   LRUStats
+}
+
+// LRUStats are the cumulative counters of an LRU cache.
+type LRUStats struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64
+}
+
+type lruEntry[K comparable, V any] struct {
+	key  K
+	val  V
+	size int64
+}
+
+func NewLRU[K comparable, V any](maxSize int64, sizeOf func(V) int64) *LRU[K, V] {
+	return &LRU[K, V]{
+		maxSize: maxSize,
+		sizeOf:  sizeOf,
+		ll:      list.New(),
+		items:   map[K]*list.Element{},
+	}
+}
+
+// Get returns the cached value and marks it as recently used.
+func (r *LRU[K, V]) Get(key K) (V, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e, found := r.items[key]; found {
+		r.stats.Hits++
+		r.ll.MoveToFront(e)
+		return e.Value.(*lruEntry[K, V]).val, true
+	}
+	r.stats.Misses++
+	var zero V
+	return zero, false
+}
+
+// Add caches the value, evicting the least recently used entries if needed.
+// A value larger than maxSize is not cached.
+func (r *LRU[K, V]) Add(key K, val V) {
+	size := r.sizeOf(val)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e, found := r.items[key]; found {
+		r.remove(e)
+	}
+	if size > r.maxSize {
+		return
+	}
+	r.items[key] = r.ll.PushFront(&lruEntry[K, V]{key: key, val: val, size: size})
+	r.size += size
+	for r.size > r.maxSize {
+		r.stats.Evictions++
+		r.remove(r.ll.Back())
+	}
+}
+
+// Stats returns the cumulative hit, miss and eviction counters.
+func (r *LRU[K, V]) Stats() LRUStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stats
+}
+
+// Len returns the number of cached entries.
+func (r *LRU[K, V]) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.ll.Len()
+}
+
+// Size returns the total size of cached entries.
+func (r *LRU[K, V]) Size() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.size
+}
+
+func (r *LRU[K, V]) remove(e *list.Element) {
+	entry := r.ll.Remove(e).(*lruEntry[K, V])
+	delete(r.items, entry.key)
+	r.size -= entry.size
+}
@@ -0,0 +1,38 @@
+package ext
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestLRU(t *testing.T) {
+	lru := NewLRU[string, []byte](10, func(v []byte) int64 { return int64(len(v)) })
+
+	lru.Add("a", []byte("aaaa"))
+	lru.Add("b", []byte("bbbb"))
+	require.Equal(t, 2, lru.Len())
+	require.Equal(t, int64(8), lru.Size())
+
+	// "a" becomes the most recently used, so "b" is evicted first
+	v, found := lru.Get("a")
+	require.True(t, found)
+	require.Equal(t, []byte("aaaa"), v)
+
+	lru.Add("c", []byte("cccc"))
+	_, found = lru.Get("b")
+	require.False(t, found)
+	require.Equal(t, 2, lru.Len())
+	require.Equal(t, int64(8), lru.Size())
+
+	// replacing an entry updates the size
+	lru.Add("a", []byte("a"))
+	require.Equal(t, int64(5), lru.Size())
+
+	// values larger than the cache are not cached
+	lru.Add("d", []byte("ddddddddddd"))
+	_, found = lru.Get("d")
+	require.False(t, found)
+	require.Equal(t, 2, lru.Len())
+
+	require.Equal(t, LRUStats{Hits: 1, Misses: 2, Evictions: 1}, lru.Stats())
+}
@@ -8,16 +8,31 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
+	"time"
 )
 
+// WriteTar writes the files as a gzipped tar. The output is reproducible: entries are sorted by path, timestamps
+// and ownership are zeroed and the gzip header is fixed, so the same files always give the same bytes.
 func WriteTar(src map[string][]byte, out io.Writer) error {
+	paths := make([]string, 0, len(src))
+	for path := range src {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
 	gw := gzip.NewWriter(out)
+	gw.Header = gzip.Header{OS: 255} // no name, no mtime, unknown OS
 	tw := tar.NewWriter(gw)
-	for path, body := range src {
+	for _, path := range paths {
+		body := src[path]
 		hdr := &tar.Header{
-			Name: path,
-			Mode: 0600,
-			Size: int64(len(body)),
+			Name:     path,
+			Mode:     0600,
+			Size:     int64(len(body)),
+			ModTime:  time.Unix(0, 0),
+			Typeflag: tar.TypeReg,
+			Format:   tar.FormatPAX,
 		}
 		if err := tw.WriteHeader(hdr); err != nil {
 			return err
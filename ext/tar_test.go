@@ -1,9 +1,13 @@
 package ext
 
 import (
+	"archive/tar"
 	"bytes"
-	"github.com/stretchr/testify/require"
+	"compress/gzip"
+	"io"
 	"testing"
+
+	"github.com/stretchr/testify/require"
 )
 
 func TestTarDir(t *testing.T) {
@@ -49,3 +53,40 @@ def run(a, b):
 	require.NoError(t, err)
 	require.Equal(t, expected, actual)
 }
+
+func TestTarReproducible(t *testing.T) {
+	files := map[string][]byte{}
+	for _, p := range []string{"b.star", "a.star", "lib/c.star", "data/d.json", "z.txt"} {
+		files[p] = []byte(p)
+	}
+
+	var outputs [][]byte
+	for i := 0; i < 5; i++ {
+		buf := bytes.Buffer{}
+		require.NoError(t, WriteTar(files, &buf))
+		outputs = append(outputs, buf.Bytes())
+	}
+	for _, out := range outputs[1:] {
+		require.Equal(t, outputs[0], out)
+	}
+
+	gr, err := gzip.NewReader(bytes.NewReader(outputs[0]))
+	require.NoError(t, err)
+	require.True(t, gr.ModTime.IsZero())
+	require.Empty(t, gr.Name)
+
+	var paths []string
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		require.Equal(t, int64(0), hdr.ModTime.Unix())
+		require.Equal(t, 0, hdr.Uid)
+		require.Equal(t, 0, hdr.Gid)
+		paths = append(paths, hdr.Name)
+	}
+	require.Equal(t, []string{"a.star", "b.star", "data/d.json", "lib/c.star", "z.txt"}, paths)
+}
@@ -1,14 +1,11 @@
 package internal
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"errors"
 	"github.com/cadence-workflow/starlark-worker/encoded"
 	"github.com/cadence-workflow/starlark-worker/ext"
-	"github.com/cadence-workflow/starlark-worker/star"
-	jsoniter "github.com/json-iterator/go"
 	"go.starlark.net/starlark"
 	"go.uber.org/cadence"
 	"go.uber.org/cadence/.gen/go/cadence/workflowserviceclient"
@@ -20,7 +17,6 @@ import (
 	"go.uber.org/yarpc/transport/grpc"
 	"go.uber.org/yarpc/transport/tchannel"
 	"go.uber.org/zap"
-	"io"
 	"log"
 	"net/url"
 	"reflect"
@@ -36,6 +32,31 @@ func (w CadenceWorkflow) IsCanceledError(ctx Context, err error) bool {
 	return errors.As(err, &canceledError)
 }
 
+// IsTimeoutError checks if the error is a TimeoutError, e.g. of an activity or a child workflow.
+func (w CadenceWorkflow) IsTimeoutError(ctx Context, err error) bool {
+	var timeoutError *cad.TimeoutError
+	return errors.As(err, &timeoutError)
+}
+
+// ToWorkflowError returns the error as is: Cadence reports the reason and details of CustomErrors.
+func (w CadenceWorkflow) ToWorkflowError(ctx Context, err error) error {
+	return err
+}
+
+// AsCustomError finds the first CustomError in the error chain.
+func (w CadenceWorkflow) AsCustomError(ctx Context, err error) (CustomError, bool) {
+	var customError *cadence.CustomError
+	if errors.As(err, &customError) {
+		return customError, true
+	}
+	return nil, false
+}
+
+// IsReplaying checks if the workflow is replaying history.
+func (w CadenceWorkflow) IsReplaying(ctx Context) bool {
+	return cad.IsReplaying(ctx.(cad.Context))
+}
+
 // cadenceWorkflowInfo implements IInfo interface
 type cadenceWorkflowInfo struct {
 	context cad.Context
@@ -51,6 +72,16 @@ type cadenceChildWorkflowFuture struct {
 	cf cad.ChildWorkflowFuture
 }
 
+// cadenceReceiveChannel implements ReceiveChannel interface
+type cadenceReceiveChannel struct {
+	c cad.Channel
+}
+
+// cadenceSelector implements Selector interface
+type cadenceSelector struct {
+	s cad.Selector
+}
+
 // cadenceSettable implements Settable interface
 type cadenceSettable struct {
 	s cad.Settable
@@ -127,6 +158,37 @@ func (s *cadenceSettable) Chain(future Future) {
 	s.s.Chain(future.(*cadenceFuture).f)
 }
 
+// Receive blocks until it receives a value from the cadence channel.
+func (c *cadenceReceiveChannel) Receive(ctx Context, valuePtr interface{}) bool {
+	return c.c.Receive(ctx.(cad.Context), valuePtr)
+}
+
+// ReceiveAsync tries to receive a value from the cadence channel without blocking.
+func (c *cadenceReceiveChannel) ReceiveAsync(valuePtr interface{}) bool {
+	return c.c.ReceiveAsync(valuePtr)
+}
+
+// AddReceive registers a callback called once the cadence channel has a value.
+func (s *cadenceSelector) AddReceive(c ReceiveChannel, f func(c ReceiveChannel, more bool)) Selector {
+	s.s.AddReceive(c.(*cadenceReceiveChannel).c, func(_ cad.Channel, more bool) {
+		f(c, more)
+	})
+	return s
+}
+
+// AddDone registers a callback called once the cadence context is canceled.
+func (s *cadenceSelector) AddDone(ctx Context, f func()) Selector {
+	s.s.AddReceive(ctx.(cad.Context).Done(), func(cad.Channel, bool) {
+		f()
+	})
+	return s
+}
+
+// Select blocks until one of the registered callbacks is called.
+func (s *cadenceSelector) Select(ctx Context) {
+	s.s.Select(ctx.(cad.Context))
+}
+
 // Get gets the value of the cadence future.
 func (f *cadenceFuture) Get(ctx Context, valPtr interface{}) error {
 	return f.f.Get(ctx.(cad.Context), valPtr)
@@ -283,6 +345,30 @@ func (w CadenceWorkflow) SetQueryHandler(ctx Context, queryType string, handler
 	return cad.SetQueryHandler(ctx.(cad.Context), queryType, handler)
 }
 
+// GetSignalChannel returns the channel to receive the named signal of the Cadence workflow.
+func (w CadenceWorkflow) GetSignalChannel(ctx Context, signalName string) ReceiveChannel {
+	return &cadenceReceiveChannel{c: cad.GetSignalChannel(ctx.(cad.Context), signalName)}
+}
+
+// NewSelector returns a selector of the Cadence workflow.
+func (w CadenceWorkflow) NewSelector(ctx Context) Selector {
+	return &cadenceSelector{s: cad.NewSelector(ctx.(cad.Context))}
+}
+
+// Err returns the cancellation error of the Cadence workflow context, nil if it is not canceled.
+func (w CadenceWorkflow) Err(ctx Context) error {
+	return ctx.(cad.Context).Err()
+}
+
+// NewContinueAsNewError returns the error that completes the Cadence workflow and starts a new run of the
+// given workflow with the given arguments.
+func (w CadenceWorkflow) NewContinueAsNewError(ctx Context, wfn interface{}, args ...interface{}) error {
+	if reflect.TypeOf(wfn).Kind() == reflect.Func {
+		wfn = WorkflowName(wfn)
+	}
+	return cad.NewContinueAsNewError(ctx.(cad.Context), wfn, args...)
+}
+
 // WithWorkflowDomain sets the workflow domain for the Cadence workflow context.
 func (w CadenceWorkflow) WithWorkflowDomain(ctx Context, name string) Context {
 	return cad.WithWorkflowDomain(ctx.(cad.Context), name)
@@ -370,42 +456,99 @@ func NewInterface(location string) workflowserviceclient.Interface {
 	return workflowserviceclient.New(dispatcher.ClientConfig(service))
 }
 
-const cadenceDelimiter byte = '\n'
-
 // CadenceDataConverter is a Cadence encoded.DataConverter that supports Starlark types, such as starlark.String, starlark.Int and others.
 // Enables passing Starlark values between Cadence workflows and activities.
+//
+// Values are encoded in the payload Format; payloads of formats other than JSON start with the format header byte,
+// so that FromData decodes any format. Encoded values larger than CompressionThreshold are gzip-compressed and
+// marked with a magic prefix. If Keys are provided, payloads, raw bytes included, are then AES-GCM encrypted and
+// marked with a magic prefix and the key ID. If a blob store is provided, payloads larger than BlobThreshold are
+// then offloaded to Blobs, and history keeps the marked blob reference instead; offloaded payloads are encrypted
+// deterministically, so that replays store no new blobs, and all the workers must share Blobs. Payloads that
+// still exceed MaxPayloadSize fail with PayloadTooLargeError before submission. Raw bytes are passed as-is
+// otherwise.
 type CadenceDataConverter struct {
 	Logger *zap.Logger
+	// Format is the payload format of the encoded values. Nil means encoded.DefaultFormat.
+	Format encoded.PayloadFormat
+	// Keys encrypt the payloads. Nil means encoded.DefaultKeys; payloads are not encrypted if both are nil.
+	// Encrypted payloads fail to decode without the key of their ID.
+	Keys encoded.KeyProvider
+	// Blobs stores the offloaded payloads. Nil means encoded.DefaultBlobs; payloads are not offloaded if both
+	// are nil. Offloaded payloads fail to decode without the store.
+	Blobs encoded.BlobStore
+	// BlobThreshold is the payload size (bytes) above which payloads are offloaded to Blobs.
+	// Zero means encoded.DefaultBlobThreshold, a negative value disables offloading.
+	BlobThreshold int
+	// CompressionThreshold is the encoded size (bytes) above which payloads are compressed.
+	// Zero means encoded.DefaultCompressionThreshold, a negative value disables compression.
+	CompressionThreshold int
+	// MaxPayloadSize is the payload size limit (bytes). Zero means encoded.DefaultMaxPayloadSize, a negative
+	// value disables the check.
+	MaxPayloadSize int
 }
 
 // ToData encodes the given values into a byte slice.
 func (s *CadenceDataConverter) ToData(values ...any) ([]byte, error) {
+	threshold, limit := payloadOptions(s.CompressionThreshold, s.MaxPayloadSize)
+	blobs, blobThreshold := payloadBlobs(s.Blobs, s.BlobThreshold)
 	if len(values) == 1 {
+		var raw []byte
 		switch v := values[0].(type) {
 		case []byte:
-			return v, nil
+			raw = v
 		case starlark.Bytes:
-			return []byte(v), nil
+			raw = []byte(v)
 		}
-	}
-	var buf bytes.Buffer
-	for _, v := range values {
-		b, err := star.Encode(v) // try star encoder
-		if _, ok := err.(star.UnsupportedTypeError); ok {
-			b, err = jsoniter.Marshal(v) // go encoder fallback
-		}
-		if err != nil {
-			s.Logger.Error("encode-error", ext.ZapError(err)...)
-			return nil, err
+		if raw != nil {
+			data, err := encryptCadence(payloadKeys(s.Keys), raw, offloading(blobs, blobThreshold))
+			if err != nil {
+				return nil, err
+			}
+			if data, err = offloadCadence(blobs, blobThreshold, data); err != nil {
+				return nil, err
+			}
+			return data, checkPayloadSize(len(data), len(raw), limit)
 		}
-		buf.Write(b)
-		buf.WriteByte(cadenceDelimiter)
 	}
-	return buf.Bytes(), nil
+	format := payloadFormat(s.Format)
+	b, err := format.Encode(values)
+	if err != nil {
+		s.Logger.Error("encode-error", ext.ZapError(err)...)
+		return nil, err
+	}
+	if h := format.Header(); h != 0 {
+		b = append([]byte{h}, b...)
+	}
+	data, compressed, err := compress(b, threshold)
+	if err != nil {
+		return nil, err
+	}
+	if compressed {
+		data = append([]byte(cadenceGzipPrefix), data...)
+	}
+	if data, err = encryptCadence(payloadKeys(s.Keys), data, offloading(blobs, blobThreshold)); err != nil {
+		return nil, err
+	}
+	if data, err = offloadCadence(blobs, blobThreshold, data); err != nil {
+		return nil, err
+	}
+	if err := checkPayloadSize(len(data), len(b), limit); err != nil {
+		return nil, err
+	}
+	return data, nil
 }
 
 // FromData decodes the given byte slice into the specified values.
 func (s *CadenceDataConverter) FromData(data []byte, to ...any) error {
+	blobs, _ := payloadBlobs(s.Blobs, s.BlobThreshold)
+	data, err := resolveCadence(blobs, data)
+	if err != nil {
+		return err
+	}
+	if data, err = decryptCadence(payloadKeys(s.Keys), data); err != nil {
+		return err
+	}
 	if len(to) == 1 {
 		switch to := to[0].(type) {
 		case *[]byte:
@@ -416,40 +559,56 @@ func (s *CadenceDataConverter) FromData(data []byte, to ...any) error {
 			return nil
 		}
 	}
-	r := bufio.NewReader(bytes.NewReader(data))
-
-	for i := 0; ; i++ {
-		line, err := r.ReadBytes(cadenceDelimiter)
-		var eof bool
-		if err == io.EOF {
-			eof = true
-			err = nil
-		}
-		if err != nil {
-			s.Logger.Error("decode-error", ext.ZapError(err)...)
+	if bytes.HasPrefix(data, []byte(cadenceGzipPrefix)) {
+		if data, err = decompress(data[len(cadenceGzipPrefix):]); err != nil {
 			return err
 		}
-		ll := len(line)
-		if eof && ll == 0 {
-			break
-		}
-		if line[ll-1] == cadenceDelimiter {
-			line = line[:ll-1]
-		}
-		out := to[i]
+	}
+	format := encoded.FormatByHeader(data)
+	if format.Header() != 0 {
+		data = data[1:]
+	}
+	if err := format.Decode(data, to); err != nil {
+		s.Logger.Error("decode-error", ext.ZapError(err)...)
+		return err
+	}
+	return nil
+}
 
-		// First try to decode the value using Starlark decoder, and if it fails, fall back to JSON decoder.
-		err = star.Decode(line, out)
-		if _, ok := err.(star.UnsupportedTypeError); ok {
-			err = jsoniter.Unmarshal(line, out)
-		}
-		if err != nil {
-			s.Logger.Error("decode-error", ext.ZapError(err)...)
-			return err
-		}
-		if eof {
-			break
+// ToString decodes the payload into a human-readable string: decrypted, decompressed and rendered as indented
+// JSON. Payloads that do not decode, e.g. raw bytes or payloads without the key of their ID, are returned as-is.
+// Offloaded payloads are fetched from the blob store.
+func (s *CadenceDataConverter) ToString(data []byte) string {
+	blobs, _ := payloadBlobs(s.Blobs, s.BlobThreshold)
+	b, err := resolveCadence(blobs, data)
+	if err != nil {
+		return string(data)
+	}
+	if b, err = decryptCadence(payloadKeys(s.Keys), b); err != nil {
+		return string(data)
+	}
+	if bytes.HasPrefix(b, []byte(cadenceGzipPrefix)) {
+		if b, err = decompress(b[len(cadenceGzipPrefix):]); err != nil {
+			return string(data)
 		}
 	}
-	return nil
+	format := encoded.FormatByHeader(b)
+	if format.Header() != 0 {
+		b = b[1:]
+	}
+	return payloadString(format, b)
+}
+
+// ReleaseBlobs releases the blob the payload references, if it is an offloaded payload: the cleanup hook of
+// payloads that are no longer needed, e.g. of histories past retention.
+func (s *CadenceDataConverter) ReleaseBlobs(ctx context.Context, data []byte) error {
+	ref, ok := cadenceBlobRef(data)
+	if !ok {
+		return nil
+	}
+	blobs, _ := payloadBlobs(s.Blobs, s.BlobThreshold)
+	if blobs == nil {
+		return errNoBlobStore
+	}
+	return blobs.Release(ctx, ref)
 }
@@ -1,8 +1,16 @@
 package internal
 
 import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"math/rand"
+	"os"
+	"strings"
 	"testing"
 
+	starencoded "github.com/cadence-workflow/starlark-worker/encoded"
 	"github.com/stretchr/testify/require"
 	"go.starlark.net/starlark"
 	"go.uber.org/cadence/encoded"
@@ -49,6 +57,20 @@ func TestCadenceToData(t *testing.T) {
 		require.NoError(t, err)
 		require.Equal(t, []byte("[\"pi\",3.14]\ntrue\n"), data)
 	})
+
+	t.Run("encode-star-typed", func(t *testing.T) {
+		// Assert nested tuples are plain JSON lists unless the typed encoding is enabled.
+		v := starlark.NewList([]starlark.Value{starlark.Tuple{starlark.MakeInt(1)}})
+		data, err := converter.ToData(v)
+		require.NoError(t, err)
+		require.Equal(t, []byte("[[1]]\n"), data)
+
+		starencoded.TypedStarlarkValues = true
+		t.Cleanup(func() { starencoded.TypedStarlarkValues = false })
+		data, err = converter.ToData(v)
+		require.NoError(t, err)
+		require.Equal(t, []byte("[{\"__codec__\":\"tuple\",\"__codec_version__\":1,\"items\":[1]}]\n"), data)
+	})
 }
 
 // TestFromData tests that the converter can decode bytes into Go and Starlark values.
@@ -101,9 +123,269 @@ func TestCadenceFromData(t *testing.T) {
 		var out starlark.String
 		require.Error(t, converter.FromData([]byte("true\n"), &out))
 	})
+	t.Run("decode-big-int", func(t *testing.T) {
+		// Assert large integers keep their precision in both Starlark and Go values.
+		data := []byte("[18446744073709551617,340282366920938463463374607431768211455]\n")
+
+		var out1 starlark.Value
+		require.NoError(t, converter.FromData(data, &out1))
+		require.Equal(t, "[18446744073709551617, 340282366920938463463374607431768211455]", out1.String())
+
+		var out2 any
+		require.NoError(t, converter.FromData(data, &out2))
+		require.Equal(t, []any{json.Number("18446744073709551617"), json.Number("340282366920938463463374607431768211455")}, out2)
+
+		var out3 struct {
+			ID uint64 `json:"id"`
+		}
+		require.NoError(t, converter.FromData([]byte("{\"id\":18446744073709551615}\n"), &out3))
+		require.Equal(t, uint64(18446744073709551615), out3.ID)
+	})
 }
 
 func newCadenceTestConverter(t *testing.T) encoded.DataConverter {
 	logger := zaptest.NewLogger(t, zaptest.Level(zap.InfoLevel))
 	return &CadenceDataConverter{Logger: logger}
 }
+
+// TestCadencePayloadCompression tests that large payloads are compressed and size-checked.
+func TestCadencePayloadCompression(t *testing.T) {
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.InfoLevel))
+	converter := &CadenceDataConverter{Logger: logger, CompressionThreshold: 100, MaxPayloadSize: 1000}
+	large := starlark.String(strings.Repeat("abc", 1000))
+
+	t.Run("small-as-is", func(t *testing.T) {
+		data, err := converter.ToData(starlark.String("abc"))
+		require.NoError(t, err)
+		require.Equal(t, []byte("\"abc\"\n"), data)
+	})
+
+	t.Run("disabled-by-default", func(t *testing.T) {
+		// Assert the encoder neither compresses nor size-checks payloads unless enabled.
+		data, err := (&CadenceDataConverter{Logger: logger}).ToData(large)
+		require.NoError(t, err)
+		require.Equal(t, byte('"'), data[0])
+	})
+
+	t.Run("large-round-trip", func(t *testing.T) {
+		// Assert the encoder compresses large payloads and marks them with the magic prefix.
+		data, err := converter.ToData(large, true)
+		require.NoError(t, err)
+		require.True(t, bytes.HasPrefix(data, []byte(cadenceGzipPrefix)))
+		require.Less(t, len(data), len(large))
+
+		var out1 starlark.String
+		var out2 bool
+		require.NoError(t, converter.FromData(data, &out1, &out2))
+		require.Equal(t, large, out1)
+		require.True(t, out2)
+	})
+
+	t.Run("too-large", func(t *testing.T) {
+		// Assert the encoder fails when the payload exceeds the limit even after compression.
+		rnd := make([]byte, 2000)
+		_, _ = rand.New(rand.NewSource(1)).Read(rnd)
+		_, err := converter.ToData(starlark.String(hex.EncodeToString(rnd)))
+		var tooLarge PayloadTooLargeError
+		require.ErrorAs(t, err, &tooLarge)
+		require.Equal(t, 1000, tooLarge.Limit)
+		require.Equal(t, 4003, tooLarge.RawSize)
+
+		_, err = converter.ToData(make([]byte, 1001))
+		require.ErrorAs(t, err, &tooLarge)
+	})
+}
+
+// TestCadencePayloadFormat tests that MessagePack payloads are marked with the header byte and auto-detected.
+func TestCadencePayloadFormat(t *testing.T) {
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.InfoLevel))
+	msgpack := &CadenceDataConverter{Logger: logger, Format: starencoded.MsgPack, CompressionThreshold: 100}
+	converter := &CadenceDataConverter{Logger: logger}
+
+	dict := starlark.NewDict(1)
+	require.NoError(t, dict.SetKey(starlark.MakeInt(1), starlark.Tuple{starlark.String("pi"), starlark.Float(3.14)}))
+
+	t.Run("round-trip", func(t *testing.T) {
+		data, err := msgpack.ToData(dict, CadenceTestStruct{ID: 101}, starlark.MakeUint64(18446744073709551615))
+		require.NoError(t, err)
+		require.Equal(t, byte(0x01), data[0])
+
+		// Assert the default (JSON) converter detects the format.
+		var out1 starlark.Value
+		var out2 CadenceTestStruct
+		var out3 starlark.Int
+		require.NoError(t, converter.FromData(data, &out1, &out2, &out3))
+		require.Equal(t, `{"1": ["pi", 3.14]}`, out1.String())
+		require.Equal(t, CadenceTestStruct{ID: 101}, out2)
+		require.Equal(t, "18446744073709551615", out3.String())
+	})
+
+	t.Run("compressed", func(t *testing.T) {
+		large := starlark.String(strings.Repeat("abc", 1000))
+		data, err := msgpack.ToData(large)
+		require.NoError(t, err)
+		require.True(t, bytes.HasPrefix(data, []byte(cadenceGzipPrefix)))
+
+		var out starlark.String
+		require.NoError(t, converter.FromData(data, &out))
+		require.Equal(t, large, out)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		// Assert the MessagePack converter decodes JSON payloads of the existing histories.
+		var out starlark.Tuple
+		require.NoError(t, msgpack.FromData([]byte("[\"pi\",3.14]\n"), &out))
+		require.Equal(t, starlark.Tuple{starlark.String("pi"), starlark.Float(3.14)}, out)
+	})
+}
+
+func TestCadencePayloadEncryption(t *testing.T) {
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.InfoLevel))
+	oldKeys, err := starencoded.ParseKeyRing("k1:" + strings.Repeat("A", 43) + "=")
+	require.NoError(t, err)
+	keys, err := starencoded.ParseKeyRing("k2:" + strings.Repeat("B", 43) + "=\nk1:" + strings.Repeat("A", 43) + "=")
+	require.NoError(t, err)
+	converter := &CadenceDataConverter{Logger: logger, Keys: keys, CompressionThreshold: 100}
+
+	t.Run("round-trip", func(t *testing.T) {
+		data, err := converter.ToData(starlark.String("secret"), CadenceTestStruct{ID: 101})
+		require.NoError(t, err)
+		require.True(t, bytes.HasPrefix(data, []byte(cadenceEncryptedPrefix+"\x02k2")))
+		require.NotContains(t, string(data), "secret")
+
+		var out1 starlark.String
+		var out2 CadenceTestStruct
+		require.NoError(t, converter.FromData(data, &out1, &out2))
+		require.Equal(t, starlark.String("secret"), out1)
+		require.Equal(t, CadenceTestStruct{ID: 101}, out2)
+		require.Equal(t, "\"secret\"\n{\n  \"id\": 101\n}", converter.ToString(data))
+	})
+
+	t.Run("compressed", func(t *testing.T) {
+		large := starlark.String(strings.Repeat("abc", 1000))
+		data, err := converter.ToData(large)
+		require.NoError(t, err)
+		require.Less(t, len(data), 1000)
+
+		var out starlark.String
+		require.NoError(t, converter.FromData(data, &out))
+		require.Equal(t, large, out)
+	})
+
+	t.Run("raw-bytes", func(t *testing.T) {
+		data, err := converter.ToData([]byte("raw"))
+		require.NoError(t, err)
+		require.True(t, bytes.HasPrefix(data, []byte(cadenceEncryptedPrefix)))
+
+		var out []byte
+		require.NoError(t, converter.FromData(data, &out))
+		require.Equal(t, []byte("raw"), out)
+	})
+
+	t.Run("rotation", func(t *testing.T) {
+		// Assert payloads of the previous key decode after the rotation.
+		data, err := (&CadenceDataConverter{Logger: logger, Keys: oldKeys}).ToData(starlark.MakeInt(42))
+		require.NoError(t, err)
+		var out starlark.Int
+		require.NoError(t, converter.FromData(data, &out))
+		require.Equal(t, starlark.MakeInt(42), out)
+	})
+
+	t.Run("no-keys", func(t *testing.T) {
+		data, err := converter.ToData(starlark.MakeInt(42))
+		require.NoError(t, err)
+		var out starlark.Int
+		require.ErrorIs(t, (&CadenceDataConverter{Logger: logger}).FromData(data, &out), errNoPayloadKeys)
+		require.Error(t, (&CadenceDataConverter{Logger: logger, Keys: oldKeys}).FromData(data, &out))
+		require.Equal(t, string(data), (&CadenceDataConverter{Logger: logger}).ToString(data))
+	})
+}
+
+func TestCadencePayloadOffloading(t *testing.T) {
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.InfoLevel))
+	store := &starencoded.LocalBlobStore{Dir: t.TempDir()}
+	converter := &CadenceDataConverter{Logger: logger, Blobs: store, BlobThreshold: 100, CompressionThreshold: -1}
+
+	large := starlark.String(strings.Repeat("abc", 1000))
+
+	t.Run("round-trip", func(t *testing.T) {
+		data, err := converter.ToData(large)
+		require.NoError(t, err)
+		ref, ok := cadenceBlobRef(data)
+		require.True(t, ok)
+		require.Equal(t, len(cadenceBlobPrefix)+71, len(data))
+
+		var out starlark.String
+		require.NoError(t, converter.FromData(data, &out))
+		require.Equal(t, large, out)
+		require.Equal(t, `"`+string(large)+`"`, converter.ToString(data))
+
+		// Assert the blob is deleted once the last reference is released.
+		_, err = converter.ToData(large)
+		require.NoError(t, err)
+		require.NoError(t, converter.ReleaseBlobs(context.Background(), data))
+		_, err = store.Get(context.Background(), ref)
+		require.NoError(t, err)
+		require.NoError(t, converter.ReleaseBlobs(context.Background(), data))
+		_, err = store.Get(context.Background(), ref)
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("small", func(t *testing.T) {
+		data, err := converter.ToData(starlark.String("small"))
+		require.NoError(t, err)
+		require.Equal(t, "\"small\"\n", string(data))
+	})
+
+	t.Run("raw-bytes", func(t *testing.T) {
+		raw := bytes.Repeat([]byte{0xff}, 1000)
+		data, err := converter.ToData(raw)
+		require.NoError(t, err)
+		require.True(t, bytes.HasPrefix(data, []byte(cadenceBlobPrefix)))
+
+		var out []byte
+		require.NoError(t, converter.FromData(data, &out))
+		require.Equal(t, raw, out)
+	})
+
+	t.Run("encrypted", func(t *testing.T) {
+		keys, err := starencoded.ParseKeyRing("k1:" + strings.Repeat("A", 43) + "=")
+		require.NoError(t, err)
+		converter := &CadenceDataConverter{Logger: logger, Keys: keys, Blobs: store, BlobThreshold: 100}
+		data, err := converter.ToData(large, starlark.MakeInt(1))
+		require.NoError(t, err)
+		ref, ok := cadenceBlobRef(data)
+		require.True(t, ok)
+
+		// Assert the stored blob is encrypted.
+		blob, err := store.Get(context.Background(), ref)
+		require.NoError(t, err)
+		require.True(t, bytes.HasPrefix(blob, []byte(cadenceEncryptedPrefix)))
+
+		// Assert encoding the value again, e.g. on replay, stores no new blob.
+		data2, err := converter.ToData(large, starlark.MakeInt(1))
+		require.NoError(t, err)
+		require.Equal(t, data, data2)
+
+		var out1 starlark.String
+		var out2 starlark.Int
+		require.NoError(t, converter.FromData(data, &out1, &out2))
+		require.Equal(t, large, out1)
+		require.Equal(t, starlark.MakeInt(1), out2)
+
+		// Assert each encoding holds a reference to the same blob.
+		require.NoError(t, converter.ReleaseBlobs(context.Background(), data))
+		_, err = store.Get(context.Background(), ref)
+		require.NoError(t, err)
+		require.NoError(t, converter.ReleaseBlobs(context.Background(), data2))
+		_, err = store.Get(context.Background(), ref)
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("no-store", func(t *testing.T) {
+		data, err := converter.ToData(large)
+		require.NoError(t, err)
+		var out starlark.String
+		require.ErrorIs(t, (&CadenceDataConverter{Logger: logger}).FromData(data, &out), errNoBlobStore)
+	})
+}
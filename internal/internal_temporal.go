@@ -1,15 +1,10 @@
 package internal
 
 import (
-	"bufio"
-	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"github.com/cadence-workflow/starlark-worker/encoded"
 	"github.com/cadence-workflow/starlark-worker/ext"
-	"github.com/cadence-workflow/starlark-worker/star"
-	jsoniter "github.com/json-iterator/go"
 	"go.starlark.net/starlark"
 	commonpb "go.temporal.io/api/common/v1"
 	enumspb "go.temporal.io/api/enums/v1"
@@ -22,6 +17,8 @@ import (
 	"go.uber.org/zap"
 	"io"
 	"reflect"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -29,7 +26,11 @@ import (
 var _ Workflow = (*TemporalWorkflow)(nil)
 
 // TemporalWorkflow is a wrapper around the Temporal SDK workflow interface.
-type TemporalWorkflow struct{}
+type TemporalWorkflow struct {
+	// DataConverter is the data converter of the worker the workflows run on: query arguments and results are
+	// encoded with it, as the other payloads. Nil means a TemporalDataConverter with the default options.
+	DataConverter converter.DataConverter
+}
 
 // WithRetryPolicy sets the retry policy for the workflow execution.
 func (w TemporalWorkflow) WithRetryPolicy(ctx Context, retryPolicy RetryPolicy) Context {
@@ -49,6 +50,40 @@ func (w TemporalWorkflow) IsCanceledError(ctx Context, err error) bool {
 	return errors.As(err, &canceledError)
 }
 
+// IsTimeoutError checks if the error is a TimeoutError, e.g. of an activity or a child workflow.
+func (w TemporalWorkflow) IsTimeoutError(ctx Context, err error) bool {
+	var timeoutError *temporal.TimeoutError
+	return errors.As(err, &timeoutError)
+}
+
+// ToWorkflowError unwraps the application error of a TemporalCustomError: Temporal reports the type and details
+// of *temporal.ApplicationError failures only, other errors fail with the Go type name.
+func (w TemporalWorkflow) ToWorkflowError(ctx Context, err error) error {
+	if customErr, ok := err.(*TemporalCustomError); ok {
+		return &customErr.ApplicationError
+	}
+	return err
+}
+
+// AsCustomError finds the first CustomError in the error chain. Application errors, e.g. of failed activities,
+// are custom errors. The reason of the result is the application error type: the reason NewCustomError was given.
+func (w TemporalWorkflow) AsCustomError(ctx Context, err error) (CustomError, bool) {
+	var customError *TemporalCustomError
+	if errors.As(err, &customError) {
+		return temporalApplicationError{customError}, true
+	}
+	var applicationError *temporal.ApplicationError
+	if errors.As(err, &applicationError) {
+		return temporalApplicationError{&TemporalCustomError{ApplicationError: *applicationError}}, true
+	}
+	return nil, false
+}
+
+// IsReplaying checks if the workflow is replaying history.
+func (w TemporalWorkflow) IsReplaying(ctx Context) bool {
+	return temp.IsReplaying(ctx.(temp.Context))
+}
+
 // temporalWorkflowInfo is a wrapper around the Temporal SDK workflow context.
 type tempWorkflowInfo struct {
 	context temp.Context
@@ -64,6 +99,16 @@ type temporalChildWorkflowFuture struct {
 	cf temp.ChildWorkflowFuture
 }
 
+// temporalReceiveChannel is a wrapper around the Temporal SDK receive channel interface.
+type temporalReceiveChannel struct {
+	c temp.ReceiveChannel
+}
+
+// temporalSelector is a wrapper around the Temporal SDK selector interface.
+type temporalSelector struct {
+	s temp.Selector
+}
+
 // temporalSettable is a wrapper around the Temporal SDK settable interface.
 type temporalSettable struct {
 	s temp.Settable
@@ -84,6 +129,37 @@ func (f *temporalFuture) IsReady() bool {
 	return f.f.IsReady()
 }
 
+// Receive blocks until it receives a value from the channel.
+func (c *temporalReceiveChannel) Receive(ctx Context, valuePtr interface{}) bool {
+	return c.c.Receive(ctx.(temp.Context), valuePtr)
+}
+
+// ReceiveAsync tries to receive a value from the channel without blocking.
+func (c *temporalReceiveChannel) ReceiveAsync(valuePtr interface{}) bool {
+	return c.c.ReceiveAsync(valuePtr)
+}
+
+// AddReceive registers a callback called once the Temporal channel has a value.
+func (s *temporalSelector) AddReceive(c ReceiveChannel, f func(c ReceiveChannel, more bool)) Selector {
+	s.s.AddReceive(c.(*temporalReceiveChannel).c, func(_ temp.ReceiveChannel, more bool) {
+		f(c, more)
+	})
+	return s
+}
+
+// AddDone registers a callback called once the Temporal context is canceled.
+func (s *temporalSelector) AddDone(ctx Context, f func()) Selector {
+	s.s.AddReceive(ctx.(temp.Context).Done(), func(temp.ReceiveChannel, bool) {
+		f()
+	})
+	return s
+}
+
+// Select blocks until one of the registered callbacks is called.
+func (s *temporalSelector) Select(ctx Context) {
+	s.s.Select(ctx.(temp.Context))
+}
+
 // RegisterWorkflow registers a workflow with the Temporal worker.
 func (tw *TemporalWorker) RegisterWorkflow(wf interface{}) {
 	wrappedWf, funcName := UpdateWorkflowFunctionContextArgument(wf, reflect.TypeOf((*temp.Context)(nil)).Elem())
@@ -307,8 +383,38 @@ func convertCadenceToTemporalReusePolicy(cadenceVal int) enumspb.WorkflowIdReuse
 	}
 }
 
+// SetQueryHandler sets a query handler for the Temporal workflow. As on Cadence, handler arguments missing from
+// the query are left as zero values, so that handlers may take optional arguments.
 func (w TemporalWorkflow) SetQueryHandler(ctx Context, queryType string, handler interface{}) error {
-	return temp.SetQueryHandler(ctx.(temp.Context), queryType, handler)
+	qctx := temp.WithDataConverter(ctx.(temp.Context), w.queryConverter())
+	return temp.SetQueryHandler(qctx, queryType, handler)
+}
+
+// queryConverter wraps the worker's data converter, see temporalQueryConverter.
+func (w TemporalWorkflow) queryConverter() temporalQueryConverter {
+	if w.DataConverter == nil {
+		return temporalQueryConverter{TemporalDataConverter{Logger: zap.NewNop()}}
+	}
+	return temporalQueryConverter{w.DataConverter}
+}
+
+func (w TemporalWorkflow) GetSignalChannel(ctx Context, signalName string) ReceiveChannel {
+	return &temporalReceiveChannel{c: temp.GetSignalChannel(ctx.(temp.Context), signalName)}
+}
+
+func (w TemporalWorkflow) NewSelector(ctx Context) Selector {
+	return &temporalSelector{s: temp.NewSelector(ctx.(temp.Context))}
+}
+
+func (w TemporalWorkflow) Err(ctx Context) error {
+	return ctx.(temp.Context).Err()
+}
+
+func (w TemporalWorkflow) NewContinueAsNewError(ctx Context, wfn interface{}, args ...interface{}) error {
+	if reflect.TypeOf(wfn).Kind() == reflect.Func {
+		wfn = WorkflowName(wfn)
+	}
+	return temp.NewContinueAsNewError(ctx.(temp.Context), wfn, args...)
 }
 
 func (w TemporalWorkflow) WithWorkflowDomain(ctx Context, name string) Context {
@@ -389,12 +495,36 @@ func (l *ZapLoggerAdapter) Zap() *zap.Logger {
 	return l.zapLogger
 }
 
-const temporalDelimiter byte = '\n'
-
 // TemporalDataConverter is a Temporal TemporalDataConverter that supports Starlark types.
 // Enables passing Starlark values between Temporal workflows and activities.
+//
+// Values are encoded in the payload Format, named by the "encoding" metadata of payloads other than JSON, so that
+// FromPayload decodes any format. Encoded values larger than CompressionThreshold are gzip-compressed and marked
+// with the "<format>/gzip" encoding metadata, e.g. "json/gzip"; payloads that still exceed MaxPayloadSize fail
+// with PayloadTooLargeError before submission. If Keys are provided, payload data, raw bytes included, is then
+// AES-GCM encrypted, and the key ID is recorded in the "encryption-key-id" metadata. If a blob store is provided,
+// payload data larger than BlobThreshold is then offloaded to Blobs, and the payload keeps the "blob-ref"
+// metadata instead; offloaded payloads are encrypted deterministically, so that replays store no new blobs, and
+// all the workers must share Blobs. Raw bytes are passed as-is otherwise.
 type TemporalDataConverter struct {
 	Logger *zap.Logger
+	// Format is the payload format of the encoded values. Nil means encoded.DefaultFormat.
+	Format encoded.PayloadFormat
+	// Keys encrypt the payloads. Nil means encoded.DefaultKeys; payloads are not encrypted if both are nil.
+	// Encrypted payloads fail to decode without the key of their ID.
+	Keys encoded.KeyProvider
+	// Blobs stores the offloaded payloads. Nil means encoded.DefaultBlobs; payloads are not offloaded if both
+	// are nil. Offloaded payloads fail to decode without the store.
+	Blobs encoded.BlobStore
+	// BlobThreshold is the payload data size (bytes) above which payloads are offloaded to Blobs.
+	// Zero means encoded.DefaultBlobThreshold, a negative value disables offloading.
+	BlobThreshold int
+	// CompressionThreshold is the encoded size (bytes) above which payloads are compressed.
+	// Zero means encoded.DefaultCompressionThreshold, a negative value disables compression.
+	CompressionThreshold int
+	// MaxPayloadSize is the total payload size limit (bytes). Zero means encoded.DefaultMaxPayloadSize, a negative
+	// value disables the check.
+	MaxPayloadSize int
 }
 
 var _ converter.DataConverter = (*TemporalDataConverter)(nil)
@@ -409,47 +539,56 @@ func (s TemporalDataConverter) ToStrings(payloads *commonpb.Payloads) []string {
 }
 
 // ToString converts a single Payload to a human-readable string.
+// Offloaded payloads are fetched from the blob store, encrypted payloads are decrypted; payloads are rendered
+// as-is without the store or the key of their ID.
 func (s TemporalDataConverter) ToString(payload *commonpb.Payload) string {
-	// Attempt to deserialize the payload data into a generic interface
-	var data interface{}
-	if err := json.Unmarshal(payload.GetData(), &data); err != nil {
-		// If deserialization fails, return the raw data as a string
-		return string(payload.GetData())
-	}
-	// Convert the deserialized data to a pretty-printed JSON string
-	readableStr, err := json.MarshalIndent(data, "", "  ")
+	raw, format, err := payloadData(s.blobs(), payloadKeys(s.Keys), payload)
 	if err != nil {
-		// If pretty-printing fails, return the raw data as a string
 		return string(payload.GetData())
 	}
-	return string(readableStr)
+	return payloadString(format, raw)
 }
 
 // ToPayloads converts input values to Temporal's Payloads format
 func (s TemporalDataConverter) ToPayloads(values ...interface{}) (*commonpb.Payloads, error) {
+	_, limit := payloadOptions(s.CompressionThreshold, s.MaxPayloadSize)
 	if len(values) == 1 {
+		var raw []byte
 		switch v := values[0].(type) {
 		case *[]byte:
-			return &commonpb.Payloads{
-				Payloads: []*commonpb.Payload{
-					{Data: *v},
-				},
-			}, nil
+			raw = *v
 		case *starlark.Bytes:
+			raw = []byte(*v)
+		}
+		if raw != nil {
+			payload, err := encryptTemporal(payloadKeys(s.Keys), &commonpb.Payload{Data: raw}, offloading(payloadBlobs(s.Blobs, s.BlobThreshold)))
+			if err != nil {
+				return nil, err
+			}
+			if payload, err = s.offload(payload); err != nil {
+				return nil, err
+			}
+			if err := checkPayloadSize(len(payload.Data), len(raw), limit); err != nil {
+				return nil, err
+			}
 			return &commonpb.Payloads{
-				Payloads: []*commonpb.Payload{
-					{Data: []byte(*v)},
-				},
+				Payloads: []*commonpb.Payload{payload},
 			}, nil
 		}
 	}
 	payloads := &commonpb.Payloads{}
+	var size, rawSize int
 	for _, v := range values {
 		payload, err := s.ToPayload(v)
 		if err != nil {
 			return nil, err
 		}
 		payloads.Payloads = append(payloads.Payloads, payload)
+		size += len(payload.Data)
+		rawSize += payloadRawSize(payload)
+	}
+	if err := checkPayloadSize(size, rawSize, limit); err != nil {
+		return nil, err
 	}
 	return payloads, nil
 }
@@ -468,44 +607,174 @@ func (s TemporalDataConverter) FromPayloads(payloads *commonpb.Payloads, to ...i
 	return nil
 }
 
+// temporalQueryConverter decodes query handler arguments: trailing arguments without a matching payload are
+// left as zero values instead of failing with io.EOF.
+type temporalQueryConverter struct {
+	converter.DataConverter
+}
+
+func (s temporalQueryConverter) FromPayloads(payloads *commonpb.Payloads, to ...interface{}) error {
+	if n := len(payloads.GetPayloads()); n < len(to) {
+		to = to[:n]
+	}
+	return s.DataConverter.FromPayloads(payloads, to...)
+}
+
 // ToPayload converts a single Go value to a Temporal Payload
 func (s TemporalDataConverter) ToPayload(value interface{}) (*commonpb.Payload, error) {
-	var buf bytes.Buffer
-	b, err := star.Encode(value) // Try star encoder first
-	if _, ok := err.(star.UnsupportedTypeError); ok {
-		b, err = jsoniter.Marshal(value) // Fallback to Go JSON encoder
-	}
+	format := payloadFormat(s.Format)
+	b, err := format.Encode([]any{value})
 	if err != nil {
 		s.Logger.Error("encode-error", ext.ZapError(err)...)
 		return nil, err
 	}
-	buf.Write(b)
-	buf.WriteByte(temporalDelimiter)
-	return &commonpb.Payload{Data: buf.Bytes()}, nil
+
+	threshold, limit := payloadOptions(s.CompressionThreshold, s.MaxPayloadSize)
+	data, compressed, err := compress(b, threshold)
+	if err != nil {
+		return nil, err
+	}
+	payload := &commonpb.Payload{Data: data}
+	if compressed {
+		payload.Metadata = map[string][]byte{
+			temporalMetadataEncoding: []byte(format.Name() + temporalGzipSuffix),
+			temporalMetadataRawSize:  []byte(strconv.Itoa(len(b))),
+		}
+	} else if format != encoded.JSON {
+		payload.Metadata = map[string][]byte{
+			temporalMetadataEncoding: []byte(format.Name()),
+		}
+	}
+	if payload, err = encryptTemporal(payloadKeys(s.Keys), payload, offloading(payloadBlobs(s.Blobs, s.BlobThreshold))); err != nil {
+		return nil, err
+	}
+	if payload, err = s.offload(payload); err != nil {
+		return nil, err
+	}
+	if err := checkPayloadSize(len(payload.Data), len(b), limit); err != nil {
+		return nil, err
+	}
+	return payload, nil
 }
 
-// FromPayload converts a single Temporal Payload back to a Go value
-func (s TemporalDataConverter) FromPayload(payload *commonpb.Payload, to interface{}) error {
-	r := bufio.NewReader(bytes.NewReader(payload.Data))
-	line, err := r.ReadBytes(temporalDelimiter)
-	if err != nil && err != io.EOF {
-		s.Logger.Error("decode-error", ext.ZapError(err)...)
-		return err
+// blobs returns the blob store offloaded payloads are fetched from.
+func (s TemporalDataConverter) blobs() encoded.BlobStore {
+	store, _ := payloadBlobs(s.Blobs, s.BlobThreshold)
+	return store
+}
+
+// encryptTemporal encrypts the payload data if keys are provided and records the key ID in the metadata.
+// Returns the payload as-is otherwise. Deterministic encryption keeps offloaded payloads content-addressed.
+func encryptTemporal(keys encoded.KeyProvider, payload *commonpb.Payload, deterministic bool) (*commonpb.Payload, error) {
+	if keys == nil {
+		return payload, nil
 	}
-	if len(line) > 0 && line[len(line)-1] == temporalDelimiter {
-		line = line[:len(line)-1]
+	id, data, err := encrypt(keys, payload.Data, deterministic)
+	if err != nil {
+		return nil, err
+	}
+	if payload.Metadata == nil {
+		payload.Metadata = map[string][]byte{}
 	}
+	payload.Metadata[temporalMetadataKeyID] = []byte(id)
+	payload.Data = data
+	return payload, nil
+}
 
-	if err != nil && err != io.EOF {
-		s.Logger.Error("decode-error", ext.ZapError(err)...)
-		return err
+// offload stores the payload data in the blob store if it is larger than the threshold and records the blob
+// reference in the metadata. Returns the payload as-is otherwise.
+func (s TemporalDataConverter) offload(payload *commonpb.Payload) (*commonpb.Payload, error) {
+	store, threshold := payloadBlobs(s.Blobs, s.BlobThreshold)
+	if store == nil || threshold < 0 || len(payload.Data) <= threshold {
+		return payload, nil
+	}
+	ref, err := store.Put(context.Background(), payload.Data)
+	if err != nil {
+		return nil, err
+	}
+	if payload.Metadata == nil {
+		payload.Metadata = map[string][]byte{}
+	}
+	if _, found := payload.Metadata[temporalMetadataRawSize]; !found {
+		payload.Metadata[temporalMetadataRawSize] = []byte(strconv.Itoa(len(payload.Data)))
 	}
+	payload.Metadata[temporalMetadataBlobRef] = []byte(ref)
+	payload.Data = nil
+	return payload, nil
+}
+
+// ReleaseBlobs releases the blobs the payloads reference, if offloaded: the cleanup hook of payloads that are
+// no longer needed, e.g. of histories past retention.
+func (s TemporalDataConverter) ReleaseBlobs(ctx context.Context, payloads *commonpb.Payloads) error {
+	store := s.blobs()
+	for _, payload := range payloads.GetPayloads() {
+		ref, found := payload.GetMetadata()[temporalMetadataBlobRef]
+		if !found {
+			continue
+		}
+		if store == nil {
+			return errNoBlobStore
+		}
+		if err := store.Release(ctx, string(ref)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// payloadData returns the payload data, fetched from the blob store, decrypted and decompressed if the payload
+// is marked as such, and the payload format named by the "encoding" metadata. Payloads of unknown encodings,
+// e.g. "json/plain", are JSON.
+func payloadData(blobs encoded.BlobStore, keys encoded.KeyProvider, payload *commonpb.Payload) ([]byte, encoded.PayloadFormat, error) {
+	data := payload.GetData()
+	if ref, found := payload.GetMetadata()[temporalMetadataBlobRef]; found {
+		if blobs == nil {
+			return nil, nil, errNoBlobStore
+		}
+		var err error
+		if data, err = blobs.Get(context.Background(), string(ref)); err != nil {
+			return nil, nil, err
+		}
+	}
+	if id, found := payload.GetMetadata()[temporalMetadataKeyID]; found {
+		if keys == nil {
+			return nil, nil, errNoPayloadKeys
+		}
+		var err error
+		if data, err = encoded.Decrypt(keys, string(id), data); err != nil {
+			return nil, nil, err
+		}
+	}
+	encoding := string(payload.GetMetadata()[temporalMetadataEncoding])
+	if strings.HasSuffix(encoding, temporalGzipSuffix) {
+		encoding = strings.TrimSuffix(encoding, temporalGzipSuffix)
+		var err error
+		if data, err = decompress(data); err != nil {
+			return nil, nil, err
+		}
+	}
+	format, found := encoded.FormatByName(encoding)
+	if !found {
+		format = encoded.JSON
+	}
+	return data, format, nil
+}
 
-	err = star.Decode(line, to)
-	if _, ok := err.(star.UnsupportedTypeError); ok {
-		err = jsoniter.Unmarshal(line, to)
+// payloadRawSize returns the payload size before compression.
+func payloadRawSize(payload *commonpb.Payload) int {
+	if n, err := strconv.Atoi(string(payload.GetMetadata()[temporalMetadataRawSize])); err == nil {
+		return n
 	}
+	return len(payload.GetData())
+}
+
+// FromPayload converts a single Temporal Payload back to a Go value
+func (s TemporalDataConverter) FromPayload(payload *commonpb.Payload, to interface{}) error {
+	data, format, err := payloadData(s.blobs(), payloadKeys(s.Keys), payload)
 	if err != nil {
+		return err
+	}
+	if err := format.Decode(data, []any{to}); err != nil {
 		s.Logger.Error("decode-error", ext.ZapError(err)...)
 		return err
 	}
@@ -525,6 +794,16 @@ func (e TemporalCustomError) Reason() string {
 	return e.ApplicationError.Error()
 }
 
+// temporalApplicationError is the CustomError returned by AsCustomError: its reason is the application error type
+// rather than the message of TemporalCustomError.Reason.
+type temporalApplicationError struct {
+	*TemporalCustomError
+}
+
+func (e temporalApplicationError) Reason() string {
+	return e.ApplicationError.Type()
+}
+
 // HasDetails return if this error has strong typed detail data.
 func (e TemporalCustomError) HasDetails() bool {
 	return e.ApplicationError.HasDetails()
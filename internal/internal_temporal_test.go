@@ -1,11 +1,20 @@
 package internal
 
 import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	starencoded "github.com/cadence-workflow/starlark-worker/encoded"
 	"github.com/stretchr/testify/require"
 	"go.starlark.net/starlark"
+	commonpb "go.temporal.io/api/common/v1"
 	"go.uber.org/cadence/encoded"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zaptest"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
 	"testing"
 )
 
@@ -100,9 +109,216 @@ func TestTemporalFromData(t *testing.T) {
 		var out starlark.String
 		require.Error(t, converter.FromData([]byte("true\n"), &out))
 	})
+	t.Run("decode-big-int", func(t *testing.T) {
+		// Assert large integers keep their precision in both Starlark and Go values.
+		data := []byte("[18446744073709551617,340282366920938463463374607431768211455]\n")
+
+		var out1 starlark.Value
+		require.NoError(t, converter.FromData(data, &out1))
+		require.Equal(t, "[18446744073709551617, 340282366920938463463374607431768211455]", out1.String())
+
+		var out2 any
+		require.NoError(t, converter.FromData(data, &out2))
+		require.Equal(t, []any{json.Number("18446744073709551617"), json.Number("340282366920938463463374607431768211455")}, out2)
+
+		var out3 struct {
+			ID uint64 `json:"id"`
+		}
+		require.NoError(t, converter.FromData([]byte("{\"id\":18446744073709551615}\n"), &out3))
+		require.Equal(t, uint64(18446744073709551615), out3.ID)
+	})
+}
+
+// TestTemporalFromPayloads tests that the converter can decode Temporal payloads into Go and Starlark values.
+func TestTemporalFromPayloads(t *testing.T) {
+	converter := TemporalDataConverter{Logger: zaptest.NewLogger(t, zaptest.Level(zap.InfoLevel))}
+
+	t.Run("decode-several", func(t *testing.T) {
+		// Assert the decoder maps payloads to values one by one.
+		payloads, err := converter.ToPayloads(starlark.String("abc"), TemporalTestStruct{ID: 101})
+		require.NoError(t, err)
+
+		var out1 starlark.Value
+		var out2 TemporalTestStruct
+		require.NoError(t, converter.FromPayloads(payloads, &out1, &out2))
+		require.Equal(t, starlark.String("abc"), out1)
+		require.Equal(t, TemporalTestStruct{ID: 101}, out2)
+	})
+
+	t.Run("decode-missing-payloads", func(t *testing.T) {
+		// Assert values without a matching payload fail to decode, except for query arguments.
+		var out *TemporalTestStruct
+		require.ErrorIs(t, converter.FromPayloads(&commonpb.Payloads{}, &out), io.EOF)
+		require.NoError(t, temporalQueryConverter{converter}.FromPayloads(nil, &out))
+		require.Nil(t, out)
+	})
+
+	t.Run("query-converter", func(t *testing.T) {
+		// Assert query results are encoded with the worker's data converter, e.g. its payload format.
+		msgpack := TemporalDataConverter{Logger: converter.Logger, Format: starencoded.MsgPack}
+		payload, err := TemporalWorkflow{DataConverter: msgpack}.queryConverter().ToPayload(starlark.String("abc"))
+		require.NoError(t, err)
+		require.Equal(t, "msgpack", string(payload.Metadata[temporalMetadataEncoding]))
+		require.NotNil(t, TemporalWorkflow{}.queryConverter().DataConverter.(TemporalDataConverter).Logger)
+	})
 }
 
 func newTemporalTestConverter(t *testing.T) encoded.DataConverter {
 	logger := zaptest.NewLogger(t, zaptest.Level(zap.InfoLevel))
 	return &CadenceDataConverter{Logger: logger}
 }
+
+// TestTemporalPayloadCompression tests that large payloads are compressed and size-checked.
+func TestTemporalPayloadCompression(t *testing.T) {
+	converter := TemporalDataConverter{
+		Logger:               zaptest.NewLogger(t, zaptest.Level(zap.InfoLevel)),
+		CompressionThreshold: 100,
+		MaxPayloadSize:       1000,
+	}
+	large := starlark.String(strings.Repeat("abc", 1000))
+
+	t.Run("small-as-is", func(t *testing.T) {
+		payload, err := converter.ToPayload(starlark.String("abc"))
+		require.NoError(t, err)
+		require.Equal(t, []byte("\"abc\"\n"), payload.Data)
+		require.Empty(t, payload.Metadata)
+	})
+
+	t.Run("large-round-trip", func(t *testing.T) {
+		// Assert the encoder compresses large payloads and marks them with the encoding metadata.
+		payloads, err := converter.ToPayloads(large, true)
+		require.NoError(t, err)
+		require.Equal(t, temporalEncodingGzip, string(payloads.Payloads[0].Metadata[temporalMetadataEncoding]))
+		require.Less(t, len(payloads.Payloads[0].Data), len(large))
+		require.Empty(t, payloads.Payloads[1].Metadata)
+		require.Equal(t, "\"abcabc", converter.ToString(payloads.Payloads[0])[:7])
+
+		var out1 starlark.String
+		var out2 bool
+		require.NoError(t, converter.FromPayloads(payloads, &out1, &out2))
+		require.Equal(t, large, out1)
+		require.True(t, out2)
+	})
+
+	t.Run("too-large", func(t *testing.T) {
+		// Assert the encoder fails when the payloads exceed the limit even after compression.
+		rnd := make([]byte, 700)
+		_, _ = rand.New(rand.NewSource(1)).Read(rnd)
+		v := starlark.String(hex.EncodeToString(rnd))
+		_, err := converter.ToPayload(v)
+		require.NoError(t, err)
+
+		_, err = converter.ToPayloads(v, v)
+		var tooLarge PayloadTooLargeError
+		require.ErrorAs(t, err, &tooLarge)
+		require.Equal(t, 1000, tooLarge.Limit)
+		require.Equal(t, 2*1403, tooLarge.RawSize)
+	})
+}
+
+// TestTemporalPayloadFormat tests that MessagePack payloads are marked with the encoding metadata and auto-detected.
+func TestTemporalPayloadFormat(t *testing.T) {
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.InfoLevel))
+	msgpack := TemporalDataConverter{Logger: logger, Format: starencoded.MsgPack, CompressionThreshold: 100}
+	converter := TemporalDataConverter{Logger: logger}
+
+	t.Run("round-trip", func(t *testing.T) {
+		payloads, err := msgpack.ToPayloads(starlark.Tuple{starlark.String("pi"), starlark.Float(3.14)}, TemporalTestStruct{ID: 101})
+		require.NoError(t, err)
+		require.Equal(t, "msgpack", string(payloads.Payloads[0].Metadata[temporalMetadataEncoding]))
+		require.Equal(t, "{\n  \"id\": 101\n}", converter.ToString(payloads.Payloads[1]))
+
+		// Assert the default (JSON) converter detects the format.
+		var out1 starlark.Tuple
+		var out2 TemporalTestStruct
+		require.NoError(t, converter.FromPayloads(payloads, &out1, &out2))
+		require.Equal(t, starlark.Tuple{starlark.String("pi"), starlark.Float(3.14)}, out1)
+		require.Equal(t, TemporalTestStruct{ID: 101}, out2)
+	})
+
+	t.Run("compressed", func(t *testing.T) {
+		large := starlark.String(strings.Repeat("abc", 1000))
+		payload, err := msgpack.ToPayload(large)
+		require.NoError(t, err)
+		require.Equal(t, "msgpack/gzip", string(payload.Metadata[temporalMetadataEncoding]))
+
+		var out starlark.String
+		require.NoError(t, converter.FromPayload(payload, &out))
+		require.Equal(t, large, out)
+	})
+}
+
+func TestTemporalPayloadEncryption(t *testing.T) {
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.InfoLevel))
+	keys, err := starencoded.ParseKeyRing("k1:" + strings.Repeat("A", 43) + "=")
+	require.NoError(t, err)
+	converter := TemporalDataConverter{Logger: logger, Keys: keys, Format: starencoded.MsgPack, CompressionThreshold: 100}
+
+	t.Run("round-trip", func(t *testing.T) {
+		payloads, err := converter.ToPayloads(starlark.String("secret"), TemporalTestStruct{ID: 101})
+		require.NoError(t, err)
+		require.Equal(t, "k1", string(payloads.Payloads[0].Metadata[temporalMetadataKeyID]))
+		require.Equal(t, "msgpack", string(payloads.Payloads[0].Metadata[temporalMetadataEncoding]))
+		require.NotContains(t, string(payloads.Payloads[0].Data), "secret")
+		require.Equal(t, "{\n  \"id\": 101\n}", converter.ToString(payloads.Payloads[1]))
+
+		var out1 starlark.String
+		var out2 TemporalTestStruct
+		require.NoError(t, converter.FromPayloads(payloads, &out1, &out2))
+		require.Equal(t, starlark.String("secret"), out1)
+		require.Equal(t, TemporalTestStruct{ID: 101}, out2)
+	})
+
+	t.Run("compressed", func(t *testing.T) {
+		large := starlark.String(strings.Repeat("abc", 1000))
+		payload, err := converter.ToPayload(large)
+		require.NoError(t, err)
+		require.Equal(t, "msgpack/gzip", string(payload.Metadata[temporalMetadataEncoding]))
+		require.Less(t, len(payload.Data), 1000)
+
+		var out starlark.String
+		require.NoError(t, converter.FromPayload(payload, &out))
+		require.Equal(t, large, out)
+	})
+
+	t.Run("no-keys", func(t *testing.T) {
+		payload, err := converter.ToPayload(starlark.MakeInt(42))
+		require.NoError(t, err)
+		var out starlark.Int
+		require.ErrorIs(t, TemporalDataConverter{Logger: logger}.FromPayload(payload, &out), errNoPayloadKeys)
+	})
+}
+
+func TestTemporalPayloadOffloading(t *testing.T) {
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.InfoLevel))
+	store := &starencoded.LocalBlobStore{Dir: t.TempDir()}
+	converter := TemporalDataConverter{Logger: logger, Blobs: store, BlobThreshold: 100, CompressionThreshold: -1}
+
+	large := starlark.String(strings.Repeat("abc", 1000))
+
+	t.Run("round-trip", func(t *testing.T) {
+		payloads, err := converter.ToPayloads(large, starlark.String("small"))
+		require.NoError(t, err)
+		ref := string(payloads.Payloads[0].Metadata[temporalMetadataBlobRef])
+		require.NotEmpty(t, ref)
+		require.Empty(t, payloads.Payloads[0].Data)
+		require.Empty(t, payloads.Payloads[1].Metadata[temporalMetadataBlobRef])
+
+		var out1, out2 starlark.String
+		require.NoError(t, converter.FromPayloads(payloads, &out1, &out2))
+		require.Equal(t, large, out1)
+		require.Equal(t, starlark.String("small"), out2)
+		require.Equal(t, `"`+string(large)+`"`, converter.ToString(payloads.Payloads[0]))
+
+		require.NoError(t, converter.ReleaseBlobs(context.Background(), payloads))
+		_, err = store.Get(context.Background(), ref)
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("no-store", func(t *testing.T) {
+		payload, err := converter.ToPayload(large)
+		require.NoError(t, err)
+		var out starlark.String
+		require.ErrorIs(t, TemporalDataConverter{Logger: logger}.FromPayload(payload, &out), errNoBlobStore)
+	})
+}
@@ -19,6 +19,10 @@ type Workflow interface {
 	WithActivityOptions(ctx Context, options ActivityOptions) Context
 	WithChildOptions(ctx Context, cwo ChildWorkflowOptions) Context
 	SetQueryHandler(ctx Context, queryType string, handler interface{}) error
+	GetSignalChannel(ctx Context, signalName string) ReceiveChannel
+	NewSelector(ctx Context) Selector
+	Err(ctx Context) error
+	NewContinueAsNewError(ctx Context, wfn interface{}, args ...interface{}) error
 	WithWorkflowDomain(ctx Context, name string) Context
 	WithWorkflowTaskList(ctx Context, name string) Context
 	ExecuteChildWorkflow(ctx Context, childWorkflow interface{}, args ...interface{}) ChildWorkflowFuture
@@ -29,5 +33,9 @@ type Workflow interface {
 	Now(ctx Context) time.Time
 	Sleep(ctx Context, d time.Duration) (err error)
 	IsCanceledError(ctx Context, err error) bool
+	IsTimeoutError(ctx Context, err error) bool
+	AsCustomError(ctx Context, err error) (CustomError, bool)
+	ToWorkflowError(ctx Context, err error) error
+	IsReplaying(ctx Context) bool
 	WithRetryPolicy(ctx Context, retryPolicy RetryPolicy) Context
 }
@@ -0,0 +1,244 @@
+package internal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cadence-workflow/starlark-worker/encoded"
+	"github.com/cadence-workflow/starlark-worker/ext"
+)
+
+const (
+	// cadenceGzipPrefix marks gzip-compressed Cadence payloads. Encoded JSON never starts with a NUL byte.
+	cadenceGzipPrefix = "\x00gzip\x00"
+	// cadenceEncryptedPrefix marks encrypted Cadence payloads, followed by the key ID length byte, the key ID and
+	// the encrypted payload, see encoded.Encrypt.
+	cadenceEncryptedPrefix = "\x00aes-gcm\x00"
+	// cadenceBlobPrefix marks Cadence payloads offloaded to the blob store, followed by the blob reference.
+	cadenceBlobPrefix = "\x00blob\x00"
+	// temporalEncodingGzip is the Temporal payload "encoding" metadata value of gzip-compressed JSON payloads.
+	// Other formats are marked with their name, and the temporalGzipSuffix if compressed.
+	temporalEncodingGzip     = "json" + temporalGzipSuffix
+	temporalGzipSuffix       = "/gzip"
+	temporalMetadataEncoding = "encoding"
+	temporalMetadataRawSize  = "raw-size"
+	// temporalMetadataKeyID is the Temporal payload metadata of the key ID of encrypted payloads.
+	temporalMetadataKeyID = "encryption-key-id"
+	// temporalMetadataBlobRef is the Temporal payload metadata of the blob reference of offloaded payloads.
+	temporalMetadataBlobRef = "blob-ref"
+)
+
+// errNoPayloadKeys is returned when decoding an encrypted payload without a key provider.
+var errNoPayloadKeys = errors.New("encrypted payload: no payload keys")
+
+// errNoBlobStore is returned when decoding an offloaded payload without a blob store.
+var errNoBlobStore = errors.New("offloaded payload: no blob store")
+
+// PayloadTooLargeError is returned by the data converters when an encoded payload exceeds the size limit
+// even after compression.
+type PayloadTooLargeError struct {
+	Size    int // payload size after compression
+	RawSize int // payload size before compression
+	Limit   int
+}
+
+func (e PayloadTooLargeError) Error() string {
+	return fmt.Sprintf(
+		"payload too large: %d bytes (%d bytes before compression), limit: %d bytes",
+		e.Size, e.RawSize, e.Limit,
+	)
+}
+
+// payloadOptions resolves the compression threshold and size limit; zero means the default (see
+// encoded.DefaultCompressionThreshold and encoded.DefaultMaxPayloadSize), negative disables.
+func payloadOptions(threshold int, limit int) (int, int) {
+	if threshold == 0 {
+		threshold = encoded.DefaultCompressionThreshold
+	}
+	if limit == 0 {
+		limit = encoded.DefaultMaxPayloadSize
+	}
+	return threshold, limit
+}
+
+// payloadFormat returns the given payload format, or the default one if nil.
+func payloadFormat(f encoded.PayloadFormat) encoded.PayloadFormat {
+	if f == nil {
+		return encoded.DefaultFormat
+	}
+	return f
+}
+
+// payloadKeys returns the given key provider, or the default one if nil. Nil result disables encryption.
+func payloadKeys(k encoded.KeyProvider) encoded.KeyProvider {
+	if k == nil {
+		return encoded.DefaultKeys
+	}
+	return k
+}
+
+// payloadBlobs resolves the blob store and the offloading threshold: the given store, or the default one if nil,
+// and the threshold, zero means the default. Nil store or a negative threshold disables offloading.
+func payloadBlobs(store encoded.BlobStore, threshold int) (encoded.BlobStore, int) {
+	if store == nil {
+		store = encoded.DefaultBlobs
+	}
+	if threshold == 0 {
+		threshold = encoded.DefaultBlobThreshold
+	}
+	return store, threshold
+}
+
+// offloadCadence stores the Cadence payload in the blob store if it is larger than the threshold and returns
+// the marked reference. Returns the data as-is otherwise.
+func offloadCadence(store encoded.BlobStore, threshold int, data []byte) ([]byte, error) {
+	if store == nil || threshold < 0 || len(data) <= threshold {
+		return data, nil
+	}
+	ref, err := store.Put(context.Background(), data)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(cadenceBlobPrefix), ref...), nil
+}
+
+// resolveCadence fetches the Cadence payload from the blob store if it is an offloaded payload reference.
+// Returns the data as-is otherwise.
+func resolveCadence(store encoded.BlobStore, data []byte) ([]byte, error) {
+	ref, ok := cadenceBlobRef(data)
+	if !ok {
+		return data, nil
+	}
+	if store == nil {
+		return nil, errNoBlobStore
+	}
+	return store.Get(context.Background(), ref)
+}
+
+// cadenceBlobRef returns the blob reference of an offloaded Cadence payload.
+func cadenceBlobRef(data []byte) (string, bool) {
+	if !bytes.HasPrefix(data, []byte(cadenceBlobPrefix)) {
+		return "", false
+	}
+	return encoded.ParseBlobRef(data[len(cadenceBlobPrefix):])
+}
+
+// encryptCadence encrypts the Cadence payload if keys are provided. Returns the data as-is otherwise.
+// Deterministic encryption (see encoded.EncryptDeterministic) keeps offloaded payloads content-addressed.
+func encryptCadence(keys encoded.KeyProvider, data []byte, deterministic bool) ([]byte, error) {
+	if keys == nil {
+		return data, nil
+	}
+	id, b, err := encrypt(keys, data, deterministic)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]byte, 0, len(cadenceEncryptedPrefix)+1+len(id)+len(b))
+	res = append(res, cadenceEncryptedPrefix...)
+	res = append(res, byte(len(id)))
+	res = append(res, id...)
+	return append(res, b...), nil
+}
+
+// encrypt encrypts the data with the current key, deterministically if set.
+func encrypt(keys encoded.KeyProvider, data []byte, deterministic bool) (string, []byte, error) {
+	if deterministic {
+		return encoded.EncryptDeterministic(keys, data)
+	}
+	return encoded.Encrypt(keys, data)
+}
+
+// offloading reports whether payloads may be offloaded to the blob store.
+func offloading(store encoded.BlobStore, threshold int) bool {
+	return store != nil && threshold >= 0
+}
+
+// decryptCadence decrypts the Cadence payload if it is marked as encrypted. Returns the data as-is otherwise.
+func decryptCadence(keys encoded.KeyProvider, data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte(cadenceEncryptedPrefix)) {
+		return data, nil
+	}
+	if keys == nil {
+		return nil, errNoPayloadKeys
+	}
+	data = data[len(cadenceEncryptedPrefix):]
+	if len(data) == 0 || len(data) < 1+int(data[0]) {
+		return nil, errors.New("bad encrypted payload: too short")
+	}
+	n := int(data[0])
+	return encoded.Decrypt(keys, string(data[1:1+n]), data[1+n:])
+}
+
+// compress gzip-compresses the data if it is larger than the threshold and compression makes it smaller.
+// Returns the data as-is otherwise.
+func compress(data []byte, threshold int) ([]byte, bool, error) {
+	if threshold < 0 || len(data) <= threshold {
+		return data, false, nil
+	}
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, false, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, false, err
+	}
+	if buf.Len() >= len(data) {
+		return data, false, nil
+	}
+	return buf.Bytes(), true, nil
+}
+
+func decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// checkPayloadSize fails with PayloadTooLargeError if size exceeds the limit. A negative limit disables the check.
+func checkPayloadSize(size int, rawSize int, limit int) error {
+	if limit >= 0 && size > limit {
+		return PayloadTooLargeError{Size: size, RawSize: rawSize, Limit: limit}
+	}
+	return nil
+}
+
+// payloadString renders the decoded values of the payload as indented JSON, one value per line, or returns
+// the data as-is if it does not decode. Trailing null values are not rendered, except for a single one.
+func payloadString(format encoded.PayloadFormat, data []byte) string {
+	// Decode into a growing number of outputs until the last one is left nil: all the values are decoded.
+	var values []any
+	for n := 4; ; n *= 2 {
+		values = make([]any, n)
+		to := make([]any, n)
+		for i := range values {
+			to[i] = &values[i]
+		}
+		if err := format.Decode(data, to); err != nil {
+			return string(data)
+		}
+		if values[n-1] == nil {
+			break
+		}
+	}
+	for len(values) > 1 && values[len(values)-1] == nil {
+		values = values[:len(values)-1]
+	}
+	lines := make([]string, len(values))
+	for i, v := range values {
+		b, err := ext.JSON.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return string(data)
+		}
+		lines[i] = string(b)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -195,6 +195,26 @@ type Future interface {
 	IsReady() bool
 }
 
+// ReceiveChannel is a workflow channel that can only be read from, such as a signal channel.
+type ReceiveChannel interface {
+	// Receive blocks until it receives a value, and then assigns the received value to the provided pointer.
+	// Returns false when the channel is closed.
+	Receive(ctx Context, valuePtr interface{}) (ok bool)
+	// ReceiveAsync tries to receive a value from the channel without blocking.
+	// Returns false if there is no value available.
+	ReceiveAsync(valuePtr interface{}) (ok bool)
+}
+
+// Selector waits on several workflow channels at once, such as a signal channel and the context cancellation.
+type Selector interface {
+	// AddReceive registers a callback called by Select once the channel has a value. The callback must receive it.
+	AddReceive(c ReceiveChannel, f func(c ReceiveChannel, more bool)) Selector
+	// AddDone registers a callback called by Select once the context is canceled.
+	AddDone(ctx Context, f func()) Selector
+	// Select blocks until one of the registered callbacks is called.
+	Select(ctx Context)
+}
+
 type IInfo interface {
 	ExecutionID() string
 	RunID() string
@@ -32,7 +32,7 @@ func UpdateWorkflowFunctionContextArgument(wf interface{}, contextType reflect.T
 	}
 
 	// Get original function name (if available)
-	funcName := runtime.FuncForPC(originalFunc.Pointer()).Name()
+	funcName := WorkflowName(wf)
 
 	// Build a new function with the same signature but the provided context type
 	wrappedFuncType := reflect.FuncOf(
@@ -49,8 +49,13 @@ func UpdateWorkflowFunctionContextArgument(wf interface{}, contextType reflect.T
 		}
 		return originalFunc.Call(newArgs)
 	})
-	funcName = strings.TrimSuffix(funcName, "-fm")
 	fmt.Printf("Registering workflow: %s", funcName)
 
 	return wrappedFunc.Interface(), funcName
 }
+
+// WorkflowName returns the name a workflow function is registered with, see UpdateWorkflowFunctionContextArgument.
+func WorkflowName(wf interface{}) string {
+	funcName := runtime.FuncForPC(reflect.ValueOf(wf).Pointer()).Name()
+	return strings.TrimSuffix(funcName, "-fm")
+}
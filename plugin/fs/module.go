@@ -0,0 +1,132 @@
+package fs
+
+import (
+	"fmt"
+
+	"github.com/cadence-workflow/starlark-worker/star"
+	"go.starlark.net/starlark"
+)
+
+// Module gives read-only access to the files of the run's package. Paths starting with "./" or "../" are
+// relative to the calling file, others are relative to the package root, the same way as load() paths.
+type Module struct {
+	fs star.FS
+}
+
+var _ starlark.HasAttrs = &Module{}
+
+func (f *Module) String() string                        { return pluginID }
+func (f *Module) Type() string                          { return pluginID }
+func (f *Module) Freeze()                               {}
+func (f *Module) Truth() starlark.Bool                  { return true }
+func (f *Module) Hash() (uint32, error)                 { return 0, fmt.Errorf("no-hash") }
+func (f *Module) Attr(n string) (starlark.Value, error) { return star.Attr(f, n, builtins, properties) }
+func (f *Module) AttrNames() []string                   { return star.AttrNames(builtins, properties) }
+
+var builtins = map[string]*starlark.Builtin{
+	"read":      starlark.NewBuiltin("read", read),
+	"read_text": starlark.NewBuiltin("read_text", readText),
+	"exists":    starlark.NewBuiltin("exists", exists),
+	"list":      starlark.NewBuiltin("list", list),
+	"glob":      starlark.NewBuiltin("glob", glob),
+}
+
+var properties = map[string]star.PropertyFactory{}
+
+// read returns the file content as bytes.
+func read(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	b, err := readFile(t, fn, args, kwargs)
+	if err != nil {
+		return nil, err
+	}
+	return starlark.Bytes(b), nil
+}
+
+// readText returns the file content as a string.
+func readText(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	b, err := readFile(t, fn, args, kwargs)
+	if err != nil {
+		return nil, err
+	}
+	return starlark.String(b), nil
+}
+
+// exists reports whether the file or directory exists.
+func exists(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var p string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "path", &p); err != nil {
+		return nil, err
+	}
+	p, err := resolve(t, p)
+	if err != nil {
+		return nil, err
+	}
+	res, err := star.Exists(fn.Receiver().(*Module).fs, p)
+	if err != nil {
+		return nil, err
+	}
+	return starlark.Bool(res), nil
+}
+
+// list returns the sorted names of the directory entries. Names of subdirectories end with "/".
+func list(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	dir := "/"
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "dir?", &dir); err != nil {
+		return nil, err
+	}
+	dir, err := resolve(t, dir)
+	if err != nil {
+		return nil, err
+	}
+	names, err := fn.Receiver().(*Module).fs.List(dir)
+	if err != nil {
+		return nil, err
+	}
+	return toList(names), nil
+}
+
+// glob returns the sorted absolute paths of the files matching the pattern, e.g. "./fixtures/**/*.json".
+func glob(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pattern string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "pattern", &pattern); err != nil {
+		return nil, err
+	}
+	pattern, err := resolve(t, pattern)
+	if err != nil {
+		return nil, err
+	}
+	paths, err := star.Glob(fn.Receiver().(*Module).fs, pattern)
+	if err != nil {
+		return nil, err
+	}
+	return toList(paths), nil
+}
+
+func readFile(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) ([]byte, error) {
+	var p string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "path", &p); err != nil {
+		return nil, err
+	}
+	p, err := resolve(t, p)
+	if err != nil {
+		return nil, err
+	}
+	return fn.Receiver().(*Module).fs.Read(p)
+}
+
+// resolve returns the package path relative to the calling file, see star.ResolveLoad.
+func resolve(t *starlark.Thread, p string) (string, error) {
+	from := "/"
+	if t.CallStackDepth() > 1 { // the innermost frame is the builtin
+		from = t.CallFrame(1).Pos.Filename()
+	}
+	return star.ResolveLoad(from, p)
+}
+
+func toList(values []string) *starlark.List {
+	res := make([]starlark.Value, len(values))
+	for i, v := range values {
+		res[i] = starlark.String(v)
+	}
+	return starlark.NewList(res)
+}
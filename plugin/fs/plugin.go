@@ -0,0 +1,25 @@
+package fs
+
+import (
+	"github.com/cadence-workflow/starlark-worker/service"
+	"github.com/cadence-workflow/starlark-worker/worker"
+	"go.starlark.net/starlark"
+)
+
+const pluginID = "fs"
+
+var Plugin = &plugin{}
+
+type plugin struct{}
+
+var _ service.IPlugin = (*plugin)(nil)
+
+func (r *plugin) ID() string {
+	return pluginID
+}
+
+func (r *plugin) Create(info service.RunInfo) starlark.Value {
+	return &Module{fs: info.FS}
+}
+
+func (r *plugin) Register(registry worker.Registry) {}
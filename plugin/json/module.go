@@ -43,7 +43,7 @@ func dumps(t *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs
 		return nil, err
 	}
 
-	encoded, err := star.Encode(obj)
+	encoded, err := star.EncodeJSON(obj)
 	if err != nil {
 		logger.Error("error", zap.Error(err))
 		return nil, err
@@ -0,0 +1,49 @@
+package log
+
+import (
+	"fmt"
+	"github.com/cadence-workflow/starlark-worker/service"
+	"github.com/cadence-workflow/starlark-worker/star"
+	"go.starlark.net/starlark"
+	"go.uber.org/zap/zapcore"
+)
+
+type Module struct{}
+
+var _ starlark.HasAttrs = &Module{}
+
+func (f *Module) String() string                        { return pluginID }
+func (f *Module) Type() string                          { return pluginID }
+func (f *Module) Freeze()                               {}
+func (f *Module) Truth() starlark.Bool                  { return true }
+func (f *Module) Hash() (uint32, error)                 { return 0, fmt.Errorf("no-hash") }
+func (f *Module) Attr(n string) (starlark.Value, error) { return star.Attr(f, n, builtins, properties) }
+func (f *Module) AttrNames() []string                   { return star.AttrNames(builtins, properties) }
+
+var builtins = map[string]*starlark.Builtin{
+	"debug":   starlark.NewBuiltin("debug", leveled(zapcore.DebugLevel)),
+	"info":    starlark.NewBuiltin("info", leveled(zapcore.InfoLevel)),
+	"warning": starlark.NewBuiltin("warning", leveled(zapcore.WarnLevel)),
+	"error":   starlark.NewBuiltin("error", leveled(zapcore.ErrorLevel)),
+}
+
+var properties = map[string]star.PropertyFactory{}
+
+// leveled returns a builtin that writes a structured log line at the given level.
+// Arguments:
+//   - msg: the log message.
+//   - **fields: structured fields attached to the log line; values must be serializable (see star.Encode).
+//
+// Returns: None
+func leveled(level zapcore.Level) func(*starlark.Thread, *starlark.Builtin, starlark.Tuple, []starlark.Tuple) (starlark.Value, error) {
+	return func(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var msg string
+		if err := starlark.UnpackPositionalArgs(fn.Name(), args, nil, 1, &msg); err != nil {
+			return nil, err
+		}
+		if err := service.WriteLog(t, level, msg, kwargs); err != nil {
+			return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+		}
+		return starlark.None, nil
+	}
+}
@@ -0,0 +1,90 @@
+package log
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/cadence-workflow/starlark-worker/service"
+	"github.com/stretchr/testify/require"
+)
+
+var expectedLogs = []service.LogEntry{
+	{Seq: 0, Level: "info", Thread: "main", Message: "plain"},
+	{Seq: 1, Level: "debug", Thread: "main", Message: "debug message"},
+	{Seq: 2, Level: "info", Thread: "main", Message: "info message", Fields: map[string]any{"user": "alice", "attempt": json.Number("2")}},
+	{Seq: 3, Level: "warning", Thread: "main", Message: "warning message", Fields: map[string]any{"tags": []any{"a", "b"}}},
+	{Seq: 4, Level: "error", Thread: "main", Message: "error message", Fields: map[string]any{"details": map[string]any{"code": json.Number("500")}}},
+}
+
+func requireLogs(t *testing.T, actual []service.LogEntry) {
+	require.Len(t, actual, len(expectedLogs))
+	for i := range actual {
+		require.False(t, actual[i].Timestamp.IsZero())
+		actual[i].Timestamp = expectedLogs[i].Timestamp
+	}
+	require.Equal(t, expectedLogs, actual)
+}
+
+func TestCadenceLogs(t *testing.T) {
+	suite := &service.StarCadTestSuite{}
+	env := suite.NewCadEnvironment(t, &service.StarCadTestEnvironmentParams{
+		RootDirectory: "testdata",
+		Plugins:       map[string]service.IPlugin{Plugin.ID(): Plugin},
+	})
+	env.ExecuteFunction("/test.star", "test_log", nil, nil, nil)
+
+	var res string
+	require.NoError(t, env.GetResult(&res))
+	require.Equal(t, "ok", res)
+
+	v, err := env.GetTestWorkflowEnvironment().QueryWorkflow(service.LogsQueryName)
+	require.NoError(t, err)
+	var messages []string
+	require.NoError(t, v.Get(&messages))
+	require.Equal(t, []string{"plain", "debug message", "info message", "warning message", "error message"}, messages)
+
+	v, err = env.GetTestWorkflowEnvironment().QueryWorkflow(service.LogEntriesQueryName) // the query argument is optional
+	require.NoError(t, err)
+	var logs []service.LogEntry
+	require.NoError(t, v.Get(&logs))
+	requireLogs(t, logs)
+
+	v, err = env.GetTestWorkflowEnvironment().QueryWorkflow(service.LogEntriesQueryName, service.LogsQuery{Offset: 1, Level: "warning"})
+	require.NoError(t, err)
+	require.NoError(t, v.Get(&logs))
+	require.Len(t, logs, 2)
+	require.Equal(t, int64(3), logs[0].Seq)
+	require.Equal(t, int64(4), logs[1].Seq)
+}
+
+func TestTemporalLogs(t *testing.T) {
+	suite := &service.StarTempTestSuite{}
+	env := suite.NewTempEnvironment(t, &service.StarTempTestEnvironmentParams{
+		RootDirectory: "testdata",
+		Plugins:       map[string]service.IPlugin{Plugin.ID(): Plugin},
+	})
+	env.ExecuteFunction("/test.star", "test_log", nil, nil, nil)
+
+	var res string
+	require.NoError(t, env.GetResult(&res))
+	require.Equal(t, "ok", res)
+
+	v, err := env.GetTestWorkflowEnvironment().QueryWorkflow(service.LogsQueryName)
+	require.NoError(t, err)
+	var messages []string
+	require.NoError(t, v.Get(&messages))
+	require.Equal(t, []string{"plain", "debug message", "info message", "warning message", "error message"}, messages)
+
+	v, err = env.GetTestWorkflowEnvironment().QueryWorkflow(service.LogEntriesQueryName) // the query argument is optional
+	require.NoError(t, err)
+	var logs []service.LogEntry
+	require.NoError(t, v.Get(&logs))
+	requireLogs(t, logs)
+
+	v, err = env.GetTestWorkflowEnvironment().QueryWorkflow(service.LogEntriesQueryName, service.LogsQuery{Offset: 1, Level: "warning"})
+	require.NoError(t, err)
+	require.NoError(t, v.Get(&logs))
+	require.Len(t, logs, 2)
+	require.Equal(t, int64(3), logs[0].Seq)
+	require.Equal(t, int64(4), logs[1].Seq)
+}
@@ -3,8 +3,10 @@ package plugin
 import (
 	"github.com/cadence-workflow/starlark-worker/plugin/atexit"
 	"github.com/cadence-workflow/starlark-worker/plugin/concurrent"
+	"github.com/cadence-workflow/starlark-worker/plugin/fs"
 	"github.com/cadence-workflow/starlark-worker/plugin/hashlib"
 	"github.com/cadence-workflow/starlark-worker/plugin/json"
+	"github.com/cadence-workflow/starlark-worker/plugin/log"
 	"github.com/cadence-workflow/starlark-worker/plugin/os"
 	"github.com/cadence-workflow/starlark-worker/plugin/progress"
 	"github.com/cadence-workflow/starlark-worker/plugin/random"
@@ -29,4 +31,6 @@ var Registry = map[string]service.IPlugin{
 	progress.Plugin.ID():   progress.Plugin,
 	hashlib.Plugin.ID():    hashlib.Plugin,
 	random.Plugin.ID():     random.Plugin,
+	log.Plugin.ID():        log.Plugin,
+	fs.Plugin.ID():         fs.Plugin,
 }
@@ -3,6 +3,7 @@ package request
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/cadence-workflow/starlark-worker/activity"
@@ -12,6 +13,7 @@ import (
 	"go.uber.org/yarpc/yarpcerrors"
 	"go.uber.org/zap"
 	"io"
+	"math/big"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -109,7 +111,7 @@ func (r *activities) DoJSON(ctx context.Context, request JSONRequest) (any, work
 	}
 
 	var _res any
-	if err := jsoniter.NewDecoder(res.Body).Decode(&_res); err != nil {
+	if err := ext.JSONNumber.NewDecoder(res.Body).Decode(&_res); err != nil {
 		logger.Error("activity-error", ext.ZapError(err)...)
 		code := "400" // bad-request https://developer.mozilla.org/en-US/docs/Web/HTTP/Status/400
 		details := fmt.Sprintf("http response body is not a json: %s", err.Error())
@@ -125,7 +127,7 @@ func (r *activities) DoJSON(ctx context.Context, request JSONRequest) (any, work
 		if request.Assert.Value != nil {
 			var found bool
 			for _, v := range request.Assert.Value {
-				if v == value {
+				if assertEqual(v, value) {
 					found = true
 					break
 				}
@@ -188,3 +190,32 @@ func createRequest(ctx context.Context, method string, url string, headers http.
 	req.Header = headers
 	return req, nil
 }
+
+// assertEqual reports whether the asserted value equals the response value. Numbers are compared by value, whatever
+// their representation: 1 equals 1.0.
+func assertEqual(expected, actual any) bool {
+	if x, ok := ratOf(expected); ok {
+		y, ok := ratOf(actual)
+		return ok && x.Cmp(y) == 0
+	}
+	return expected == actual
+}
+
+// ratOf returns the exact value of the number, or false if the value is not a finite number.
+func ratOf(v any) (*big.Rat, bool) {
+	switch v := v.(type) {
+	case json.Number:
+		return new(big.Rat).SetString(v.String())
+	case float64:
+		r := new(big.Rat).SetFloat64(v) // nil if not finite
+		return r, r != nil
+	case int:
+		return new(big.Rat).SetInt64(int64(v)), true
+	case int64:
+		return new(big.Rat).SetInt64(v), true
+	case uint64:
+		return new(big.Rat).SetUint64(v), true
+	default:
+		return nil, false
+	}
+}
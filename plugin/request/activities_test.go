@@ -9,6 +9,7 @@ import (
 	"github.com/stretchr/testify/suite"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -26,15 +27,15 @@ func TestITTemporal(t *testing.T) {
 	suite.Run(t, &Suite{activitySuite: service.NewTempTestActivitySuite()})
 }
 
-func (r *Suite) SetupSuite()    { r.server = httptest.NewServer(ext.NewHTTPTestHandler(r.T())) }
-func (r *Suite) TearDownSuite() { r.server.Close() }
-
-func (r *Suite) BeforeTest(_, _ string) {
+func (r *Suite) SetupSuite() {
+	r.server = httptest.NewServer(ext.NewHTTPTestHandler(r.T()))
 	r.activitySuite.RegisterActivity(&activities{
 		client: http.DefaultClient,
 	})
 }
 
+func (r *Suite) TearDownSuite() { r.server.Close() }
+
 func (r *Suite) Test_DoJSON_Get404() {
 	resourceURL := fmt.Sprintf("%s/storage/%s.json", r.server.URL, uuid.New().String())
 	val, err := r.activitySuite.ExecuteActivity(Activities.DoJSON, JSONRequest{
@@ -51,3 +52,36 @@ func (r *Suite) Test_DoJSON_Get404() {
 	r.Require().NoError(val.Get(&res))
 	r.Require().Equal("not-found", res)
 }
+
+func (r *Suite) Test_DoJSON_AssertNumber() {
+	resourceURL := fmt.Sprintf("%s/storage/%s.json", r.server.URL, uuid.New().String())
+	req, err := http.NewRequest("PUT", resourceURL, strings.NewReader(`{"count": 1.0}`))
+	r.Require().NoError(err)
+	res, err := http.DefaultClient.Do(req)
+	r.Require().NoError(err)
+	r.Require().NoError(res.Body.Close())
+
+	// numbers are compared by value: 1.0 matches 1
+	val, err := r.activitySuite.ExecuteActivity(Activities.DoJSON, JSONRequest{
+		Method: "GET",
+		URL:    resourceURL,
+		Assert: Assert{
+			StatusCodes: []int{200},
+			Path:        "count",
+			Value:       []any{1},
+		},
+	})
+	r.Require().NoError(err)
+	r.Require().True(val.HasValue())
+
+	_, err = r.activitySuite.ExecuteActivity(Activities.DoJSON, JSONRequest{
+		Method: "GET",
+		URL:    resourceURL,
+		Assert: Assert{
+			StatusCodes: []int{200},
+			Path:        "count",
+			Value:       []any{2, "1"},
+		},
+	})
+	r.Require().ErrorContains(err, "412")
+}
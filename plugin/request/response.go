@@ -1,6 +1,8 @@
 package request
 
 import (
+	"bytes"
+	"encoding/base64"
 	"fmt"
 	"github.com/cadence-workflow/starlark-worker/star"
 	"go.starlark.net/starlark"
@@ -8,6 +10,12 @@ import (
 	"net/http"
 )
 
+func init() {
+	// Responses are passed across workflow boundaries with the status code, headers and body:
+	// {"__codec__": "response", "value": {"status_code": 200, "headers": {"k": ["v"]}, "body": "<base64>"}}
+	star.RegisterCodec("response", encodeResponse, decodeResponse)
+}
+
 type Response struct {
 	Response *http.Response
 }
@@ -45,3 +53,80 @@ func _statusCode(r starlark.Value) (starlark.Value, error) {
 	code := r.(*Response).Response.StatusCode
 	return starlark.MakeInt(code), nil
 }
+
+// encodeResponse returns the serializable representation of the response. The body is read and buffered,
+// so the response remains readable.
+func encodeResponse(v starlark.Value) (starlark.Value, error) {
+	r := v.(*Response).Response
+	var body []byte
+	if r.Body != nil {
+		var err error
+		if body, err = io.ReadAll(r.Body); err != nil {
+			return nil, err
+		}
+		_ = r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	headers := starlark.NewDict(len(r.Header))
+	for k, values := range r.Header {
+		l := make([]starlark.Value, len(values))
+		for i, v := range values {
+			l[i] = starlark.String(v)
+		}
+		star.SetStringKey(headers, k, starlark.NewList(l))
+	}
+	res := starlark.NewDict(3)
+	star.SetStringKey(res, "status_code", starlark.MakeInt(r.StatusCode))
+	star.SetStringKey(res, "headers", headers)
+	star.SetStringKey(res, "body", starlark.Bytes(body))
+	return res, nil
+}
+
+// decodeResponse restores the response from the representation returned by encodeResponse. The body is
+// bytes, or a base64 string if encoded by star.Encode.
+func decodeResponse(v starlark.Value) (starlark.Value, error) {
+	d, ok := v.(*starlark.Dict)
+	if !ok {
+		return nil, fmt.Errorf("expected: dict, actual: %s", v.Type())
+	}
+	var statusCode int
+	var headers *starlark.Dict
+	var body starlark.Value
+	if err := starlark.UnpackArgs("response", nil, d.Items(), "status_code", &statusCode, "headers", &headers, "body", &body); err != nil {
+		return nil, err
+	}
+	var b []byte
+	switch body := body.(type) {
+	case starlark.Bytes:
+		b = []byte(body)
+	case starlark.String:
+		var err error
+		if b, err = base64.StdEncoding.DecodeString(string(body)); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("body: expected: bytes or string, actual: %s", body.Type())
+	}
+	header := http.Header{}
+	for _, item := range headers.Items() {
+		k, ok := item[0].(starlark.String)
+		values, isList := item[1].(*starlark.List)
+		if !ok || !isList {
+			return nil, fmt.Errorf("headers: expected: dict of lists, actual: %s", headers)
+		}
+		for i := 0; i < values.Len(); i++ {
+			s, ok := values.Index(i).(starlark.String)
+			if !ok {
+				return nil, fmt.Errorf("headers: %s: expected: string, actual: %s", k, values.Index(i).Type())
+			}
+			header.Add(string(k), string(s))
+		}
+	}
+	return &Response{Response: &http.Response{
+		Status:        fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+		StatusCode:    statusCode,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(b)),
+		ContentLength: int64(len(b)),
+	}}, nil
+}
@@ -0,0 +1,46 @@
+package request
+
+import (
+	"github.com/cadence-workflow/starlark-worker/star"
+	"github.com/stretchr/testify/require"
+	"go.starlark.net/starlark"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// Test the response codec round-trip
+func TestResponseCodec(t *testing.T) {
+	for name, encode := range map[string]func(v any) ([]byte, error){
+		"plain": star.Encode,
+		"typed": star.EncodeTyped,
+	} {
+		t.Run(name, func(t *testing.T) {
+			resp := &Response{Response: &http.Response{
+				StatusCode: 404,
+				Header:     http.Header{"Content-Type": {"application/json"}},
+				Body:       io.NopCloser(strings.NewReader(`{"error": "not found"}`)),
+			}}
+
+			res, err := encode(starlark.NewList([]starlark.Value{resp}))
+			require.NoError(t, err)
+			require.Contains(t, string(res), `"__codec__":"response"`)
+
+			// the encoded response remains readable
+			body, err := io.ReadAll(resp.Response.Body)
+			require.NoError(t, err)
+			require.Equal(t, `{"error": "not found"}`, string(body))
+
+			var out starlark.Value
+			require.NoError(t, star.Decode(res, &out))
+			decoded := out.(*starlark.List).Index(0).(*Response)
+			require.Equal(t, 404, decoded.Response.StatusCode)
+			require.Equal(t, "application/json", decoded.Response.Header.Get("Content-Type"))
+
+			v, err := starlark.Call(&starlark.Thread{}, resB["json"].BindReceiver(decoded), nil, nil)
+			require.NoError(t, err)
+			require.Equal(t, `{"error": "not found"}`, v.String())
+		})
+	}
+}
@@ -1,11 +1,25 @@
 package uuid
 
 import (
+	"fmt"
 	"github.com/cadence-workflow/starlark-worker/star"
 	"go.starlark.net/starlark"
 	"strings"
 )
 
+func init() {
+	// UUIDs are passed across workflow boundaries as strings: {"__codec__": "UUID", "value": "..."}
+	star.RegisterCodec("UUID", func(v starlark.Value) (starlark.Value, error) {
+		return v.(*UUID).StringUUID, nil
+	}, func(v starlark.Value) (starlark.Value, error) {
+		s, ok := v.(starlark.String)
+		if !ok {
+			return nil, fmt.Errorf("expected: string, actual: %s", v.Type())
+		}
+		return &UUID{StringUUID: s}, nil
+	})
+}
+
 type UUID struct {
 	StringUUID starlark.String
 }
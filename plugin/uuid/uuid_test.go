@@ -3,6 +3,7 @@ package uuid
 import (
 	"testing"
 
+	"github.com/cadence-workflow/starlark-worker/star"
 	"github.com/stretchr/testify/require"
 	"go.starlark.net/starlark"
 )
@@ -49,3 +50,16 @@ func TestFreeze(t *testing.T) {
 		uuid.Freeze()
 	}, "Freeze should not panic")
 }
+
+// Test the UUID codec round-trip
+func TestCodec(t *testing.T) {
+	uuid := mockUUID("123e4567-e89b-12d3-a456-426614174000")
+
+	res, err := star.Encode(starlark.NewList([]starlark.Value{uuid}))
+	require.NoError(t, err)
+	require.Equal(t, `[{"__codec__":"UUID","value":"123e4567-e89b-12d3-a456-426614174000"}]`, string(res))
+
+	var out starlark.Value
+	require.NoError(t, star.Decode(res, &out))
+	require.Equal(t, starlark.NewList([]starlark.Value{uuid}), out)
+}
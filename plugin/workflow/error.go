@@ -0,0 +1,128 @@
+package workflow
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cadence-workflow/starlark-worker/ext"
+	"github.com/cadence-workflow/starlark-worker/service"
+	"github.com/cadence-workflow/starlark-worker/star"
+	"github.com/cadence-workflow/starlark-worker/workflow"
+	"go.starlark.net/starlark"
+	"go.uber.org/yarpc/yarpcerrors"
+	"go.uber.org/zap"
+)
+
+// Error is the error object returned by try_call: the failure of the called function, e.g. of an activity or
+// a child workflow it executed.
+type Error struct {
+	Reason     string
+	Message    string
+	Details    starlark.Value
+	IsCanceled bool
+	IsTimeout  bool
+	Backtrace  string
+}
+
+var (
+	_ starlark.HasAttrs = (*Error)(nil)
+)
+
+func (r *Error) String() string {
+	return fmt.Sprintf("workflow.error(reason=%q, message=%q)", r.Reason, r.Message)
+}
+func (r *Error) Type() string          { return "workflow.error" }
+func (r *Error) Freeze()               { r.Details.Freeze() }
+func (r *Error) Truth() starlark.Bool  { return true }
+func (r *Error) Hash() (uint32, error) { return 0, fmt.Errorf("no-hash") }
+func (r *Error) AttrNames() []string   { return star.AttrNames(nil, errorProperties) }
+func (r *Error) Attr(n string) (starlark.Value, error) {
+	return star.Attr(r, n, nil, errorProperties)
+}
+
+var errorProperties = map[string]star.PropertyFactory{
+	"reason":      func(r starlark.Value) (starlark.Value, error) { return starlark.String(r.(*Error).Reason), nil },
+	"message":     func(r starlark.Value) (starlark.Value, error) { return starlark.String(r.(*Error).Message), nil },
+	"details":     func(r starlark.Value) (starlark.Value, error) { return r.(*Error).Details, nil },
+	"is_canceled": func(r starlark.Value) (starlark.Value, error) { return starlark.Bool(r.(*Error).IsCanceled), nil },
+	"is_timeout":  func(r starlark.Value) (starlark.Value, error) { return starlark.Bool(r.(*Error).IsTimeout), nil },
+	"backtrace":   func(r starlark.Value) (starlark.Value, error) { return starlark.String(r.(*Error).Backtrace), nil },
+}
+
+// NewError creates the error object of the given failure. The reason and details are the ones of the first
+// CustomError in the error chain; other errors are "unknown", cancellations "cancelled" and timeouts
+// "deadline-exceeded".
+func NewError(ctx workflow.Context, err error) *Error {
+	res := &Error{
+		Reason:     yarpcerrors.CodeUnknown.String(),
+		Message:    err.Error(),
+		Details:    starlark.None,
+		IsCanceled: workflow.IsCanceledError(ctx, err),
+		IsTimeout:  workflow.IsTimeoutError(ctx, err),
+	}
+	var evalErr *starlark.EvalError
+	if errors.As(err, &evalErr) {
+		res.Backtrace = evalErr.Backtrace()
+		res.Message = evalErr.Msg
+	}
+	switch {
+	case res.IsCanceled:
+		res.Reason = yarpcerrors.CodeCancelled.String()
+	case res.IsTimeout:
+		res.Reason = yarpcerrors.CodeDeadlineExceeded.String()
+	}
+	if customErr, ok := workflow.AsCustomError(ctx, err); ok {
+		res.Reason = customErr.Reason()
+		if customErr.HasDetails() {
+			details, err := service.ErrorDetails(customErr)
+			if err != nil {
+				workflow.GetLogger(ctx).Error("builtin-error", ext.ZapError(err)...)
+				details = starlark.String(fmt.Sprintf("internal: error details extraction failure: %s", err.Error()))
+			}
+			res.Details = details
+		}
+	}
+	return res
+}
+
+// _tryCall calls the function with the given arguments and returns a (result, error) tuple: the result and
+// None on success, None and the error object (see Error) on failure. Cancellations and the exceeded limits of
+// the run (see service.IsLimitError) are raised as-is: they fail the run, whatever the caller does.
+func _tryCall(t *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("try_call: missing argument for fn")
+	}
+	fn, ok := args[0].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("try_call: for parameter fn: got %s, want callable", args[0].Type())
+	}
+	ctx := service.GetContext(t)
+	res, err := starlark.Call(t, fn, args[1:], kwargs)
+	if err != nil {
+		errObj := NewError(ctx, err)
+		if errObj.IsCanceled || service.IsLimitError(t, err) {
+			return nil, err
+		}
+		workflow.GetLogger(ctx).Info("try-call-error", zap.Error(err))
+		return starlark.Tuple{starlark.None, errObj}, nil
+	}
+	return starlark.Tuple{res, starlark.None}, nil
+}
+
+// _error raises a CustomError of the given reason and details: the workflow fails with the reason, see
+// Service.processError, unless the error is handled by try_call.
+func _error(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var reason string
+	var details starlark.Value = starlark.None
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "reason", &reason, "details?", &details); err != nil {
+		return nil, err
+	}
+	if reason == "" {
+		return nil, fmt.Errorf("%s: reason is empty", fn.Name())
+	}
+	ctx := service.GetContext(t)
+	if details == starlark.None {
+		return nil, workflow.NewCustomError(ctx, reason)
+	}
+	return nil, workflow.NewCustomError(ctx, reason, details)
+}
@@ -28,6 +28,8 @@ func (r *Module) AttrNames() []string                   { return star.AttrNames(
 var builtins = map[string]*starlark.Builtin{
 	"execute_activity": starlark.NewBuiltin("execute_activity", _executeActivity),
 	"execute_workflow": starlark.NewBuiltin("execute_workflow", _executeWorkflow),
+	"try_call":         starlark.NewBuiltin("try_call", _tryCall),
+	"error":            starlark.NewBuiltin("error", _error),
 }
 
 var properties = map[string]star.PropertyFactory{
@@ -70,6 +72,10 @@ func _executeActivity(t *starlark.Thread, _ *starlark.Builtin, args starlark.Tup
 			return nil, err
 		}
 	}
+	if err := service.CheckPayloadSize(t, "activity arguments", args[1:]...); err != nil {
+		logger.Error("builtin-error", ext.ZapError(err)...)
+		return nil, err
+	}
 	f := workflow.ExecuteActivity(ctx, activityID, activityArgs...)
 	return executeFuture(ctx, f, asBytes)
 }
@@ -102,6 +108,10 @@ func _executeWorkflow(t *starlark.Thread, _ *starlark.Builtin, args starlark.Tup
 			return nil, err
 		}
 	}
+	if err := service.CheckPayloadSize(t, "workflow arguments", args[1:]...); err != nil {
+		logger.Error("builtin-error", ext.ZapError(err)...)
+		return nil, err
+	}
 	f := workflow.ExecuteChildWorkflow(ctx, workflowID, workflowArgs...)
 	return executeFuture(ctx, f, asBytes)
 }
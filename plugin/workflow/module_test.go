@@ -6,6 +6,11 @@ import (
 
 	"github.com/cadence-workflow/starlark-worker/service"
 	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/temporal"
+	"go.uber.org/cadence"
+	"go.uber.org/cadence/activity"
+
+	tempactivity "go.temporal.io/sdk/activity"
 )
 
 type testCase struct {
@@ -25,6 +30,36 @@ var testCases = []testCase{
 		function:   "test_execution_run_id",
 		wantResult: "default-test-run-id",
 	},
+	{
+		name:       "TryCall",
+		function:   "test_try_call",
+		wantResult: "3 None",
+	},
+	{
+		name:       "TryCallFail",
+		function:   "test_try_call_fail",
+		wantResult: "None|unknown|False|False|fail: boom|True",
+	},
+	{
+		name:       "Error",
+		function:   "test_error",
+		wantResult: `None|bad-input|{"field": ("a", 1)}`,
+	},
+	{
+		name:       "ErrorNoDetails",
+		function:   "test_error_no_details",
+		wantResult: "None|bad-input|None",
+	},
+	{
+		name:       "TryCallActivity",
+		function:   "test_try_call_activity",
+		wantResult: "None|bad-input|name",
+	},
+	{
+		name:       "TryCallExhaustedActivity",
+		function:   "test_try_call_exhausted_activity",
+		wantResult: "None|resource-exhausted",
+	},
 }
 
 type env interface {
@@ -54,19 +89,137 @@ func runTestSuite(t *testing.T, label string, build envBuilder) {
 func TestCadenceRunner(t *testing.T) {
 	runTestSuite(t, "Cadence", func(t *testing.T) env {
 		suite := &service.StarCadTestSuite{}
-		return suite.NewCadEnvironment(t, &service.StarCadTestEnvironmentParams{
+		testEnv := suite.NewCadEnvironment(t, &service.StarCadTestEnvironmentParams{
 			RootDirectory: "testdata",
 			Plugins:       map[string]service.IPlugin{Plugin.ID(): Plugin},
 		})
+		testEnv.GetTestWorkflowEnvironment().RegisterActivityWithOptions(
+			func(field string) error {
+				return cadence.NewCustomError("bad-input", map[string]any{"field": field})
+			},
+			activity.RegisterOptions{Name: "failing_activity"},
+		)
+		testEnv.GetTestWorkflowEnvironment().RegisterActivityWithOptions(
+			func() error {
+				return cadence.NewCustomError("resource-exhausted")
+			},
+			activity.RegisterOptions{Name: "exhausted_activity"},
+		)
+		return testEnv
 	})
 }
 
 func TestTemporalRunner(t *testing.T) {
 	runTestSuite(t, "Temporal", func(t *testing.T) env {
 		suite := &service.StarTempTestSuite{}
-		return suite.NewTempEnvironment(t, &service.StarTempTestEnvironmentParams{
+		testEnv := suite.NewTempEnvironment(t, &service.StarTempTestEnvironmentParams{
 			RootDirectory: "testdata",
 			Plugins:       map[string]service.IPlugin{Plugin.ID(): Plugin},
 		})
+		testEnv.GetTestWorkflowEnvironment().RegisterActivityWithOptions(
+			func(field string) error {
+				return temporal.NewNonRetryableApplicationError("bad-input", "bad-input", nil, map[string]any{"field": field})
+			},
+			tempactivity.RegisterOptions{Name: "failing_activity"},
+		)
+		testEnv.GetTestWorkflowEnvironment().RegisterActivityWithOptions(
+			func() error {
+				return temporal.NewNonRetryableApplicationError("resource-exhausted", "resource-exhausted", nil)
+			},
+			tempactivity.RegisterOptions{Name: "exhausted_activity"},
+		)
+		return testEnv
+	})
+}
+
+func TestCadenceError(t *testing.T) {
+	suite := &service.StarCadTestSuite{}
+	testEnv := suite.NewCadEnvironment(t, &service.StarCadTestEnvironmentParams{
+		RootDirectory: "testdata",
+		Plugins:       map[string]service.IPlugin{Plugin.ID(): Plugin},
 	})
+	testEnv.ExecuteFunction("/test.star", "fail_with_error", nil, nil, nil)
+	err := testEnv.GetResult(nil)
+
+	var customErr *cadence.CustomError
+	require.ErrorAs(t, err, &customErr)
+	require.Equal(t, "bad-input", customErr.Reason())
+	var details starlark.Value
+	require.NoError(t, customErr.Details(&details))
+	d, found, err := details.(*starlark.Dict).Get(starlark.String("details"))
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, `{"big": 18446744073709551616, "field": ("a", 1)}`, d.String())
+}
+
+func TestTemporalError(t *testing.T) {
+	suite := &service.StarTempTestSuite{}
+	testEnv := suite.NewTempEnvironment(t, &service.StarTempTestEnvironmentParams{
+		RootDirectory: "testdata",
+		Plugins:       map[string]service.IPlugin{Plugin.ID(): Plugin},
+	})
+	testEnv.ExecuteFunction("/test.star", "fail_with_error", nil, nil, nil)
+	err := testEnv.GetResult(nil)
+
+	var applicationErr *temporal.ApplicationError
+	require.ErrorAs(t, err, &applicationErr)
+	require.Equal(t, "bad-input", applicationErr.Type())
+	var details map[string]any
+	require.NoError(t, applicationErr.Details(&details))
+	require.Equal(t, map[string]any{
+		"big":   float64(18446744073709551616),
+		"field": map[string]any{"__codec__": "tuple", "__codec_version__": float64(1), "items": []any{"a", float64(1)}},
+	}, details["details"])
+}
+
+func TestCadenceActivityPayloadLimit(t *testing.T) {
+	suite := &service.StarCadTestSuite{}
+	testEnv := suite.NewCadEnvironment(t, &service.StarCadTestEnvironmentParams{
+		RootDirectory: "testdata",
+		Plugins:       map[string]service.IPlugin{Plugin.ID(): Plugin},
+	})
+	environ := starlark.NewDict(1)
+	require.NoError(t, environ.SetKey(starlark.String("STAR_CORE_MAX_PAYLOAD_SIZE"), starlark.String("10")))
+	testEnv.ExecuteFunction("/test.star", "execute_large_activity", starlark.Tuple{starlark.MakeInt(20)}, nil, environ)
+	err := testEnv.GetResult(nil)
+
+	var customErr *cadence.CustomError
+	require.ErrorAs(t, err, &customErr)
+	require.Equal(t, "resource-exhausted", customErr.Reason())
+	var details map[string]any
+	require.NoError(t, customErr.Details(&details))
+	require.Equal(t, "max_payload_size exceeded: activity arguments: 22 > 10 bytes", details["details"])
+}
+
+func TestCadenceTryCallLimits(t *testing.T) {
+	for _, tc := range []struct {
+		function string
+		args     starlark.Tuple
+		env      string
+		limit    string
+		details  string
+	}{
+		{"try_large_activity", starlark.Tuple{starlark.MakeInt(40)}, "STAR_CORE_MAX_PAYLOAD_SIZE", "30", "max_payload_size exceeded"},
+		{"try_spin", nil, "STAR_CORE_MAX_STEPS", "1000", "max_steps exceeded"},
+	} {
+		t.Run(tc.function, func(t *testing.T) {
+			suite := &service.StarCadTestSuite{}
+			testEnv := suite.NewCadEnvironment(t, &service.StarCadTestEnvironmentParams{
+				RootDirectory: "testdata",
+				Plugins:       map[string]service.IPlugin{Plugin.ID(): Plugin},
+			})
+			environ := starlark.NewDict(1)
+			require.NoError(t, environ.SetKey(starlark.String(tc.env), starlark.String(tc.limit)))
+			testEnv.ExecuteFunction("/test.star", tc.function, tc.args, nil, environ)
+			err := testEnv.GetResult(nil)
+
+			// Assert try_call does not handle the exceeded limit: the run fails.
+			var customErr *cadence.CustomError
+			require.ErrorAs(t, err, &customErr)
+			require.Equal(t, "resource-exhausted", customErr.Reason())
+			var details map[string]any
+			require.NoError(t, customErr.Details(&details))
+			require.Contains(t, details["details"], tc.details)
+		})
+	}
 }
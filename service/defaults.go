@@ -1,33 +1,52 @@
 package service
 
 import (
+	"slices"
+	"time"
+
 	"github.com/cadence-workflow/starlark-worker/workflow"
 	"go.uber.org/yarpc/yarpcerrors"
-	"time"
 )
 
 const noTimeout = time.Hour * 24 * 365 * 10 // 10 years, practically - no timeout
 
-var DefaultNonRetriableErrorReasons = []string{
-	"cadenceInternal:Panic",                  // panics
-	"cadenceInternal:Generic",                // cadence converter errors (similar to invalid-argument)
-	"400",                                    // bad-request https://developer.mozilla.org/en-US/docs/Web/HTTP/Status/400
-	"401",                                    // unauthorized
-	"403",                                    // forbidden
-	"404",                                    // not-found
-	"405",                                    // method-not-allowed
-	"502",                                    // bad-gateway
-	yarpcerrors.CodeCancelled.String(),       // client error
-	yarpcerrors.CodeNotFound.String(),        // client error
-	yarpcerrors.CodeAlreadyExists.String(),   // client error
-	yarpcerrors.CodeInvalidArgument.String(), // client error
-	yarpcerrors.CodeUnauthenticated.String(), // client error
+// DefaultInternalNonRetriableErrorReasons are the backend error reasons not retried by default.
+var DefaultInternalNonRetriableErrorReasons = []string{
+	"cadenceInternal:Panic",   // panics
+	"cadenceInternal:Generic", // cadence converter errors (similar to invalid-argument)
+}
+
+// DefaultHTTPNonRetriableErrorReasons are the HTTP status codes, e.g. of the request plugin, not retried by default.
+var DefaultHTTPNonRetriableErrorReasons = []string{
+	"400", // bad-request https://developer.mozilla.org/en-US/docs/Web/HTTP/Status/400
+	"401", // unauthorized
+	"403", // forbidden
+	"404", // not-found
+	"405", // method-not-allowed
+	"502", // bad-gateway
+}
+
+// DefaultYARPCNonRetriableErrorReasons are the yarpc codes not retried by default.
+var DefaultYARPCNonRetriableErrorReasons = []string{
+	yarpcerrors.CodeCancelled.String(),        // client error
+	yarpcerrors.CodeNotFound.String(),         // client error
+	yarpcerrors.CodeAlreadyExists.String(),    // client error
+	yarpcerrors.CodeInvalidArgument.String(),  // client error
+	yarpcerrors.CodeUnauthenticated.String(),  // client error
 	yarpcerrors.CodePermissionDenied.String(), // client error
 	yarpcerrors.CodeUnimplemented.String(),    // client error
 	yarpcerrors.CodeDataLoss.String(),         // server error; unrecoverable data corruption
 	yarpcerrors.CodeInternal.String(),         // server error; serious error, like panic
 }
 
+// DefaultNonRetriableErrorReasons are the error reasons not retried by default. The worker (Service.Retry) and
+// packages (meta.json "non_retriable_reasons") may replace them.
+var DefaultNonRetriableErrorReasons = slices.Concat(
+	DefaultInternalNonRetriableErrorReasons,
+	DefaultHTTPNonRetriableErrorReasons,
+	DefaultYARPCNonRetriableErrorReasons,
+)
+
 var DefaultRetryPolicy = workflow.RetryPolicy{
 	InitialInterval:          time.Second * 15,
 	BackoffCoefficient:       1,
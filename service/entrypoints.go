@@ -0,0 +1,421 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cadence-workflow/starlark-worker/star"
+	"github.com/cadence-workflow/starlark-worker/workflow"
+	jsoniter "github.com/json-iterator/go"
+	"go.starlark.net/starlark"
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+// AnyType is the parameter type accepting values of any type.
+const AnyType = "any"
+
+// parameterTypes are the Starlark types of the values a parameter may declare, besides AnyType.
+var parameterTypes = map[string]bool{
+	"NoneType": true,
+	"bool":     true,
+	"bytes":    true,
+	"dict":     true,
+	"float":    true,
+	"int":      true,
+	"list":     true,
+	"set":      true,
+	"string":   true,
+	"tuple":    true,
+}
+
+// Entrypoint is a function of the package declared in the meta.json "entrypoints" section, keyed by name.
+type Entrypoint struct {
+	// File defaults to Meta.MainFile.
+	File string `json:"file,omitempty"`
+	// Function defaults to the entrypoint name.
+	Function    string `json:"function,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Parameters is the schema the run arguments are checked against. Nil means no check, an empty list means
+	// the function takes no arguments.
+	Parameters []Parameter `json:"parameters"`
+	// Environ are the default values of the run environ.
+	Environ map[string]string `json:"environ,omitempty"`
+	// Plugins are the IDs of the plugins the entrypoint requires from the worker.
+	Plugins  []string `json:"plugins,omitempty"`
+	Timeouts Timeouts `json:"timeouts"`
+}
+
+// Parameter is a parameter of an Entrypoint.
+type Parameter struct {
+	Name string `json:"name"`
+	// Type is the Starlark type of the value, e.g. "string", "int" or "dict", or AnyType (default).
+	// Int values are accepted for float parameters.
+	Type string `json:"type,omitempty"`
+	// Default is the JSON-encoded value (see star.Decode) passed as a keyword argument if the parameter is not set.
+	Default  json.RawMessage `json:"default,omitempty"`
+	Required bool            `json:"required,omitempty"`
+}
+
+// Timeouts of an Entrypoint run.
+type Timeouts struct {
+	// Execution is the run timeout the clients start the workflow with.
+	Execution Duration `json:"execution,omitempty"`
+	// Activity overrides the package activity timeouts, see RetryConfig.DefaultActivityOptions.
+	Activity *ActivityOptions `json:"activity,omitempty"`
+}
+
+// ReadMeta returns the package meta.json, or an empty Meta if the package has none.
+func ReadMeta(fs star.FS) (Meta, error) {
+	meta := Meta{}
+	b, err := fs.Read("/" + star.MetaFile)
+	if err != nil {
+		if errors.Is(err, star.ErrNotExist) || errors.Is(err, os.ErrNotExist) {
+			return meta, nil
+		}
+		return meta, err
+	}
+	if err := jsoniter.Unmarshal(b, &meta); err != nil {
+		return meta, fmt.Errorf("%s: %w", star.MetaFile, err)
+	}
+	return meta, nil
+}
+
+// PackageMeta returns the meta.json of the package. Package references (see PackageRef) have an empty Meta.
+func PackageMeta(tar []byte) (Meta, error) {
+	if _, isRef := ParsePackageRef(tar); isRef {
+		return Meta{}, nil
+	}
+	fs, err := star.NewTarFS(tar)
+	if err != nil {
+		return Meta{}, err
+	}
+	return ReadMeta(fs)
+}
+
+// LoadMeta returns the validated meta.json of the package file, directory, or "-" (single hyphen) to read the
+// package from stdin. Used by the clients' "entrypoints" target.
+func LoadMeta(pkg string) (Meta, error) {
+	var meta Meta
+	var err error
+	if pkg == "-" {
+		var b []byte
+		if b, err = io.ReadAll(os.Stdin); err == nil {
+			meta, err = PackageMeta(b)
+		}
+	} else if fi, statErr := os.Stat(pkg); statErr != nil {
+		err = statErr
+	} else if fi.IsDir() {
+		meta, err = ReadMeta(&star.LocalFS{Root: pkg})
+	} else {
+		var b []byte
+		if b, err = os.ReadFile(pkg); err == nil {
+			meta, err = PackageMeta(b)
+		}
+	}
+	if err != nil {
+		return meta, err
+	}
+	return meta, meta.Validate()
+}
+
+// PrintEntrypoints prints the signature of each declared entrypoint, followed by its file, function and the
+// other declared properties.
+func PrintEntrypoints(w io.Writer, meta Meta) {
+	if len(meta.Entrypoints) == 0 {
+		_, _ = fmt.Fprintf(w, "No entrypoints declared in %s. main_file: %q, main_function: %q\n", star.MetaFile, meta.MainFile, meta.MainFunction)
+		return
+	}
+	for _, name := range meta.EntrypointNames() {
+		file, function, ep := meta.Entrypoint("", name)
+		_, _ = fmt.Fprintln(w, ep.Signature(name))
+		_, _ = fmt.Fprintf(w, "    file: %s, function: %s\n", file, function)
+		if ep.Description != "" {
+			_, _ = fmt.Fprintf(w, "    description: %s\n", ep.Description)
+		}
+		if len(ep.Plugins) > 0 {
+			_, _ = fmt.Fprintf(w, "    plugins: %s\n", strings.Join(ep.Plugins, ", "))
+		}
+		keys := make([]string, 0, len(ep.Environ))
+		for k := range ep.Environ {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			_, _ = fmt.Fprintf(w, "    environ: %s=%s\n", k, ep.Environ[k])
+		}
+		if ep.Timeouts.Execution > 0 {
+			_, _ = fmt.Fprintf(w, "    timeout: %s\n", time.Duration(ep.Timeouts.Execution))
+		}
+	}
+}
+
+// EntrypointFile returns the local path of the file of the entrypoint declared in the meta.json of the package
+// directory.
+func EntrypointFile(dir string, entrypoint string) (string, error) {
+	meta, err := ReadMeta(&star.LocalFS{Root: dir})
+	if err != nil {
+		return "", err
+	}
+	file, _, ep := meta.Entrypoint("", entrypoint)
+	if ep == nil {
+		return "", fmt.Errorf("entrypoint not declared in %s: %s", star.MetaFile, entrypoint)
+	}
+	return filepath.Join(dir, filepath.FromSlash(strings.TrimPrefix(file, "/"))), nil
+}
+
+// ExecutionTimeout returns the execution timeout declared by the entrypoint the run of the given file and
+// function calls, see Meta.Entrypoint. Returns 0 if none is declared.
+func ExecutionTimeout(tar []byte, file string, function string) time.Duration {
+	meta, err := PackageMeta(tar)
+	if err != nil {
+		return 0
+	}
+	if _, _, ep := meta.Entrypoint(file, function); ep != nil {
+		return time.Duration(ep.Timeouts.Execution)
+	}
+	return 0
+}
+
+// EntrypointNames returns the names of the declared entrypoints, sorted.
+func (r Meta) EntrypointNames() []string {
+	names := make([]string, 0, len(r.Entrypoints))
+	for name := range r.Entrypoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Entrypoint returns the file and function a run calls, and the declared entrypoint they match, if any.
+// A function without a file is the name of a declared entrypoint, if any. Otherwise, the file and function
+// default to MainFile and MainFunction.
+func (r Meta) Entrypoint(file string, function string) (string, string, *Entrypoint) {
+	if file == "" {
+		if ep, found := r.Entrypoints[function]; found && function != "" {
+			return r.entrypointFile(ep), entrypointFunction(function, ep), &ep
+		}
+		file = r.MainFile
+	}
+	if function == "" {
+		function = r.MainFunction
+	}
+	for _, name := range r.EntrypointNames() {
+		ep := r.Entrypoints[name]
+		if cleanPath(r.entrypointFile(ep)) == cleanPath(file) && entrypointFunction(name, ep) == function {
+			return file, function, &ep
+		}
+	}
+	return file, function, nil
+}
+
+func (r Meta) entrypointFile(ep Entrypoint) string {
+	if ep.File != "" {
+		return ep.File
+	}
+	return r.MainFile
+}
+
+func entrypointFunction(name string, ep Entrypoint) string {
+	if ep.Function != "" {
+		return ep.Function
+	}
+	return name
+}
+
+func cleanPath(p string) string {
+	return path.Clean("/" + p)
+}
+
+// Validate checks the declared entrypoints: files, parameter names, types and defaults.
+func (r Meta) Validate() error {
+	var errs []error
+	for _, name := range r.EntrypointNames() {
+		ep := r.Entrypoints[name]
+		if r.entrypointFile(ep) == "" {
+			errs = append(errs, fmt.Errorf("entrypoint %s: file is required", name))
+		}
+		seen := map[string]bool{}
+		for _, p := range ep.Parameters {
+			if p.Name == "" {
+				errs = append(errs, fmt.Errorf("entrypoint %s: parameter name is required", name))
+				continue
+			}
+			if seen[p.Name] {
+				errs = append(errs, fmt.Errorf("entrypoint %s: duplicate parameter: %s", name, p.Name))
+			}
+			seen[p.Name] = true
+			if p.Type != "" && p.Type != AnyType && !parameterTypes[p.Type] {
+				errs = append(errs, fmt.Errorf("entrypoint %s: parameter %s: unknown type: %s", name, p.Name, p.Type))
+				continue
+			}
+			if p.Default != nil {
+				v, err := p.defaultValue()
+				if err != nil {
+					errs = append(errs, fmt.Errorf("entrypoint %s: parameter %s: default: %w", name, p.Name, err))
+				} else if err := p.check(v); err != nil {
+					errs = append(errs, fmt.Errorf("entrypoint %s: default: %w", name, err))
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Bind checks the run arguments against the parameters and returns the keyword arguments along with the
+// defaults of the parameters not set.
+func (r *Entrypoint) Bind(args starlark.Tuple, kwargs []starlark.Tuple) ([]starlark.Tuple, error) {
+	if r.Parameters == nil {
+		return kwargs, nil
+	}
+	var errs []error
+	set := make(map[string]bool, len(args)+len(kwargs))
+	for i, arg := range args {
+		if i >= len(r.Parameters) {
+			errs = append(errs, fmt.Errorf("too many positional arguments: %d > %d", len(args), len(r.Parameters)))
+			break
+		}
+		p := r.Parameters[i]
+		set[p.Name] = true
+		if err := p.check(arg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, kv := range kwargs {
+		name, _ := starlark.AsString(kv[0])
+		p, found := r.parameter(name)
+		if !found {
+			errs = append(errs, fmt.Errorf("unexpected keyword argument: %s", name))
+			continue
+		}
+		if set[name] {
+			errs = append(errs, fmt.Errorf("multiple values for parameter: %s", name))
+			continue
+		}
+		set[name] = true
+		if err := p.check(kv[1]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, p := range r.Parameters {
+		if set[p.Name] {
+			continue
+		}
+		if p.Required {
+			errs = append(errs, fmt.Errorf("missing required parameter: %s", p.Name))
+		} else if p.Default != nil {
+			v, err := p.defaultValue()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("parameter %s: default: %w", p.Name, err))
+				continue
+			}
+			kwargs = append(kwargs, starlark.Tuple{starlark.String(p.Name), v})
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return kwargs, nil
+}
+
+// Signature returns the entrypoint call signature, e.g. "deploy(env: string, replicas: int = 1, dry_run?: bool)".
+// Optional parameters without a default are suffixed with "?".
+func (r *Entrypoint) Signature(name string) string {
+	params := make([]string, len(r.Parameters))
+	for i, p := range r.Parameters {
+		typ := p.Type
+		if typ == "" {
+			typ = AnyType
+		}
+		switch {
+		case p.Required:
+			params[i] = fmt.Sprintf("%s: %s", p.Name, typ)
+		case p.Default != nil:
+			params[i] = fmt.Sprintf("%s: %s = %s", p.Name, typ, p.Default)
+		default:
+			params[i] = fmt.Sprintf("%s?: %s", p.Name, typ)
+		}
+	}
+	if r.Parameters == nil {
+		params = []string{"..."}
+	}
+	return fmt.Sprintf("%s(%s)", name, strings.Join(params, ", "))
+}
+
+func (r *Entrypoint) parameter(name string) (Parameter, bool) {
+	for _, p := range r.Parameters {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Parameter{}, false
+}
+
+func (r Parameter) defaultValue() (starlark.Value, error) {
+	var v starlark.Value
+	if err := star.Decode(r.Default, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// check fails if the value is not of the parameter type.
+func (r Parameter) check(v starlark.Value) error {
+	if r.Type == "" || r.Type == AnyType || v.Type() == r.Type {
+		return nil
+	}
+	if _, isInt := v.(starlark.Int); isInt && r.Type == "float" {
+		return nil
+	}
+	return fmt.Errorf("parameter %s: got %s, want %s", r.Name, v.Type(), r.Type)
+}
+
+// _Call is the function a Run execution calls: a file and function, or the name of a declared entrypoint.
+type _Call struct {
+	path       string
+	function   string
+	entrypoint *Entrypoint
+}
+
+// resolve sets the file and function of the call, see Meta.Entrypoint. The environ defaults of the matching
+// entrypoint, if any, are added to the environ; the plugins it requires must be provided by the worker.
+func (r *_Call) resolve(ctx workflow.Context, meta Meta, environ *starlark.Dict, plugins map[string]IPlugin) error {
+	r.path, r.function, r.entrypoint = meta.Entrypoint(r.path, r.function)
+	if r.entrypoint == nil {
+		return nil
+	}
+	var missing []string
+	for _, id := range r.entrypoint.Plugins {
+		if _, found := plugins[id]; !found {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		return workflow.NewCustomError(
+			ctx,
+			yarpcerrors.CodeUnimplemented.String(),
+			fmt.Sprintf("%s: plugins not provided by the worker: %s", r.function, strings.Join(missing, ", ")),
+		)
+	}
+	keys := make([]string, 0, len(r.entrypoint.Environ))
+	for k := range r.entrypoint.Environ {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if _, found, _ := environ.Get(starlark.String(k)); found {
+			continue
+		}
+		if err := environ.SetKey(starlark.String(k), starlark.String(r.entrypoint.Environ[k])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cadence-workflow/starlark-worker/ext"
+	"github.com/stretchr/testify/require"
+	"go.starlark.net/starlark"
+	cad "go.uber.org/cadence"
+)
+
+const entrypointsMeta = `{
+	"main_file": "/main.star",
+	"main_function": "main",
+	"entrypoints": {
+		"greet": {
+			"description": "Greets the given name",
+			"parameters": [
+				{"name": "name", "type": "string", "required": true},
+				{"name": "times", "type": "int", "default": 1},
+				{"name": "suffix", "type": "string"}
+			],
+			"environ": {"GREETING": "hello"},
+			"timeouts": {"execution": "1h"}
+		},
+		"sum": {"file": "lib/math.star", "function": "add", "parameters": [{"name": "values", "type": "list", "default": []}]},
+		"custom": {"function": "main", "plugins": ["testplugin", "unknown"]}
+	}
+}`
+
+func TestMetaEntrypoint(t *testing.T) {
+	var meta Meta
+	require.NoError(t, ext.JSON.Unmarshal([]byte(entrypointsMeta), &meta))
+	require.NoError(t, meta.Validate())
+	require.Equal(t, []string{"custom", "greet", "sum"}, meta.EntrypointNames())
+
+	file, function, ep := meta.Entrypoint("", "greet")
+	require.Equal(t, "/main.star", file)
+	require.Equal(t, "greet", function)
+	require.Equal(t, "Greets the given name", ep.Description)
+
+	file, function, ep = meta.Entrypoint("", "sum")
+	require.Equal(t, "lib/math.star", file)
+	require.Equal(t, "add", function)
+	require.NotNil(t, ep)
+
+	// file and function matching a declared entrypoint
+	_, _, ep = meta.Entrypoint("/lib/math.star", "add")
+	require.NotNil(t, ep)
+	file, function, ep = meta.Entrypoint("", "")
+	require.Equal(t, "/main.star", file)
+	require.Equal(t, "main", function)
+	require.Equal(t, []string{"testplugin", "unknown"}, ep.Plugins)
+
+	// not declared
+	file, function, ep = meta.Entrypoint("", "other")
+	require.Equal(t, "/main.star", file)
+	require.Equal(t, "other", function)
+	require.Nil(t, ep)
+}
+
+func TestEntrypointBind(t *testing.T) {
+	var meta Meta
+	require.NoError(t, ext.JSON.Unmarshal([]byte(entrypointsMeta), &meta))
+	ep := meta.Entrypoints["greet"]
+	require.Equal(t, "greet(name: string, times: int = 1, suffix?: string)", ep.Signature("greet"))
+
+	kwargs, err := ep.Bind(starlark.Tuple{starlark.String("bob")}, nil)
+	require.NoError(t, err)
+	require.Equal(t, []starlark.Tuple{{starlark.String("times"), starlark.MakeInt(1)}}, kwargs)
+
+	kwargs, err = ep.Bind(nil, []starlark.Tuple{{starlark.String("name"), starlark.String("bob")}, {starlark.String("times"), starlark.MakeInt(3)}})
+	require.NoError(t, err)
+	require.Len(t, kwargs, 2)
+
+	_, err = ep.Bind(starlark.Tuple{starlark.MakeInt(1)}, []starlark.Tuple{{starlark.String("name"), starlark.String("bob")}, {starlark.String("color"), starlark.String("red")}})
+	require.EqualError(t, err, "parameter name: got int, want string\nmultiple values for parameter: name\nunexpected keyword argument: color")
+
+	_, err = ep.Bind(starlark.Tuple{starlark.String("a"), starlark.MakeInt(1), starlark.String("b"), starlark.None}, nil)
+	require.EqualError(t, err, "too many positional arguments: 4 > 3")
+
+	_, err = ep.Bind(nil, nil)
+	require.EqualError(t, err, "missing required parameter: name")
+
+	// no parameters declared: no check
+	custom := meta.Entrypoints["custom"]
+	kwargs, err = custom.Bind(starlark.Tuple{starlark.MakeInt(1)}, []starlark.Tuple{{starlark.String("any"), starlark.None}})
+	require.NoError(t, err)
+	require.Len(t, kwargs, 1)
+}
+
+func TestCallResolveEnviron(t *testing.T) {
+	var meta Meta
+	require.NoError(t, ext.JSON.Unmarshal([]byte(entrypointsMeta), &meta))
+
+	environ := limitsEnviron("OTHER", "1")
+	call := &_Call{function: "greet"}
+	require.NoError(t, call.resolve(nil, meta, environ, nil))
+	require.Equal(t, `{"OTHER": "1", "GREETING": "hello"}`, environ.String())
+
+	environ = limitsEnviron("GREETING", "hi")
+	require.NoError(t, call.resolve(nil, meta, environ, nil))
+	require.Equal(t, `{"GREETING": "hi"}`, environ.String())
+}
+
+func TestMetaValidate(t *testing.T) {
+	var meta Meta
+	require.NoError(t, ext.JSON.Unmarshal([]byte(`{"entrypoints": {
+		"a": {"parameters": [{"name": "x", "type": "integer"}, {"name": "x"}, {"type": "int"}]},
+		"b": {"file": "/b.star", "parameters": [{"name": "y", "type": "float", "default": "1.0"}]}
+	}}`), &meta))
+	require.EqualError(t, meta.Validate(), "entrypoint a: file is required\n"+
+		"entrypoint a: parameter x: unknown type: integer\n"+
+		"entrypoint a: duplicate parameter: x\n"+
+		"entrypoint a: parameter name is required\n"+
+		"entrypoint b: default: parameter y: got string, want float")
+}
+
+func TestLoadMeta(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "meta.json"), []byte(entrypointsMeta), 0o644))
+	tar, err := writeTestTar(map[string]string{"meta.json": entrypointsMeta})
+	require.NoError(t, err)
+	tarFile := filepath.Join(t.TempDir(), "package.tar")
+	require.NoError(t, os.WriteFile(tarFile, tar, 0o644))
+
+	for _, pkg := range []string{dir, tarFile} {
+		meta, err := LoadMeta(pkg)
+		require.NoError(t, err)
+		require.Equal(t, []string{"custom", "greet", "sum"}, meta.EntrypointNames())
+	}
+	_, err = LoadMeta(filepath.Join(dir, "missing"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	file, err := EntrypointFile(dir, "sum")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "lib", "math.star"), file)
+	_, err = EntrypointFile(dir, "other")
+	require.EqualError(t, err, "entrypoint not declared in meta.json: other")
+
+	meta, err := LoadMeta(dir)
+	require.NoError(t, err)
+	var out bytes.Buffer
+	PrintEntrypoints(&out, meta)
+	require.Contains(t, out.String(), "    file: lib/math.star, function: add\n")
+	require.Contains(t, out.String(), "    environ: GREETING=hello\n    timeout: 1h0m0s\n")
+	out.Reset()
+	PrintEntrypoints(&out, Meta{MainFile: "/main.star"})
+	require.Equal(t, "No entrypoints declared in meta.json. main_file: \"/main.star\", main_function: \"\"\n", out.String())
+}
+
+func (r *CadTest) TestCadEntrypoints() {
+	main := "def main(*args, **kwargs):\n    return args\n\n" +
+		"def greet(name, times = 0, suffix = \"!\"):\n    return \" \".join([\"hello \" + name + suffix] * times)\n"
+	for _, tc := range []struct {
+		name     string
+		file     string
+		function string
+		args     starlark.Tuple
+		kwargs   []starlark.Tuple
+		res      starlark.Value
+		reason   string
+		err      string
+	}{
+		{name: "by name", function: "greet", args: starlark.Tuple{starlark.String("bob")}, res: starlark.String("hello bob!")},
+		{name: "by file and function", file: "/main.star", function: "greet", args: starlark.Tuple{starlark.String("bob")}, kwargs: []starlark.Tuple{{starlark.String("times"), starlark.MakeInt(2)}}, res: starlark.String("hello bob! hello bob!")},
+		{name: "invalid arguments", function: "greet", args: starlark.Tuple{starlark.MakeInt(1)}, reason: "invalid-argument", err: "greet: invalid arguments: parameter name: got int, want string"},
+		{name: "missing argument", function: "greet", reason: "invalid-argument", err: "greet: invalid arguments: missing required parameter: name"},
+		{name: "missing plugins", function: "custom", reason: "unimplemented", err: "main: plugins not provided by the worker: unknown"},
+	} {
+		r.Run(tc.name, func() {
+			r.SetupTest()
+			tar, err := writeTestTar(map[string]string{"meta.json": entrypointsMeta, "main.star": main})
+			r.Require().NoError(err)
+			r.env.tar = tar
+			r.env.ExecuteFunction(tc.file, tc.function, tc.args, tc.kwargs, nil)
+
+			var res starlark.Value
+			err = r.env.GetResult(&res)
+			if tc.err == "" {
+				r.Require().NoError(err)
+				r.Require().Equal(tc.res, res)
+				return
+			}
+			var customErr *cad.CustomError
+			r.Require().True(errors.As(err, &customErr), "unexpected error: %v", err)
+			r.Require().Equal(tc.reason, customErr.Reason())
+			var details any
+			r.Require().NoError(customErr.Details(&details))
+			r.Require().Contains(fmt.Sprint(details), tc.err)
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/cadence-workflow/starlark-worker/star"
+	"github.com/cadence-workflow/starlark-worker/workflow"
+	"go.starlark.net/starlark"
+	"go.uber.org/yarpc/yarpcerrors"
+	"go.uber.org/zap"
+)
+
+const (
+	envMaxStepsPerDecision = starlark.String("STAR_CORE_MAX_STEPS_PER_DECISION")
+	envMaxSteps            = starlark.String("STAR_CORE_MAX_STEPS")
+	envMaxRecursionDepth   = starlark.String("STAR_CORE_MAX_RECURSION_DEPTH")
+	envMaxPayloadSize      = starlark.String("STAR_CORE_MAX_PAYLOAD_SIZE")
+
+	// stepCheckRatio is the number of per-decision budget checks made within a single decision budget.
+	stepCheckRatio = 10
+)
+
+// Limits are execution budgets applied to starlark scripts. Zero values mean no limit.
+// The worker sets the limits via Service.Limits; a package (meta.json "limits" section) and the run environ
+// (STAR_CORE_MAX_* variables) may only tighten them.
+type Limits struct {
+	// MaxStepsPerDecision limits the starlark computation steps a thread executes within a single decision task,
+	// i.e. between two blocking calls. The budget is checked every MaxStepsPerDecision/10 steps, so the effective
+	// limit may be up to 10% stricter.
+	MaxStepsPerDecision uint64 `json:"max_steps_per_decision,omitempty"`
+	// MaxSteps limits the total starlark computation steps a thread executes during the run.
+	MaxSteps uint64 `json:"max_steps,omitempty"`
+	// MaxRecursionDepth limits the call stack depth of a thread. The depth is checked every MaxRecursionDepth
+	// steps, so a stack can not grow beyond twice the limit unnoticed.
+	MaxRecursionDepth int `json:"max_recursion_depth,omitempty"`
+	// MaxPayloadSize limits the size (bytes) of the encoded run arguments and result, and of the encoded
+	// arguments of the activities and child workflows a script executes (see CheckPayloadSize).
+	MaxPayloadSize int `json:"max_payload_size,omitempty"`
+}
+
+// Tighten returns the limits with each field replaced by the corresponding field of o if the latter is stricter.
+func (r Limits) Tighten(o Limits) Limits {
+	if o.MaxStepsPerDecision > 0 && (r.MaxStepsPerDecision == 0 || o.MaxStepsPerDecision < r.MaxStepsPerDecision) {
+		r.MaxStepsPerDecision = o.MaxStepsPerDecision
+	}
+	if o.MaxSteps > 0 && (r.MaxSteps == 0 || o.MaxSteps < r.MaxSteps) {
+		r.MaxSteps = o.MaxSteps
+	}
+	if o.MaxRecursionDepth > 0 && (r.MaxRecursionDepth == 0 || o.MaxRecursionDepth < r.MaxRecursionDepth) {
+		r.MaxRecursionDepth = o.MaxRecursionDepth
+	}
+	if o.MaxPayloadSize > 0 && (r.MaxPayloadSize == 0 || o.MaxPayloadSize < r.MaxPayloadSize) {
+		r.MaxPayloadSize = o.MaxPayloadSize
+	}
+	return r
+}
+
+// getEnvironLimits returns the limits configured by the STAR_CORE_MAX_* environ. Invalid values are ignored.
+func getEnvironLimits(ctx workflow.Context, globals *_Globals) Limits {
+	parse := func(key starlark.String) uint64 {
+		v, found := globals.getEnviron(key)
+		if !found {
+			return 0
+		}
+		n, err := strconv.ParseUint(v.GoString(), 10, 63)
+		if err != nil {
+			workflow.GetLogger(ctx).Error("invalid environ", zap.String("environ_name", key.GoString()), zap.String("environ_value", v.GoString()))
+			return 0
+		}
+		return n
+	}
+	return Limits{
+		MaxStepsPerDecision: parse(envMaxStepsPerDecision),
+		MaxSteps:            parse(envMaxSteps),
+		MaxRecursionDepth:   int(parse(envMaxRecursionDepth)),
+		MaxPayloadSize:      int(parse(envMaxPayloadSize)),
+	}
+}
+
+// CheckPayloadSize fails with the CodeResourceExhausted reason if the encoded values exceed the MaxPayloadSize
+// limit of the run, e.g. the arguments of an activity a plugin executes. The error is recorded as the exceeded
+// limit of the run, see IsLimitError.
+func CheckPayloadSize(t *starlark.Thread, name string, values ...starlark.Value) error {
+	ctx := GetContext(t)
+	globals := getGlobals(ctx)
+	err := checkPayloadSize(ctx, globals.limits, name, values...)
+	if err != nil && globals.limitErr == nil {
+		globals.limitErr = err
+	}
+	return err
+}
+
+// checkPayloadSize fails with the CodeResourceExhausted reason if the encoded values exceed MaxPayloadSize.
+func checkPayloadSize(ctx workflow.Context, limits Limits, name string, values ...starlark.Value) error {
+	if limits.MaxPayloadSize == 0 {
+		return nil
+	}
+	var size int
+	for _, v := range values {
+		b, err := star.Encode(v)
+		if err != nil {
+			return err
+		}
+		size += len(b)
+	}
+	if size > limits.MaxPayloadSize {
+		return workflow.NewCustomError(
+			ctx,
+			yarpcerrors.CodeResourceExhausted.String(),
+			fmt.Sprintf("max_payload_size exceeded: %s: %d > %d bytes", name, size, limits.MaxPayloadSize),
+		)
+	}
+	return nil
+}
+
+// _StepBudget enforces the step and call depth limits of a thread. It is invoked by the interpreter via
+// Thread.OnMaxSteps at every checkpoint.
+type _StepBudget struct {
+	limits        Limits
+	interval      uint64
+	decisionTime  time.Time
+	decisionStart uint64
+	lastCheck     uint64
+	// offset is the number of steps the thread executed before the budget was reset, see resetStepBudget.
+	offset uint64
+	// exceeded is set once the budget cancelled the thread.
+	exceeded bool
+}
+
+// setStepBudget applies the step and call depth limits to the given thread, if any.
+func setStepBudget(t *starlark.Thread, limits Limits) {
+	var interval uint64
+	if limits.MaxStepsPerDecision > 0 {
+		interval = max(limits.MaxStepsPerDecision/stepCheckRatio, 1)
+	}
+	if d := uint64(limits.MaxRecursionDepth); d > 0 && (interval == 0 || d < interval) {
+		interval = d
+	}
+	if interval == 0 && limits.MaxSteps == 0 {
+		return
+	}
+	b := &_StepBudget{limits: limits, interval: interval}
+	t.OnMaxSteps = b.check
+	t.SetLocal(threadLocalStepBudgetKey, b)
+	t.SetMaxExecutionSteps(b.next(0))
+}
+
+// resetStepBudget restarts the step budget of the thread, if any, e.g. before the next REPL chunk.
+func resetStepBudget(t *starlark.Thread) {
+	if b, ok := t.Local(threadLocalStepBudgetKey).(*_StepBudget); ok {
+		b.offset = t.ExecutionSteps()
+		b.decisionStart, b.lastCheck = 0, 0
+		b.exceeded = false
+		t.SetMaxExecutionSteps(b.offset + b.next(0))
+	}
+}
+
+func (r *_StepBudget) check(t *starlark.Thread) {
+	steps := t.ExecutionSteps() - r.offset
+	if r.limits.MaxSteps > 0 && steps >= r.limits.MaxSteps {
+		r.fail(t, fmt.Sprintf("max_steps exceeded: %d", r.limits.MaxSteps))
+		return
+	}
+	if r.limits.MaxRecursionDepth > 0 && t.CallStackDepth() > r.limits.MaxRecursionDepth {
+		r.fail(t, fmt.Sprintf("max_recursion_depth exceeded: %d > %d", t.CallStackDepth(), r.limits.MaxRecursionDepth))
+		return
+	}
+	if r.limits.MaxStepsPerDecision > 0 {
+		// Workflow time is the start time of the current decision task: a change means the thread has been
+		// blocked in between. The steps since the last checkpoint are attributed to the new decision.
+		if now := workflow.Now(GetContext(t)); !now.Equal(r.decisionTime) {
+			r.decisionTime = now
+			r.decisionStart = r.lastCheck
+		}
+		if steps-r.decisionStart >= r.limits.MaxStepsPerDecision {
+			r.fail(t, fmt.Sprintf("max_steps_per_decision exceeded: %d", r.limits.MaxStepsPerDecision))
+			return
+		}
+	}
+	r.lastCheck = steps
+	t.SetMaxExecutionSteps(r.offset + r.next(steps))
+}
+
+func (r *_StepBudget) next(steps uint64) uint64 {
+	n := uint64(math.MaxUint64)
+	if r.interval > 0 {
+		n = steps + r.interval
+	}
+	if r.limits.MaxSteps > 0 && r.limits.MaxSteps < n {
+		n = r.limits.MaxSteps
+	}
+	return n
+}
+
+// IsLimitError reports whether the error is due to an exceeded limit of the run, see Limits: the limit error
+// itself, or any error of a thread the step budget cancelled. The run fails with the CodeResourceExhausted
+// reason, whatever the caller does. Errors of the same reason returned by activities or child workflows are not
+// limit errors.
+func IsLimitError(t *starlark.Thread, err error) bool {
+	if b, ok := t.Local(threadLocalStepBudgetKey).(*_StepBudget); ok && b.exceeded {
+		return true
+	}
+	limitErr := getGlobals(GetContext(t)).limitErr
+	return limitErr != nil && errors.Is(err, limitErr)
+}
+
+// fail cancels the thread and records the CodeResourceExhausted error, which becomes the run failure reason.
+func (r *_StepBudget) fail(t *starlark.Thread, msg string) {
+	ctx := GetContext(t)
+	if globals := getGlobals(ctx); globals.limitErr == nil {
+		workflow.GetLogger(ctx).Error("limit-exceeded", zap.String("thread", t.Name), zap.String("limit", msg))
+		globals.limitErr = workflow.NewCustomError(ctx, yarpcerrors.CodeResourceExhausted.String(), msg)
+	}
+	r.exceeded = true
+	t.Cancel(msg)
+}
+
+func kwargsTuple(kwargs []starlark.Tuple) starlark.Tuple {
+	res := make(starlark.Tuple, len(kwargs))
+	for i, kv := range kwargs {
+		res[i] = kv
+	}
+	return res
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.starlark.net/starlark"
+	temp "go.temporal.io/sdk/temporal"
+	cad "go.uber.org/cadence"
+)
+
+func TestLimitsTighten(t *testing.T) {
+	worker := Limits{MaxStepsPerDecision: 1000, MaxSteps: 5000, MaxPayloadSize: 100}
+	res := worker.Tighten(Limits{MaxStepsPerDecision: 2000, MaxSteps: 10, MaxRecursionDepth: 50})
+	require.Equal(t, Limits{MaxStepsPerDecision: 1000, MaxSteps: 10, MaxRecursionDepth: 50, MaxPayloadSize: 100}, res)
+	require.Equal(t, worker, worker.Tighten(Limits{}))
+}
+
+func limitsEnviron(kv ...string) *starlark.Dict {
+	environ := &starlark.Dict{}
+	for i := 0; i < len(kv); i += 2 {
+		_ = environ.SetKey(starlark.String(kv[i]), starlark.String(kv[i+1]))
+	}
+	return environ
+}
+
+var limitsTestCases = []struct {
+	name    string
+	fn      string
+	args    starlark.Tuple
+	environ *starlark.Dict
+	err     string
+}{
+	{
+		name:    "within limits",
+		fn:      "spin",
+		args:    starlark.Tuple{starlark.MakeInt(10)},
+		environ: limitsEnviron(envMaxSteps.GoString(), "10000", envMaxStepsPerDecision.GoString(), "1000"),
+	},
+	{
+		name:    "max steps",
+		fn:      "spin",
+		args:    starlark.Tuple{starlark.MakeInt(100000)},
+		environ: limitsEnviron(envMaxSteps.GoString(), "10000"),
+		err:     "max_steps exceeded: 10000",
+	},
+	{
+		name:    "max steps per decision",
+		fn:      "spin",
+		args:    starlark.Tuple{starlark.MakeInt(100000)},
+		environ: limitsEnviron(envMaxStepsPerDecision.GoString(), "1000"),
+		err:     "max_steps_per_decision exceeded: 1000",
+	},
+	{
+		name:    "max payload size: arguments",
+		fn:      "echo",
+		args:    starlark.Tuple{starlark.String("0123456789")},
+		environ: limitsEnviron(envMaxPayloadSize.GoString(), "10"),
+		err:     "max_payload_size exceeded: arguments",
+	},
+	{
+		name:    "max payload size: result",
+		fn:      "repeat",
+		args:    starlark.Tuple{starlark.MakeInt(20)},
+		environ: limitsEnviron(envMaxPayloadSize.GoString(), "10"),
+		err:     "max_payload_size exceeded: result: 22 > 10 bytes",
+	},
+}
+
+func (r *CadTest) TestCadLimits() {
+	for _, tc := range limitsTestCases {
+		r.Run(tc.name, func() {
+			r.SetupTest()
+			r.env.ExecuteFunction("/limits.star", tc.fn, tc.args, nil, tc.environ)
+			var res starlark.Value
+			err := r.env.GetResult(&res)
+			if tc.err == "" {
+				r.Require().NoError(err)
+				return
+			}
+			var customErr *cad.CustomError
+			r.Require().True(errors.As(err, &customErr), "unexpected error: %v", err)
+			r.Require().Equal("resource-exhausted", customErr.Reason())
+			var details map[string]any
+			r.Require().NoError(customErr.Details(&details))
+			r.Require().Contains(details["details"], tc.err)
+		})
+	}
+}
+
+func (r *TempTest) TestTempLimits() {
+	for _, tc := range limitsTestCases {
+		r.Run(tc.name, func() {
+			r.SetupTest()
+			r.env.ExecuteFunction("/limits.star", tc.fn, tc.args, nil, tc.environ)
+			var res starlark.Value
+			err := r.env.GetResult(&res)
+			if tc.err == "" {
+				r.Require().NoError(err)
+				return
+			}
+			var appErr *temp.ApplicationError
+			r.Require().True(errors.As(err, &appErr), "unexpected error: %v", err)
+			r.Require().Equal("resource-exhausted", appErr.Type())
+			var details map[string]any
+			r.Require().NoError(appErr.Details(&details))
+			r.Require().Contains(details["details"], tc.err)
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"container/list"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cadence-workflow/starlark-worker/ext"
+	"github.com/cadence-workflow/starlark-worker/star"
+	"github.com/cadence-workflow/starlark-worker/workflow"
+	jsoniter "github.com/json-iterator/go"
+	"go.starlark.net/starlark"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	envLogLen     = starlark.String("STAR_CORE_LOG_LEN")
+	defaultLogLen = 1000
+
+	// LogsQueryName is the query returning the messages ([]string) of the buffered log entries.
+	LogsQueryName = "logs"
+	// LogEntriesQueryName is the query returning the buffered LogEntry records matching an optional LogsQuery.
+	LogEntriesQueryName = "log_entries"
+)
+
+// LogEntry is a structured log record stored in the logs query buffer.
+// Seq is a per-execution sequence number; it keeps growing when old entries are evicted from the buffer.
+type LogEntry struct {
+	Seq       int64          `json:"seq"`
+	Level     string         `json:"level"`
+	Timestamp time.Time      `json:"timestamp"`
+	Thread    string         `json:"thread,omitempty"`
+	Message   string         `json:"msg"`
+	Fields    map[string]any `json:"fields,omitempty"`
+}
+
+// WriteLog writes a structured log line to the workflow logger and appends a LogEntry to the logs query buffer.
+// The logger is skipped during replay to avoid duplicate lines, but the buffer is always updated, so the query
+// returns the same entries on every worker that replays the history.
+func WriteLog(t *starlark.Thread, level zapcore.Level, msg string, fields []starlark.Tuple) error {
+	ctx := GetContext(t)
+	globals := getGlobals(ctx)
+
+	entry := LogEntry{
+		Seq:       globals.logSeq,
+		Level:     levelName(level),
+		Timestamp: workflow.Now(ctx),
+		Thread:    t.Name,
+		Message:   msg,
+	}
+	zapFields := make([]zap.Field, 0, len(fields)+1)
+	if t.Name != "" {
+		zapFields = append(zapFields, zap.String("thread", t.Name))
+	}
+	if len(fields) > 0 {
+		entry.Fields = make(map[string]any, len(fields))
+		for _, kv := range fields {
+			k := kv[0].(starlark.String).GoString()
+			v, err := toGoValue(kv[1])
+			if err != nil {
+				return err
+			}
+			entry.Fields[k] = v
+			zapFields = append(zapFields, zap.Any(k, v))
+		}
+	}
+
+	if !workflow.IsReplaying(ctx) {
+		if ce := workflow.GetLogger(ctx).Check(level, msg); ce != nil {
+			ce.Write(zapFields...)
+		}
+	}
+
+	globals.logSeq++
+	logs := globals.logs
+	logs.PushBack(entry)
+	if logs.Len() > globals.logLen {
+		logs.Remove(logs.Front())
+	}
+	return nil
+}
+
+// String formats the entry as a single human-readable line.
+func (r LogEntry) String() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%6d %s %-7s", r.Seq, r.Timestamp.UTC().Format(time.RFC3339Nano), r.Level))
+	if r.Thread != "" {
+		sb.WriteString(fmt.Sprintf(" [%s]", r.Thread))
+	}
+	sb.WriteString(" ")
+	sb.WriteString(r.Message)
+	if len(r.Fields) > 0 {
+		if b, err := jsoniter.Marshal(r.Fields); err == nil {
+			sb.WriteString(" ")
+			sb.Write(b)
+		}
+	}
+	return sb.String()
+}
+
+// LogsQuery is an optional argument of the LogEntriesQueryName query handler. The zero value matches all buffered entries.
+type LogsQuery struct {
+	// Offset is the smallest LogEntry.Seq to return. Pollers pass the last seen Seq + 1.
+	Offset int64 `json:"offset,omitempty"`
+	// Limit caps the number of returned entries. Zero means no limit.
+	Limit int `json:"limit,omitempty"`
+	// Level is the minimal level to return: debug, info, warning or error.
+	Level string `json:"level,omitempty"`
+	// Since filters out entries logged before the given time.
+	Since time.Time `json:"since"`
+	// Contains filters out entries whose message does not contain the given substring.
+	Contains string `json:"contains,omitempty"`
+}
+
+// logMessages returns the messages of the buffered entries, the LogsQueryName query result.
+func logMessages(logs *list.List) []string {
+	res := make([]string, 0, logs.Len())
+	for e := logs.Front(); e != nil; e = e.Next() {
+		res = append(res, e.Value.(LogEntry).Message)
+	}
+	return res
+}
+
+// queryLogs returns the buffered entries matching the given query, in the sequence order.
+func queryLogs(logs *list.List, q *LogsQuery) ([]LogEntry, error) {
+	if q == nil {
+		q = &LogsQuery{}
+	}
+	if q.Offset < 0 || q.Limit < 0 {
+		return nil, fmt.Errorf("400: bad logs query: negative offset or limit: %d, %d", q.Offset, q.Limit)
+	}
+	minLevel := zapcore.DebugLevel
+	if q.Level != "" {
+		var err error
+		if minLevel, err = parseLogLevel(q.Level); err != nil {
+			return nil, fmt.Errorf("400: bad logs query: %w", err)
+		}
+	}
+	res := make([]LogEntry, 0)
+	for e := logs.Front(); e != nil; e = e.Next() {
+		if q.Limit > 0 && len(res) >= q.Limit {
+			break
+		}
+		entry := e.Value.(LogEntry)
+		if entry.Seq < q.Offset {
+			continue
+		}
+		if level, err := parseLogLevel(entry.Level); err == nil && level < minLevel {
+			continue
+		}
+		if !q.Since.IsZero() && entry.Timestamp.Before(q.Since) {
+			continue
+		}
+		if q.Contains != "" && !strings.Contains(entry.Message, q.Contains) {
+			continue
+		}
+		res = append(res, entry)
+	}
+	return res, nil
+}
+
+// levelName returns the name of the level stored in LogEntry.Level: "warning" rather than zap's "warn".
+func levelName(level zapcore.Level) string {
+	if level == zapcore.WarnLevel {
+		return "warning"
+	}
+	return level.String()
+}
+
+func parseLogLevel(s string) (zapcore.Level, error) {
+	if strings.EqualFold(s, "warning") {
+		return zapcore.WarnLevel, nil
+	}
+	return zapcore.ParseLevel(s)
+}
+
+// toGoValue converts a starlark value to its JSON-compatible Go representation.
+func toGoValue(v starlark.Value) (any, error) {
+	b, err := star.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	var res any
+	if err := ext.JSON.Unmarshal(b, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// getLogLen returns the logs query buffer capacity configured by the STAR_CORE_LOG_LEN environ.
+func getLogLen(ctx workflow.Context, globals *_Globals) int {
+	v, found := globals.getEnviron(envLogLen)
+	if !found {
+		return defaultLogLen
+	}
+	ll, err := strconv.Atoi(v.GoString())
+	if err != nil {
+		workflow.GetLogger(ctx).Error("invalid environ", zap.String("environ_name", envLogLen.GoString()), zap.String("environ_value", v.GoString()))
+		return defaultLogLen
+	}
+	return ll
+}
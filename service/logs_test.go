@@ -0,0 +1,66 @@
+package service
+
+import (
+	"container/list"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryLogs(t *testing.T) {
+	t0 := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	logs := list.New()
+	for i, e := range []LogEntry{
+		{Level: "debug", Message: "starting"},
+		{Level: "info", Message: "fetching page 1"},
+		{Level: "warning", Message: "slow response"},
+		{Level: "info", Message: "fetching page 2"},
+		{Level: "error", Message: "request failed"},
+	} {
+		e.Seq = int64(i + 10) // the head of the buffer was evicted
+		e.Timestamp = t0.Add(time.Duration(i) * time.Second)
+		logs.PushBack(e)
+	}
+
+	seqs := func(entries []LogEntry) []int64 {
+		res := make([]int64, len(entries))
+		for i, e := range entries {
+			res[i] = e.Seq
+		}
+		return res
+	}
+
+	for _, tc := range []struct {
+		name     string
+		query    *LogsQuery
+		expected []int64
+	}{
+		{name: "nil", query: nil, expected: []int64{10, 11, 12, 13, 14}},
+		{name: "zero", query: &LogsQuery{}, expected: []int64{10, 11, 12, 13, 14}},
+		{name: "offset", query: &LogsQuery{Offset: 12}, expected: []int64{12, 13, 14}},
+		{name: "offset-limit", query: &LogsQuery{Offset: 11, Limit: 2}, expected: []int64{11, 12}},
+		{name: "offset-beyond", query: &LogsQuery{Offset: 100}, expected: []int64{}},
+		{name: "level", query: &LogsQuery{Level: "info"}, expected: []int64{11, 12, 13, 14}},
+		{name: "level-warning", query: &LogsQuery{Level: "warning"}, expected: []int64{12, 14}},
+		{name: "since", query: &LogsQuery{Since: t0.Add(3 * time.Second)}, expected: []int64{13, 14}},
+		{name: "contains", query: &LogsQuery{Contains: "fetching"}, expected: []int64{11, 13}},
+		{name: "contains-limit", query: &LogsQuery{Contains: "fetching", Limit: 1}, expected: []int64{11}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := queryLogs(logs, tc.query)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, seqs(res))
+		})
+	}
+
+	t.Run("bad-level", func(t *testing.T) {
+		_, err := queryLogs(logs, &LogsQuery{Level: "verbose"})
+		require.Error(t, err)
+	})
+
+	t.Run("negative-limit", func(t *testing.T) {
+		_, err := queryLogs(logs, &LogsQuery{Limit: -1})
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,31 @@
+package service
+
+import (
+	"errors"
+
+	"go.starlark.net/starlark"
+	cad "go.uber.org/cadence"
+)
+
+func (r *CadTest) TestCadModules() {
+	for _, tc := range []struct {
+		file string
+		fn   string
+		err  string
+	}{
+		{file: "/modules/modules.star", fn: "mutate", err: "frozen list"},
+		{file: "/modules/cycle.star", fn: "main", err: "load cycle: /modules/cycle_a.star -> /modules/cycle_b.star -> /modules/cycle_a.star"},
+	} {
+		r.Run(tc.fn, func() {
+			r.SetupTest()
+			r.env.ExecuteFunction(tc.file, tc.fn, nil, nil, nil)
+			var res starlark.Value
+			err := r.env.GetResult(&res)
+			var customErr *cad.CustomError
+			r.Require().True(errors.As(err, &customErr), "unexpected error: %v", err)
+			var details map[string]any
+			r.Require().NoError(customErr.Details(&details))
+			r.Require().Contains(details["error"], tc.err)
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cadence-workflow/starlark-worker/ext"
+	"github.com/cadence-workflow/starlark-worker/workflow"
+	"go.uber.org/yarpc/yarpcerrors"
+	"go.uber.org/zap"
+)
+
+const (
+	// PackageRefPrefix is the prefix of content-addressed package references: "sha256:<hex digest>".
+	PackageRefPrefix = "sha256:"
+
+	// DefaultPackageCacheSize is the default size (bytes) of the in-memory package cache.
+	DefaultPackageCacheSize = 256 << 20
+
+	fetchPackageActivity = "star_fetch_package"
+)
+
+// errNoPackageStore is returned when resolving a package reference without a PackageStore.
+var errNoPackageStore = errors.New("package store is not configured")
+
+// PackageStore stores packages (tar files) by their content digest.
+type PackageStore interface {
+	// Get returns the package by reference. Returns an error wrapping os.ErrNotExist if the package is unknown.
+	Get(ctx context.Context, ref string) ([]byte, error)
+	// Put stores the package and returns its reference.
+	Put(ctx context.Context, tar []byte) (string, error)
+}
+
+// PackageRef returns the content-addressed reference of the given package.
+func PackageRef(tar []byte) string {
+	sum := sha256.Sum256(tar)
+	return PackageRefPrefix + hex.EncodeToString(sum[:])
+}
+
+// ParsePackageRef returns the package reference if the given Run argument is a reference rather than
+// the package content.
+func ParsePackageRef(b []byte) (string, bool) {
+	if len(b) != len(PackageRefPrefix)+sha256.Size*2 || !bytes.HasPrefix(b, []byte(PackageRefPrefix)) {
+		return "", false
+	}
+	if _, err := hex.DecodeString(string(b[len(PackageRefPrefix):])); err != nil {
+		return "", false
+	}
+	return string(b), true
+}
+
+// LocalPackageStore is a PackageStore backed by a local (or mounted) directory: packages are stored as
+// Dir/sha256/<hex digest> files.
+type LocalPackageStore struct {
+	Dir string
+}
+
+var _ PackageStore = (*LocalPackageStore)(nil)
+
+func (r *LocalPackageStore) Get(_ context.Context, ref string) ([]byte, error) {
+	p, err := r.path(ref)
+	if err != nil {
+		return nil, err
+	}
+	tar, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyPackage(ref, tar); err != nil {
+		return nil, err
+	}
+	return tar, nil
+}
+
+func (r *LocalPackageStore) Put(_ context.Context, tar []byte) (string, error) {
+	ref := PackageRef(tar)
+	p, err := r.path(ref)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(p); err == nil {
+		return ref, nil // content-addressed: already stored
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return "", err
+	}
+	// write to a temp file first, so concurrent readers never see a partial package
+	f, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(tar); err != nil {
+		_ = f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(f.Name(), p); err != nil {
+		return "", err
+	}
+	return ref, nil
+}
+
+func (r *LocalPackageStore) path(ref string) (string, error) {
+	if _, ok := ParsePackageRef([]byte(ref)); !ok {
+		return "", fmt.Errorf("400: bad package reference: %s", ref)
+	}
+	return filepath.Join(r.Dir, "sha256", strings.TrimPrefix(ref, PackageRefPrefix)), nil
+}
+
+func verifyPackage(ref string, tar []byte) error {
+	if actual := PackageRef(tar); actual != ref {
+		return fmt.Errorf("package digest mismatch: expected: %s, actual: %s", ref, actual)
+	}
+	return nil
+}
+
+// FetchPackage is the activity that fetches a referenced package from the worker's PackageStore.
+// Used by workflows running on workers that can't read the package themselves, see resolvePackage.
+func (r *Service) FetchPackage(ctx context.Context, ref string) ([]byte, error) {
+	res, err := r.loadPackage(ctx, ref, true)
+	if err != nil {
+		return nil, packageError(ctx, ref, err)
+	}
+	return res, nil
+}
+
+// resolvePackage returns the package content if the given Run argument is a package reference.
+//
+// Packages found in the worker's in-memory cache or, unless FetchPackagesViaActivity is set, in the PackageStore
+// are read locally and only their digest is recorded in the history, via a SideEffect: the workers replaying the
+// workflow must be able to read the same packages, e.g. from a shared store directory. Other packages are fetched
+// via the FetchPackage activity, whose result (the package content) is recorded in the history, and cached.
+func (r *Service) resolvePackage(ctx workflow.Context, tar []byte) ([]byte, error) {
+	ref, ok := ParsePackageRef(tar)
+	if !ok {
+		return tar, nil
+	}
+	logger := workflow.GetLogger(ctx)
+	logger.Info("package-ref", zap.String("ref", ref))
+
+	store := !r.FetchPackagesViaActivity
+	var local string
+	if err := workflow.SideEffect(ctx, func(workflow.Context) any {
+		if _, err := r.loadPackage(context.Background(), ref, store); err != nil {
+			logger.Warn("package-error", ext.ZapError(err)...)
+			return ""
+		}
+		return ref
+	}).Get(&local); err != nil {
+		return nil, err
+	}
+	if local == ref {
+		// on replay, the package may have been read from the store or fetched by another worker
+		res, err := r.loadPackage(context.Background(), ref, true)
+		if err != nil {
+			logger.Error("package-error", ext.ZapError(err)...)
+			return nil, packageError(ctx, ref, err)
+		}
+		return res, nil
+	}
+
+	var res []byte
+	if err := workflow.ExecuteActivity(ctx, fetchPackageActivity, ref).Get(ctx, &res); err != nil {
+		return nil, err
+	}
+	if err := verifyPackage(ref, res); err != nil {
+		return nil, workflow.NewCustomError(ctx, yarpcerrors.CodeDataLoss.String(), err.Error())
+	}
+	if r.packages != nil {
+		r.packages.Add(ref, res)
+	}
+	return res, nil
+}
+
+// loadPackage reads the package from the in-memory cache or, if store is set, the PackageStore.
+func (r *Service) loadPackage(ctx context.Context, ref string, store bool) ([]byte, error) {
+	if r.packages != nil {
+		if res, found := r.packages.Get(ref); found {
+			return res, nil
+		}
+	}
+	if !store {
+		return nil, fmt.Errorf("package %s is not cached: %w", ref, os.ErrNotExist)
+	}
+	if r.PackageStore == nil {
+		return nil, errNoPackageStore
+	}
+	res, err := r.PackageStore.Get(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if r.packages != nil {
+		r.packages.Add(ref, res)
+	}
+	return res, nil
+}
+
+// packageError returns the custom error of a package that can't be read.
+func packageError(ctx workflow.Context, ref string, err error) error {
+	code := yarpcerrors.CodeUnavailable
+	switch {
+	case errors.Is(err, errNoPackageStore):
+		code = yarpcerrors.CodeFailedPrecondition
+	case errors.Is(err, os.ErrNotExist):
+		code = yarpcerrors.CodeNotFound
+	}
+	return workflow.NewCustomError(ctx, code.String(), fmt.Sprintf("package %s: %s", ref, err.Error()))
+}
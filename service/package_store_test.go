@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.starlark.net/starlark"
+)
+
+func TestParsePackageRef(t *testing.T) {
+	ref := PackageRef([]byte("foo"))
+	require.Equal(t, "sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae", ref)
+
+	parsed, ok := ParsePackageRef([]byte(ref))
+	require.True(t, ok)
+	require.Equal(t, ref, parsed)
+
+	for _, b := range []string{"", "sha256:", "sha256:2c26", strings.Replace(ref, "2c", "zz", 1), "\x1f\x8b"} {
+		_, ok := ParsePackageRef([]byte(b))
+		require.False(t, ok, b)
+	}
+}
+
+func TestLocalPackageStore(t *testing.T) {
+	ctx := context.Background()
+	store := &LocalPackageStore{Dir: t.TempDir()}
+
+	ref, err := store.Put(ctx, []byte("foo"))
+	require.NoError(t, err)
+	require.Equal(t, PackageRef([]byte("foo")), ref)
+
+	// put is idempotent
+	ref2, err := store.Put(ctx, []byte("foo"))
+	require.NoError(t, err)
+	require.Equal(t, ref, ref2)
+
+	tar, err := store.Get(ctx, ref)
+	require.NoError(t, err)
+	require.Equal(t, []byte("foo"), tar)
+
+	_, err = store.Get(ctx, PackageRef([]byte("bar")))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	_, err = store.Get(ctx, "sha256:foo")
+	require.ErrorContains(t, err, "bad package reference")
+
+	// corrupted package
+	p := filepath.Join(store.Dir, "sha256", strings.TrimPrefix(ref, PackageRefPrefix))
+	require.NoError(t, os.WriteFile(p, []byte("bar"), 0o644))
+	_, err = store.Get(ctx, ref)
+	require.ErrorContains(t, err, "package digest mismatch")
+}
+
+func (r *CadTest) TestCadPackageRef() {
+	for _, viaActivity := range []bool{false, true} {
+		r.SetupTest()
+		store := &LocalPackageStore{Dir: r.T().TempDir()}
+		ref, err := store.Put(context.Background(), r.env.tar)
+		r.Require().NoError(err)
+
+		r.env.service.PackageStore = store
+		r.env.service.FetchPackagesViaActivity = viaActivity
+		r.env.tar = []byte(ref)
+		r.env.ExecuteFunction("/app.star", "plus", starlark.Tuple{starlark.MakeInt(2), starlark.MakeInt(3)}, nil, nil)
+
+		var res starlark.Int
+		r.Require().NoError(r.env.GetResult(&res))
+		r.Require().Equal(starlark.MakeInt(5), res)
+
+		// the package is cached by digest on the worker
+		_, found := r.env.service.packages.Get(ref)
+		r.Require().True(found)
+	}
+}
+
+func (r *CadTest) TestCadPackageRefNotFound() {
+	r.env.service.PackageStore = &LocalPackageStore{Dir: r.T().TempDir()}
+	r.env.tar = []byte(PackageRef([]byte("foo")))
+	r.env.ExecuteFunction("/app.star", "plus", starlark.Tuple{starlark.MakeInt(2), starlark.MakeInt(3)}, nil, nil)
+
+	var res starlark.Int
+	r.Require().ErrorContains(r.env.GetResult(&res), "not-found")
+}
+
+func (r *TempTest) TestTempPackageRef() {
+	for _, viaActivity := range []bool{false, true} {
+		r.SetupTest()
+		store := &LocalPackageStore{Dir: r.T().TempDir()}
+		ref, err := store.Put(context.Background(), r.env.tar)
+		r.Require().NoError(err)
+
+		r.env.service.PackageStore = store
+		r.env.service.FetchPackagesViaActivity = viaActivity
+		r.env.tar = []byte(ref)
+		r.env.ExecuteFunction("/app.star", "plus", starlark.Tuple{starlark.MakeInt(2), starlark.MakeInt(3)}, nil, nil)
+
+		var res starlark.Int
+		r.Require().NoError(r.env.GetResult(&res))
+		r.Require().Equal(starlark.MakeInt(5), res)
+	}
+}
+
+func (r *CadTest) TestCadPackageRefCached() {
+	tar := r.env.tar
+	ref := PackageRef(tar)
+	r.env.service.packages.Add(ref, tar)
+	r.env.service.FetchPackagesViaActivity = true
+	r.env.tar = []byte(ref)
+	r.env.ExecuteFunction("/app.star", "plus", starlark.Tuple{starlark.MakeInt(2), starlark.MakeInt(3)}, nil, nil)
+
+	// no store and no activity: the cached package is used
+	var res starlark.Int
+	r.Require().NoError(r.env.GetResult(&res))
+	r.Require().Equal(starlark.MakeInt(5), res)
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"github.com/cadence-workflow/starlark-worker/star"
 	"github.com/cadence-workflow/starlark-worker/worker"
 	"github.com/cadence-workflow/starlark-worker/workflow"
 	"go.starlark.net/starlark"
@@ -23,4 +24,6 @@ type IPlugin interface {
 type RunInfo struct {
 	Info    workflow.IInfo
 	Environ *starlark.Dict
+	// FS is the package file system of the run
+	FS star.FS
 }
@@ -0,0 +1,297 @@
+package service
+
+import (
+	"container/list"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/cadence-workflow/starlark-worker/ext"
+	"github.com/cadence-workflow/starlark-worker/star"
+	"github.com/cadence-workflow/starlark-worker/workflow"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+	"go.uber.org/yarpc/yarpcerrors"
+	"go.uber.org/zap"
+)
+
+const (
+	// REPLSignalName is the signal used to send code chunks (string) to the REPL workflow.
+	REPLSignalName = "repl_input"
+	// REPLQueryName is the query used to read REPLOutput entries from the REPL workflow.
+	// The query accepts an optional offset (int): the smallest REPLOutput.Seq to return.
+	REPLQueryName = "repl_output"
+
+	replExit = "exit"
+
+	// DefaultREPLChunksPerRun is the default of Service.REPLChunksPerRun.
+	DefaultREPLChunksPerRun = 500
+
+	// replStateOutputsSize caps the text size (bytes) of the outputs a REPL run carries over to the next run,
+	// so that the run input stays within the payload limits: only the most recent outputs are carried over.
+	replStateOutputsSize = 64 << 10
+)
+
+// REPLOutput is the outcome of a single code chunk executed by the REPL workflow.
+type REPLOutput struct {
+	Seq    int64  `json:"seq"`
+	Input  string `json:"input"`
+	Output string `json:"output,omitempty"` // text printed by the chunk
+	Result string `json:"result,omitempty"` // value of the chunk if it is a sole expression, other than None
+	Error  string `json:"error,omitempty"`
+	// Exited is set if the chunk ended the session, e.g. by calling exit().
+	Exited bool `json:"exited,omitempty"`
+}
+
+// REPLState is the session state a REPL workflow run carries over to the next run, see Service.REPLChunksPerRun.
+type REPLState struct {
+	Seq     int64        `json:"seq"`
+	Outputs []REPLOutput `json:"outputs"`
+	// Globals are the session globals encoded with star.EncodeTyped. Globals that do not encode, such as functions
+	// and loaded modules, are not carried over.
+	Globals map[string]json.RawMessage `json:"globals,omitempty"`
+}
+
+// _REPL is the state of a REPL workflow session.
+type _REPL struct {
+	thread  *starlark.Thread
+	globals starlark.StringDict
+	outputs *list.List
+	seq     int64
+	printed strings.Builder
+	exited  bool
+}
+
+// REPL is an interactive workflow: it keeps a starlark thread with all plugins loaded and persistent globals,
+// executes code chunks received via the REPLSignalName signal and returns the outcome via the REPLQueryName
+// query. The session ends when a chunk calls exit() or the workflow is canceled. Every REPLChunksPerRun chunks,
+// the session continues as a new run of the workflow with the REPLState of the current run, so that the history
+// stays bounded; state is nil for the first run.
+func (r *Service) REPL(
+	ctx workflow.Context,
+	tar []byte,
+	environ *starlark.Dict,
+	state *REPLState,
+) (err error) {
+	if r.workflow == nil {
+		return fmt.Errorf("backend not initialized")
+	}
+
+	ctx = workflow.WithBackend(ctx, r.workflow)
+
+	logger := workflow.GetLogger(ctx)
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			logger.Error("workflow-panic", zap.Any("panic", rec))
+			err = workflow.NewCustomError(
+				ctx,
+				yarpcerrors.CodeInternal.String(),
+				fmt.Sprintf("panic: %v", rec),
+			)
+		}
+	}()
+
+	logger.Info("repl-start", zap.Int("tar_len", len(tar)))
+
+	var execution *_Execution
+	if execution, err = r.start(ctx, tar, environ, nil); err != nil {
+		return err
+	}
+	wfCtx := ctx // without the child workflow options of the execution, inherited by the next run
+	ctx = execution.ctx
+
+	repl := &_REPL{
+		thread:  execution.newThread(),
+		globals: starlark.StringDict{},
+		outputs: list.New(),
+	}
+	for k, v := range builtins {
+		repl.globals[k] = v
+	}
+	repl.globals[replExit] = starlark.NewBuiltin(replExit, repl.exit)
+	if err := repl.restore(state); err != nil {
+		logger.Error("workflow-error", ext.ZapError(err)...)
+		return err
+	}
+
+	threadPrint := repl.thread.Print
+	repl.thread.Print = func(t *starlark.Thread, msg string) {
+		threadPrint(t, msg)
+		repl.printed.WriteString(msg)
+		repl.printed.WriteByte('\n')
+	}
+
+	if err := workflow.SetQueryHandler(ctx, REPLQueryName, func(offset int64) ([]REPLOutput, error) {
+		res := make([]REPLOutput, 0)
+		for e := repl.outputs.Front(); e != nil; e = e.Next() {
+			if out := e.Value.(REPLOutput); out.Seq >= offset {
+				res = append(res, out)
+			}
+		}
+		return res, nil
+	}); err != nil {
+		logger.Error("workflow-error", ext.ZapError(err)...)
+		return err
+	}
+
+	chunksPerRun := r.REPLChunksPerRun
+	if chunksPerRun <= 0 {
+		chunksPerRun = DefaultREPLChunksPerRun
+	}
+	push := func(chunk string) {
+		out := repl.exec(chunk)
+		out.Exited = repl.exited
+		repl.outputs.PushBack(out)
+		if repl.outputs.Len() > execution.globals.logLen {
+			repl.outputs.Remove(repl.outputs.Front())
+		}
+	}
+
+	input := workflow.GetSignalChannel(ctx, REPLSignalName)
+	selector := workflow.NewSelector(ctx).
+		AddReceive(input, func(c workflow.ReceiveChannel, more bool) {
+			var chunk string
+			if c.Receive(ctx, &chunk) {
+				push(chunk)
+			} else {
+				repl.exited = true // closed
+			}
+		}).
+		AddDone(ctx, func() {
+			err = workflow.Err(ctx)
+		})
+	for chunks := 0; !repl.exited && err == nil; chunks++ {
+		if chunks == chunksPerRun {
+			// chunks already signaled to this run would be lost by the new run
+			var chunk string
+			for !repl.exited && input.ReceiveAsync(&chunk) {
+				push(chunk)
+			}
+			if !repl.exited {
+				logger.Info("repl-continue-as-new", zap.Int64("seq", repl.seq))
+				return workflow.NewContinueAsNewError(wfCtx, r.REPL, tar, environ, repl.state())
+			}
+			break
+		}
+		selector.Select(ctx)
+	}
+
+	if err != nil {
+		logger.Info("repl-canceled", ext.ZapError(err)...)
+		execution.globals.isCanceled = true // exit hooks run on a disconnected context, see GetContext
+	}
+	if _err := execution.globals.exitHooks.Run(repl.thread); _err != nil {
+		logger.Error("exit-hook-error", ext.ZapError(_err)...)
+		if err == nil {
+			err = r.processError(ctx, _err)
+		}
+	}
+	logger.Info("repl-end")
+	return err
+}
+
+// state returns the session state carried over to the next run: the globals, and the most recent outputs up to
+// replStateOutputsSize.
+func (r *_REPL) state() *REPLState {
+	state := &REPLState{
+		Seq:     r.seq,
+		Outputs: []REPLOutput{},
+		Globals: map[string]json.RawMessage{},
+	}
+	size := 0
+	for e := r.outputs.Back(); e != nil; e = e.Prev() {
+		out := e.Value.(REPLOutput)
+		if size += len(out.Input) + len(out.Output) + len(out.Result) + len(out.Error); size > replStateOutputsSize {
+			break
+		}
+		state.Outputs = append(state.Outputs, out)
+	}
+	slices.Reverse(state.Outputs)
+	for name, v := range r.globals {
+		if _, found := builtins[name]; found || name == replExit {
+			continue
+		}
+		if b, err := star.EncodeTyped(v); err == nil {
+			state.Globals[name] = b
+		}
+	}
+	return state
+}
+
+// restore sets the session state carried over from the previous run, if any.
+func (r *_REPL) restore(state *REPLState) error {
+	if state == nil {
+		return nil
+	}
+	r.seq = state.Seq
+	for _, out := range state.Outputs {
+		r.outputs.PushBack(out)
+	}
+	for name, b := range state.Globals {
+		var v starlark.Value
+		if err := star.Decode(b, &v); err != nil {
+			return fmt.Errorf("repl global %s: %w", name, err)
+		}
+		r.globals[name] = v
+	}
+	return nil
+}
+
+// exec executes the given code chunk against the session globals. A chunk consisting of a sole expression is
+// evaluated, and its value is returned as the result, similar to the interactive Python interpreter.
+func (r *_REPL) exec(chunk string) REPLOutput {
+	out := REPLOutput{Seq: r.seq, Input: chunk}
+	r.seq++
+	r.printed.Reset()
+	// a chunk that hit an execution limit must not fail the subsequent ones
+	r.thread.Uncancel()
+	resetStepBudget(r.thread)
+	getGlobals(GetContext(r.thread)).limitErr = nil
+
+	opts := *star.FileOptions
+	opts.LoadBindsGlobally = true // load bindings persist across chunks
+
+	var err error
+	var f *syntax.File
+	if f, err = opts.Parse("<repl>", chunk, 0); err == nil {
+		if expr := soleExpr(f); expr != nil {
+			var v starlark.Value
+			if v, err = starlark.EvalExprOptions(f.Options, r.thread, expr, r.globals); err == nil && v != starlark.None {
+				out.Result = v.String()
+			}
+		} else {
+			err = starlark.ExecREPLChunk(f, r.thread, r.globals)
+		}
+	}
+	if err != nil {
+		var evalErr *starlark.EvalError
+		if errors.As(err, &evalErr) {
+			out.Error = evalErr.Backtrace()
+		} else {
+			out.Error = err.Error()
+		}
+	}
+	out.Output = r.printed.String()
+	return out
+}
+
+// exit ends the REPL session once the current chunk is executed.
+func (r *_REPL) exit(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs); err != nil {
+		return nil, err
+	}
+	r.exited = true
+	return starlark.None, nil
+}
+
+func soleExpr(f *syntax.File) syntax.Expr {
+	if len(f.Stmts) == 1 {
+		if stmt, ok := f.Stmts[0].(*syntax.ExprStmt); ok {
+			return stmt.X
+		}
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package service
+
+import (
+	"container/list"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cadence-workflow/starlark-worker/cadence"
+	"github.com/cadence-workflow/starlark-worker/temporal"
+	"github.com/stretchr/testify/require"
+	"go.starlark.net/starlark"
+	temp "go.temporal.io/sdk/temporal"
+	cad "go.uber.org/cadence/workflow"
+)
+
+var replChunks = []string{
+	`load("@plugin", "testplugin")`,
+	`x = 40`,
+	"def plus(a, b):\n    return a + b\n",
+	`plus(x, 2)`,
+	`print("hello")`,
+	`testplugin.stringify_activity(x)`,
+	`undefined_name`,
+	`x = 1; exit()`,
+}
+
+func requireREPLOutputs(t *testing.T, outputs []REPLOutput) {
+	require.Len(t, outputs, len(replChunks))
+	for i, out := range outputs {
+		require.Equal(t, int64(i), out.Seq)
+		require.Equal(t, replChunks[i], out.Input)
+	}
+	require.Equal(t, "42", outputs[3].Result)
+	require.Equal(t, "hello\n", outputs[4].Output)
+	require.Equal(t, `"(40,)"`, outputs[5].Result)
+	require.Contains(t, outputs[6].Error, "undefined: undefined_name")
+	for _, i := range []int{0, 1, 2, 3, 4, 5, 7} {
+		require.Empty(t, outputs[i].Error, "chunk %d: %s", i, replChunks[i])
+	}
+	// the session ends on exit(), whatever the chunk
+	for i, out := range outputs {
+		require.Equal(t, i == 7, out.Exited, "chunk %d: %s", i, replChunks[i])
+	}
+}
+
+func (r *CadTest) TestCadREPL() {
+	env := r.env.GetTestWorkflowEnvironment()
+	for i, chunk := range replChunks {
+		chunk := chunk
+		env.RegisterDelayedCallback(func() {
+			env.SignalWorkflow(REPLSignalName, chunk)
+		}, time.Second*time.Duration(i+1))
+	}
+	_, name := cadence.UpdateWorkflowFunctionContextArgument(r.env.service.REPL)
+	env.ExecuteWorkflow(name, r.env.tar, nil, nil)
+
+	require := r.Require()
+	require.True(env.IsWorkflowCompleted())
+	require.NoError(env.GetWorkflowError())
+
+	v, err := env.QueryWorkflow(REPLQueryName)
+	require.NoError(err)
+	var outputs []REPLOutput
+	require.NoError(v.Get(&outputs))
+	requireREPLOutputs(r.T(), outputs)
+
+	v, err = env.QueryWorkflow(REPLQueryName, 7)
+	require.NoError(err)
+	require.NoError(v.Get(&outputs))
+	require.Len(outputs, 1)
+}
+
+func (r *TempTest) TestTempREPL() {
+	env := r.env.GetTestWorkflowEnvironment()
+	for i, chunk := range replChunks {
+		chunk := chunk
+		env.RegisterDelayedCallback(func() {
+			env.SignalWorkflow(REPLSignalName, chunk)
+		}, time.Second*time.Duration(i+1))
+	}
+	_, name := temporal.UpdateWorkflowFunctionContextArgument(r.env.service.REPL)
+	env.ExecuteWorkflow(name, r.env.tar, nil, nil)
+
+	require := r.Require()
+	require.True(env.IsWorkflowCompleted())
+	require.NoError(env.GetWorkflowError())
+
+	v, err := env.QueryWorkflow(REPLQueryName)
+	require.NoError(err)
+	var outputs []REPLOutput
+	require.NoError(v.Get(&outputs))
+	requireREPLOutputs(r.T(), outputs)
+
+	v, err = env.QueryWorkflow(REPLQueryName, 7)
+	require.NoError(err)
+	require.NoError(v.Get(&outputs))
+	require.Len(outputs, 1)
+}
+
+func (r *CadTest) TestCadREPLContinueAsNew() {
+	r.env.service.REPLChunksPerRun = 2
+	env := r.env.GetTestWorkflowEnvironment()
+	for i, chunk := range []string{`x = 40`, "def plus(a, b):\n    return a + b\n"} {
+		chunk := chunk
+		env.RegisterDelayedCallback(func() {
+			env.SignalWorkflow(REPLSignalName, chunk)
+		}, time.Second*time.Duration(i+1))
+	}
+	_, name := cadence.UpdateWorkflowFunctionContextArgument(r.env.service.REPL)
+	env.ExecuteWorkflow(name, r.env.tar, nil, nil)
+
+	require := r.Require()
+	require.True(env.IsWorkflowCompleted())
+	var continueErr *cad.ContinueAsNewError
+	require.True(errors.As(env.GetWorkflowError(), &continueErr), "unexpected error: %v", env.GetWorkflowError())
+	require.Equal(name, continueErr.WorkflowType().Name)
+	state := continueErr.Args()[2].(*REPLState)
+	require.Equal(int64(2), state.Seq)
+	require.Len(state.Outputs, 2)
+	// functions do not encode: only x is carried over
+	require.Equal(map[string]json.RawMessage{"x": json.RawMessage("40")}, state.Globals)
+
+	// the next run continues the session
+	r.SetupTest()
+	env = r.env.GetTestWorkflowEnvironment()
+	for i, chunk := range []string{`x + 2`, `exit()`} {
+		chunk := chunk
+		env.RegisterDelayedCallback(func() {
+			env.SignalWorkflow(REPLSignalName, chunk)
+		}, time.Second*time.Duration(i+1))
+	}
+	env.ExecuteWorkflow(name, r.env.tar, nil, state)
+	require.True(env.IsWorkflowCompleted())
+	require.NoError(env.GetWorkflowError())
+
+	v, err := env.QueryWorkflow(REPLQueryName, 2)
+	require.NoError(err)
+	var outputs []REPLOutput
+	require.NoError(v.Get(&outputs))
+	require.Len(outputs, 2)
+	require.Equal(int64(2), outputs[0].Seq)
+	require.Equal("42", outputs[0].Result)
+}
+
+func (r *TempTest) TestTempREPLCancel() {
+	env := r.env.GetTestWorkflowEnvironment()
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow(REPLSignalName, `x = 1`)
+	}, time.Second)
+	env.RegisterDelayedCallback(env.CancelWorkflow, time.Second*2)
+	_, name := temporal.UpdateWorkflowFunctionContextArgument(r.env.service.REPL)
+	env.ExecuteWorkflow(name, r.env.tar, nil, nil)
+
+	require := r.Require()
+	require.True(env.IsWorkflowCompleted())
+	require.True(temp.IsCanceledError(env.GetWorkflowError()), "unexpected error: %v", env.GetWorkflowError())
+}
+
+func (r *CadTest) TestCadREPLLimits() {
+	chunks := []string{
+		`[i for i in range(100000)]`,
+		`[i for i in range(10)]`,
+		`[i for i in range(10)]`,
+		`exit()`,
+	}
+	env := r.env.GetTestWorkflowEnvironment()
+	for i, chunk := range chunks {
+		chunk := chunk
+		env.RegisterDelayedCallback(func() {
+			env.SignalWorkflow(REPLSignalName, chunk)
+		}, time.Second*time.Duration(i+1))
+	}
+	_, name := cadence.UpdateWorkflowFunctionContextArgument(r.env.service.REPL)
+	env.ExecuteWorkflow(name, r.env.tar, limitsEnviron(envMaxSteps.GoString(), "300"), nil)
+
+	require := r.Require()
+	require.True(env.IsWorkflowCompleted())
+	require.NoError(env.GetWorkflowError())
+
+	v, err := env.QueryWorkflow(REPLQueryName)
+	require.NoError(err)
+	var outputs []REPLOutput
+	require.NoError(v.Get(&outputs))
+	require.Len(outputs, len(chunks))
+	require.Contains(outputs[0].Error, "max_steps exceeded: 300")
+	// the budget is reset for every chunk
+	for _, out := range outputs[1:] {
+		require.Empty(out.Error, out.Input)
+	}
+}
+
+func (r *CadTest) TestCadREPLLimitErrors() {
+	chunks := []string{
+		`load("@plugin", "testplugin")`,
+		`testplugin.stringify_activity("x" * 100)`,
+		`testplugin.try_call(testplugin.stringify_activity, "x" * 100)`,
+		`testplugin.try_call(fail, "boom")`,
+		`exit()`,
+	}
+	env := r.env.GetTestWorkflowEnvironment()
+	for i, chunk := range chunks {
+		chunk := chunk
+		env.RegisterDelayedCallback(func() {
+			env.SignalWorkflow(REPLSignalName, chunk)
+		}, time.Second*time.Duration(i+1))
+	}
+	_, name := cadence.UpdateWorkflowFunctionContextArgument(r.env.service.REPL)
+	env.ExecuteWorkflow(name, r.env.tar, limitsEnviron(envMaxPayloadSize.GoString(), "50"), nil)
+
+	require := r.Require()
+	require.True(env.IsWorkflowCompleted())
+	require.NoError(env.GetWorkflowError())
+
+	v, err := env.QueryWorkflow(REPLQueryName)
+	require.NoError(err)
+	var outputs []REPLOutput
+	require.NoError(v.Get(&outputs))
+	require.Len(outputs, len(chunks))
+	require.Contains(outputs[1].Error, "resource-exhausted")
+	// the limit error of a chunk is not the one of the previous chunk: try_call raises it
+	require.Contains(outputs[2].Error, "resource-exhausted")
+	// other errors are handled
+	require.Empty(outputs[3].Error)
+	require.Equal(`"fail: boom"`, outputs[3].Result)
+}
+
+func TestREPLStateOutputs(t *testing.T) {
+	repl := &_REPL{globals: starlark.StringDict{}, outputs: list.New()}
+	large := strings.Repeat("x", replStateOutputsSize/3)
+	for i := 0; i < 5; i++ {
+		repl.outputs.PushBack(REPLOutput{Seq: int64(i), Input: "print(x)", Output: large})
+	}
+	// only the most recent outputs within the size cap are carried over
+	state := repl.state()
+	require.Len(t, state.Outputs, 2)
+	require.Equal(t, int64(3), state.Outputs[0].Seq)
+	require.Equal(t, int64(4), state.Outputs[1].Seq)
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cadence-workflow/starlark-worker/ext"
+	"github.com/cadence-workflow/starlark-worker/star"
+	"github.com/cadence-workflow/starlark-worker/workflow"
+	"go.uber.org/yarpc/yarpcerrors"
+	"go.uber.org/zap"
+)
+
+// openRepositories returns the file systems of the external repositories pinned in the package meta.json,
+// loaded as "@alias//path", and their content digests. A pin is either a package reference (sha256:...) resolved
+// like the package itself, or a version: a subdirectory of the worker-configured repository directory, see
+// Service.Repositories, read like a package by its content digest, see resolveRepository.
+func (r *Service) openRepositories(ctx workflow.Context, pins map[string]string) (map[string]star.FS, map[string]string, error) {
+	logger := workflow.GetLogger(ctx)
+	aliases := make([]string, 0, len(pins))
+	for alias := range pins {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases) // package references may be fetched via activities: keep the order deterministic
+
+	res := make(map[string]star.FS, len(pins))
+	digests := make(map[string]string, len(pins))
+	for _, alias := range aliases {
+		pin := pins[alias]
+		logger.Info("repository", zap.String("alias", alias), zap.String("pin", pin))
+		ref, isRef := ParsePackageRef([]byte(pin))
+		var tar []byte
+		var err error
+		if isRef {
+			tar, err = r.resolvePackage(ctx, []byte(ref))
+		} else {
+			ref, tar, err = r.resolveRepository(ctx, alias, pin)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		var fs star.FS
+		if r.cache != nil {
+			var hit bool
+			fs, hit, err = r.cache.TarFS(ref, tar)
+			incCacheCounter(ctx, "package", hit)
+		} else {
+			fs, err = star.NewTarFS(tar)
+		}
+		if err != nil {
+			logger.Error("workflow-error", ext.ZapError(err)...)
+			return nil, nil, workflow.NewCustomError(ctx, yarpcerrors.CodeInvalidArgument.String(), err.Error())
+		}
+		res[alias] = fs
+		digests[alias] = ref
+	}
+	return res, digests, nil
+}
+
+// _RepositoryVersion is the outcome of reading a repository version, recorded in the history.
+type _RepositoryVersion struct {
+	Ref   string `json:"ref,omitempty"`
+	Code  string `json:"code,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// resolveRepository returns the content digest and the content (a tar, as a package) of the given version of
+// a repository directory. Only the digest is recorded in the history, via a SideEffect: the workers replaying
+// the workflow must read the same content, e.g. from a shared directory, and fail if the version was modified.
+func (r *Service) resolveRepository(ctx workflow.Context, alias string, version string) (string, []byte, error) {
+	var v _RepositoryVersion
+	if err := workflow.SideEffect(ctx, func(workflow.Context) any {
+		tar, code, err := readRepository(r.Repositories, alias, version)
+		if err != nil {
+			return _RepositoryVersion{Code: code.String(), Error: err.Error()}
+		}
+		ref := PackageRef(tar)
+		if r.packages != nil {
+			r.packages.Add(ref, tar)
+		}
+		return _RepositoryVersion{Ref: ref}
+	}).Get(&v); err != nil {
+		return "", nil, err
+	}
+	if v.Error != "" {
+		return "", nil, workflow.NewCustomError(ctx, v.Code, v.Error)
+	}
+	if r.packages != nil {
+		if tar, found := r.packages.Get(v.Ref); found {
+			return v.Ref, tar, nil
+		}
+	}
+	// replayed by another worker, or evicted from the cache
+	tar, code, err := readRepository(r.Repositories, alias, version)
+	if err == nil && PackageRef(tar) != v.Ref {
+		code, err = yarpcerrors.CodeDataLoss, fmt.Errorf("repository version modified: %s: %s", alias, version)
+	}
+	if err != nil {
+		workflow.GetLogger(ctx).Error("workflow-error", ext.ZapError(err)...)
+		return "", nil, workflow.NewCustomError(ctx, code.String(), err.Error())
+	}
+	if r.packages != nil {
+		r.packages.Add(v.Ref, tar)
+	}
+	return v.Ref, tar, nil
+}
+
+// readRepository returns the given version of a repository directory as a tar.
+func readRepository(dirs map[string]string, alias string, version string) ([]byte, yarpcerrors.Code, error) {
+	dir, found := dirs[alias]
+	if !found {
+		return nil, yarpcerrors.CodeFailedPrecondition, fmt.Errorf("repository is not configured: %s", alias)
+	}
+	if version == "" || version == "." || version == ".." || strings.ContainsAny(version, `/\`) {
+		return nil, yarpcerrors.CodeInvalidArgument, fmt.Errorf("bad repository version: %s: %q", alias, version)
+	}
+	root := filepath.Join(dir, version)
+	if fi, err := os.Stat(root); err != nil || !fi.IsDir() {
+		return nil, yarpcerrors.CodeNotFound, fmt.Errorf("repository version not found: %s: %s", alias, version)
+	}
+	bb := bytes.Buffer{}
+	if err := ext.DirToTar(root, &bb); err != nil {
+		return nil, yarpcerrors.CodeUnavailable, fmt.Errorf("repository version: %s: %s: %w", alias, version, err)
+	}
+	return bb.Bytes(), yarpcerrors.CodeOK, nil
+}
+
+// programsDigest returns the key of the compiled programs of a package and its repositories: the package digest,
+// combined with the repository content digests if any.
+func programsDigest(digest string, repos map[string]string) string {
+	if len(repos) == 0 {
+		return digest
+	}
+	aliases := make([]string, 0, len(repos))
+	for alias := range repos {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	b := strings.Builder{}
+	b.WriteString(digest)
+	for _, alias := range aliases {
+		b.WriteString("\n" + alias + "=" + repos[alias])
+	}
+	return PackageRef([]byte(b.String()))
+}
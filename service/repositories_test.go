@@ -0,0 +1,108 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/cadence-workflow/starlark-worker/ext"
+	"go.starlark.net/starlark"
+	cad "go.uber.org/cadence"
+)
+
+func writeTestTar(files map[string]string) ([]byte, error) {
+	m := make(map[string][]byte, len(files))
+	for p, content := range files {
+		m[p] = []byte(content)
+	}
+	bb := bytes.Buffer{}
+	if err := ext.WriteTar(m, &bb); err != nil {
+		return nil, err
+	}
+	return bb.Bytes(), nil
+}
+
+func (r *CadTest) TestCadRepositories() {
+	repo := map[string]string{
+		"retry.star":    "load(\"./lib/util.star\", \"double\")\n\ndef retry(n):\n    return double(n)\n",
+		"lib/util.star": "load(\"//lib/base.star\", \"base\")\n\ndef double(n):\n    return base + n * 2\n",
+		"lib/base.star": "base = 100\n",
+	}
+	dir := r.T().TempDir()
+	for p, content := range repo {
+		p = filepath.Join(dir, "shared", "v1", p)
+		r.Require().NoError(os.MkdirAll(filepath.Dir(p), 0o755))
+		r.Require().NoError(os.WriteFile(p, []byte(content), 0o644))
+	}
+	repoTar, err := writeTestTar(repo)
+	r.Require().NoError(err)
+	store := &LocalPackageStore{Dir: r.T().TempDir()}
+	repoRef, err := store.Put(context.Background(), repoTar)
+	r.Require().NoError(err)
+
+	main := "load(\"@shared//retry.star\", \"retry\")\n\ndef main(n):\n    return retry(n)\n"
+	for _, tc := range []struct {
+		name string
+		meta string
+		err  string
+	}{
+		{name: "version", meta: `{"repositories": {"shared": "v1"}}`},
+		{name: "package-ref", meta: `{"repositories": {"shared": "` + repoRef + `"}}`},
+		{name: "not-pinned", meta: `{}`, err: "repository not found: shared"},
+		{name: "unknown-version", meta: `{"repositories": {"shared": "v2"}}`, err: "not-found"},
+		{name: "bad-version", meta: `{"repositories": {"shared": "../v1"}}`, err: "invalid-argument"},
+		{name: "not-configured", meta: `{"repositories": {"other": "v1"}}`, err: "failed-precondition"},
+	} {
+		r.Run(tc.name, func() {
+			r.SetupTest()
+			tar, err := writeTestTar(map[string]string{"meta.json": tc.meta, "main.star": main})
+			r.Require().NoError(err)
+			r.env.tar = tar
+			r.env.service.Repositories = map[string]string{"shared": filepath.Join(dir, "shared")}
+			r.env.service.PackageStore = store
+			r.env.ExecuteFunction("/main.star", "main", starlark.Tuple{starlark.MakeInt(1)}, nil, nil)
+
+			var res starlark.Int
+			err = r.env.GetResult(&res)
+			if tc.err == "" {
+				r.Require().NoError(err)
+				r.Require().Equal(starlark.MakeInt(102), res)
+				return
+			}
+			var customErr *cad.CustomError
+			r.Require().True(errors.As(err, &customErr), "unexpected error: %v", err)
+			var details any
+			r.Require().NoError(customErr.Details(&details))
+			r.Require().Contains(fmt.Sprintf("%s: %v", customErr.Reason(), details), tc.err)
+		})
+	}
+}
+
+func (r *CadTest) TestCadRepositoryModified() {
+	dir := r.T().TempDir()
+	base := filepath.Join(dir, "shared", "v1", "base.star")
+	r.Require().NoError(os.MkdirAll(filepath.Dir(base), 0o755))
+
+	// the compiled programs are cached by the repository content, not the package digest
+	tar, err := writeTestTar(map[string]string{
+		"meta.json": `{"repositories": {"shared": "v1"}}`,
+		"main.star": "load(\"@shared//base.star\", \"base\")\n\ndef main():\n    return base\n",
+	})
+	r.Require().NoError(err)
+	cache := r.env.service.cache
+	for _, v := range []int{1, 2} {
+		r.SetupTest()
+		r.Require().NoError(os.WriteFile(base, []byte(fmt.Sprintf("base = %d\n", v)), 0o644))
+		r.env.tar = tar
+		r.env.service.cache = cache
+		r.env.service.Repositories = map[string]string{"shared": filepath.Join(dir, "shared")}
+		r.env.ExecuteFunction("/main.star", "main", nil, nil, nil)
+
+		var res starlark.Int
+		r.Require().NoError(r.env.GetResult(&res))
+		r.Require().Equal(starlark.MakeInt(v), res)
+	}
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/cadence-workflow/starlark-worker/ext"
+	"github.com/cadence-workflow/starlark-worker/workflow"
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+// Duration is a time.Duration read from and written to JSON as a duration string, e.g. "15s" or "1h30m".
+type Duration time.Duration
+
+func (r Duration) MarshalJSON() ([]byte, error) {
+	return ext.JSON.Marshal(time.Duration(r).String())
+}
+
+func (r *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := ext.JSON.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration: %w", err)
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*r = Duration(d)
+	return nil
+}
+
+// ActivityOptions override the timeouts of the default activity options. Zero values keep the default.
+type ActivityOptions struct {
+	ScheduleToCloseTimeout Duration `json:"schedule_to_close_timeout,omitempty"`
+	ScheduleToStartTimeout Duration `json:"schedule_to_start_timeout,omitempty"`
+	StartToCloseTimeout    Duration `json:"start_to_close_timeout,omitempty"`
+	HeartbeatTimeout       Duration `json:"heartbeat_timeout,omitempty"`
+}
+
+// RetryPolicy overrides the fields of the default activity retry policy. Zero values keep the default.
+type RetryPolicy struct {
+	InitialInterval    Duration `json:"initial_interval,omitempty"`
+	BackoffCoefficient float64  `json:"backoff_coefficient,omitempty"`
+	MaximumInterval    Duration `json:"maximum_interval,omitempty"`
+	ExpirationInterval Duration `json:"expiration_interval,omitempty"`
+	MaximumAttempts    int32    `json:"maximum_attempts,omitempty"`
+}
+
+// RetryConfig overrides DefaultActivityOptions, DefaultRetryPolicy and DefaultNonRetriableErrorReasons.
+// The worker sets it via Service.Retry and a package via meta.json; the package config takes precedence.
+type RetryConfig struct {
+	DefaultActivityOptions *ActivityOptions `json:"default_activity_options,omitempty"`
+	DefaultRetryPolicy     *RetryPolicy     `json:"default_retry_policy,omitempty"`
+	// NonRetriableReasons replace the default non-retriable error reasons. An empty, non-nil list retries any
+	// error.
+	NonRetriableReasons []string `json:"non_retriable_reasons,omitempty"`
+}
+
+// LoadRetryConfig reads the retry config from the JSON file, in the format of the meta.json sections.
+func LoadRetryConfig(file string) (RetryConfig, error) {
+	var res RetryConfig
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return res, err
+	}
+	if err := ext.JSON.Unmarshal(b, &res); err != nil {
+		return res, fmt.Errorf("%s: %w", file, err)
+	}
+	return res, nil
+}
+
+// Override returns the config with the fields set in o, if any, replacing those of r.
+func (r RetryConfig) Override(o RetryConfig) RetryConfig {
+	if o.DefaultActivityOptions != nil {
+		ao := ActivityOptions{}
+		if r.DefaultActivityOptions != nil {
+			ao = *r.DefaultActivityOptions
+		}
+		override(&ao.ScheduleToCloseTimeout, o.DefaultActivityOptions.ScheduleToCloseTimeout)
+		override(&ao.ScheduleToStartTimeout, o.DefaultActivityOptions.ScheduleToStartTimeout)
+		override(&ao.StartToCloseTimeout, o.DefaultActivityOptions.StartToCloseTimeout)
+		override(&ao.HeartbeatTimeout, o.DefaultActivityOptions.HeartbeatTimeout)
+		r.DefaultActivityOptions = &ao
+	}
+	if o.DefaultRetryPolicy != nil {
+		rp := RetryPolicy{}
+		if r.DefaultRetryPolicy != nil {
+			rp = *r.DefaultRetryPolicy
+		}
+		override(&rp.InitialInterval, o.DefaultRetryPolicy.InitialInterval)
+		override(&rp.BackoffCoefficient, o.DefaultRetryPolicy.BackoffCoefficient)
+		override(&rp.MaximumInterval, o.DefaultRetryPolicy.MaximumInterval)
+		override(&rp.ExpirationInterval, o.DefaultRetryPolicy.ExpirationInterval)
+		override(&rp.MaximumAttempts, o.DefaultRetryPolicy.MaximumAttempts)
+		r.DefaultRetryPolicy = &rp
+	}
+	if o.NonRetriableReasons != nil {
+		r.NonRetriableReasons = o.NonRetriableReasons
+	}
+	return r
+}
+
+// Apply returns a copy of the activity options, with a copy of the retry policy, overridden by the config.
+func (r RetryConfig) Apply(ao workflow.ActivityOptions) workflow.ActivityOptions {
+	if o := r.DefaultActivityOptions; o != nil {
+		override(&ao.ScheduleToCloseTimeout, time.Duration(o.ScheduleToCloseTimeout))
+		override(&ao.ScheduleToStartTimeout, time.Duration(o.ScheduleToStartTimeout))
+		override(&ao.StartToCloseTimeout, time.Duration(o.StartToCloseTimeout))
+		override(&ao.HeartbeatTimeout, time.Duration(o.HeartbeatTimeout))
+	}
+	rp := workflow.RetryPolicy{}
+	if ao.RetryPolicy != nil {
+		rp = *ao.RetryPolicy
+	}
+	if o := r.DefaultRetryPolicy; o != nil {
+		override(&rp.InitialInterval, time.Duration(o.InitialInterval))
+		override(&rp.BackoffCoefficient, o.BackoffCoefficient)
+		override(&rp.MaximumInterval, time.Duration(o.MaximumInterval))
+		override(&rp.ExpirationInterval, time.Duration(o.ExpirationInterval))
+		override(&rp.MaximumAttempts, o.MaximumAttempts)
+	}
+	if r.NonRetriableReasons != nil {
+		rp.NonRetriableErrorReasons = r.NonRetriableReasons
+	}
+	if ao.RetryPolicy != nil || r.DefaultRetryPolicy != nil || r.NonRetriableReasons != nil {
+		rp.NonRetriableErrorReasons = append([]string(nil), rp.NonRetriableErrorReasons...)
+		ao.RetryPolicy = &rp
+	}
+	return ao
+}
+
+// Validate checks the default activity options overridden by the config.
+func (r RetryConfig) Validate() error {
+	return validateActivityOptions(r.Apply(DefaultActivityOptions))
+}
+
+// validateActivityOptions checks the options against the backend requirements, see workflow.ActivityOptions and
+// workflow.RetryPolicy.
+func validateActivityOptions(ao workflow.ActivityOptions) error {
+	var errs []error
+	if ao.ScheduleToStartTimeout <= 0 {
+		errs = append(errs, errors.New("schedule_to_start_timeout must be positive"))
+	}
+	if ao.StartToCloseTimeout <= 0 {
+		errs = append(errs, errors.New("start_to_close_timeout must be positive"))
+	}
+	if ao.ScheduleToCloseTimeout < 0 {
+		errs = append(errs, errors.New("schedule_to_close_timeout must not be negative"))
+	}
+	if ao.HeartbeatTimeout < 0 {
+		errs = append(errs, errors.New("heartbeat_timeout must not be negative"))
+	}
+	if rp := ao.RetryPolicy; rp != nil {
+		if rp.InitialInterval <= 0 {
+			errs = append(errs, errors.New("initial_interval must be positive"))
+		}
+		if rp.BackoffCoefficient < 1 {
+			errs = append(errs, fmt.Errorf("backoff_coefficient must be 1 or larger: %v", rp.BackoffCoefficient))
+		}
+		if rp.MaximumInterval != 0 && rp.MaximumInterval < rp.InitialInterval {
+			errs = append(errs, errors.New("maximum_interval must not be less than initial_interval"))
+		}
+		if rp.ExpirationInterval < 0 || rp.MaximumAttempts < 0 {
+			errs = append(errs, errors.New("expiration_interval and maximum_attempts must not be negative"))
+		}
+		if rp.ExpirationInterval == 0 && rp.MaximumAttempts == 0 {
+			errs = append(errs, errors.New("either expiration_interval or maximum_attempts is required"))
+		}
+		for _, reason := range rp.NonRetriableErrorReasons {
+			if reason == "" {
+				errs = append(errs, errors.New("non_retriable_reasons must not contain empty reasons"))
+				break
+			}
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid activity options: %w", err)
+	}
+	return nil
+}
+
+// activityOptions returns the default activity options overridden by the worker and then the package retry
+// config. Invalid options fail with the CodeInvalidArgument reason.
+func (r *Service) activityOptions(ctx workflow.Context, pkg RetryConfig) (workflow.ActivityOptions, error) {
+	ao := r.Retry.Override(pkg).Apply(DefaultActivityOptions)
+	ao.TaskList = r.ClientTaskList
+	if err := validateActivityOptions(ao); err != nil {
+		return ao, workflow.NewCustomError(ctx, yarpcerrors.CodeInvalidArgument.String(), err.Error())
+	}
+	return ao, nil
+}
+
+func override[T comparable](dst *T, v T) {
+	var zero T
+	if v != zero {
+		*dst = v
+	}
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cadence-workflow/starlark-worker/ext"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryConfigApply(t *testing.T) {
+	var meta Meta
+	require.NoError(t, ext.JSON.Unmarshal([]byte(`{
+		"main_file": "/app.star",
+		"default_activity_options": {"start_to_close_timeout": "1m"},
+		"default_retry_policy": {"maximum_attempts": 3},
+		"non_retriable_reasons": ["bad-request"]
+	}`), &meta))
+
+	worker := RetryConfig{
+		DefaultActivityOptions: &ActivityOptions{StartToCloseTimeout: Duration(time.Second * 30), HeartbeatTimeout: Duration(time.Second * 10)},
+		DefaultRetryPolicy:     &RetryPolicy{BackoffCoefficient: 2},
+	}
+	ao := worker.Override(meta.RetryConfig).Apply(DefaultActivityOptions)
+	require.NoError(t, validateActivityOptions(ao))
+
+	require.Equal(t, time.Minute, ao.StartToCloseTimeout)
+	require.Equal(t, time.Second*10, ao.HeartbeatTimeout)
+	require.Equal(t, DefaultActivityOptions.ScheduleToStartTimeout, ao.ScheduleToStartTimeout)
+	require.Equal(t, DefaultRetryPolicy.InitialInterval, ao.RetryPolicy.InitialInterval)
+	require.Equal(t, 2.0, ao.RetryPolicy.BackoffCoefficient)
+	require.Equal(t, int32(3), ao.RetryPolicy.MaximumAttempts)
+	require.Equal(t, []string{"bad-request"}, ao.RetryPolicy.NonRetriableErrorReasons)
+
+	// the defaults are left intact
+	require.Equal(t, time.Second*15, DefaultActivityOptions.StartToCloseTimeout)
+	require.Equal(t, DefaultNonRetriableErrorReasons, DefaultRetryPolicy.NonRetriableErrorReasons)
+	require.Equal(t, DefaultNonRetriableErrorReasons, RetryConfig{}.Apply(DefaultActivityOptions).RetryPolicy.NonRetriableErrorReasons)
+}
+
+func TestRetryConfigValidate(t *testing.T) {
+	require.NoError(t, RetryConfig{}.Validate())
+	require.NoError(t, RetryConfig{NonRetriableReasons: []string{}}.Validate())
+
+	err := RetryConfig{DefaultRetryPolicy: &RetryPolicy{BackoffCoefficient: 0.5}}.Validate()
+	require.ErrorContains(t, err, "backoff_coefficient must be 1 or larger: 0.5")
+
+	err = RetryConfig{DefaultRetryPolicy: &RetryPolicy{MaximumInterval: Duration(time.Second)}}.Validate()
+	require.ErrorContains(t, err, "maximum_interval must not be less than initial_interval")
+
+	err = RetryConfig{NonRetriableReasons: []string{"400", ""}}.Validate()
+	require.ErrorContains(t, err, "non_retriable_reasons must not contain empty reasons")
+
+	err = RetryConfig{DefaultActivityOptions: &ActivityOptions{HeartbeatTimeout: Duration(-time.Second)}}.Validate()
+	require.ErrorContains(t, err, "heartbeat_timeout must not be negative")
+
+	var config RetryConfig
+	err = ext.JSON.Unmarshal([]byte(`{"default_retry_policy": {"initial_interval": "soon"}}`), &config)
+	require.ErrorContains(t, err, "invalid duration")
+}
@@ -2,6 +2,8 @@ package service
 
 import (
 	"container/list"
+	"crypto/ed25519"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/cadence-workflow/starlark-worker/cadence"
@@ -10,7 +12,6 @@ import (
 	"github.com/cadence-workflow/starlark-worker/temporal"
 	"github.com/cadence-workflow/starlark-worker/worker"
 	"github.com/cadence-workflow/starlark-worker/workflow"
-	jsoniter "github.com/json-iterator/go"
 	"github.com/uber-go/tally"
 	"go.starlark.net/starlark"
 	"go.temporal.io/sdk/client"
@@ -33,15 +34,28 @@ var builtins = starlark.StringDict{
 type Meta struct {
 	MainFile     string `json:"main_file,omitempty"`
 	MainFunction string `json:"main_function,omitempty"`
+	// Entrypoints declares the functions of the package run by name: name -> entrypoint.
+	Entrypoints map[string]Entrypoint `json:"entrypoints,omitempty"`
+	Limits      Limits                `json:"limits"`
+	// Repositories pins the external repositories loaded as "@alias//path": alias -> version or package reference.
+	Repositories map[string]string `json:"repositories,omitempty"`
+	// RetryConfig overrides the worker's default activity options, retry policy and non-retriable reasons.
+	RetryConfig
 }
 
 type _Globals struct {
 	exitHooks  *ExitHooks
 	isCanceled bool
 	logs       *list.List
+	logLen     int
+	logSeq     int64
+	threads    int
 	environ    *starlark.Dict
 	progress   *list.List
 	plugins    map[string]IPlugin
+	limits     Limits
+	limitErr   error
+	modules    *star.ModuleCache
 }
 
 func (r *_Globals) getEnviron(key starlark.String) (starlark.String, bool) {
@@ -58,8 +72,33 @@ func (r *_Globals) getEnviron(key starlark.String) (starlark.String, bool) {
 type Service struct {
 	Plugins        map[string]IPlugin
 	ClientTaskList string
+	// Limits are the worker-level execution budgets. Packages and run environ may only tighten them.
+	Limits Limits
+	// PackageStore resolves package references (see PackageRef) passed to Run instead of the package content.
+	PackageStore PackageStore
+	// FetchPackagesViaActivity makes workflows fetch referenced packages missing from the in-memory cache via the
+	// FetchPackage activity, served by a worker with a PackageStore, instead of reading the store directly.
+	// The history then records the package content; otherwise, it only records the digest and the workers
+	// replaying the workflow must read the same (shared) store.
+	FetchPackagesViaActivity bool
+	// TrustedKeys are the public keys package signatures are verified against (see star.Sign).
+	TrustedKeys []ed25519.PublicKey
+	// RequireSignedPackages rejects packages without a signature by a trusted key.
+	RequireSignedPackages bool
+	// Repositories are the directories of the external repositories: alias -> directory with a subdirectory per
+	// version. Packages pin the versions in meta.json, see Meta.Repositories. The history records the content
+	// digest of the versions read: the workers replaying a workflow must read the same (shared) directories.
+	Repositories map[string]string
+	// Retry overrides the default activity options, retry policy and non-retriable error reasons. Packages may
+	// override it in meta.json, see Meta.RetryConfig.
+	Retry RetryConfig
+	// REPLChunksPerRun is the number of code chunks a REPL workflow run executes before it continues as new.
+	// Zero means DefaultREPLChunksPerRun.
+	REPLChunksPerRun int
 
 	workflow workflow.Workflow
+	packages *ext.LRU[string, []byte]
+	cache    *star.Cache
 }
 
 func NewService(plugins map[string]IPlugin, clientTaskList string, backendType BackendType) (*Service, error) {
@@ -73,15 +112,22 @@ func NewService(plugins map[string]IPlugin, clientTaskList string, backendType B
 		return nil, fmt.Errorf("unsupported backend: %s", backendType)
 	}
 
+	cache := star.NewCache(star.DefaultFSCacheSize, star.DefaultProgramCacheSize)
+	cache.OnProgram = func(t *starlark.Thread, hit bool) {
+		incCacheCounter(GetContext(t), "program", hit)
+	}
+
 	return &Service{
 		ClientTaskList: clientTaskList,
 		Plugins:        plugins,
 		workflow:       be,
+		packages:       ext.NewLRU[string, []byte](DefaultPackageCacheSize, func(tar []byte) int64 { return int64(len(tar)) }),
+		cache:          cache,
 	}, nil
 }
 
-// TODO: [feature] Cadence workflow with starlark REPL (event listener loop?) starlark.ExecREPLChunk()
-
+// Run is the main workflow: it runs the given function of the package. The tar argument is either the package
+// content or a package reference (see PackageRef) resolved via the PackageStore.
 func (r *Service) Run(
 	ctx workflow.Context,
 	tar []byte,
@@ -102,6 +148,9 @@ func (r *Service) Run(
 
 	logger := workflow.GetLogger(ctx)
 
+	defer func() {
+		err = workflow.ToWorkflowError(ctx, err)
+	}()
 	defer func() {
 		if rec := recover(); rec != nil {
 			logger.Error("workflow-panic", zap.Any("panic", rec))
@@ -120,12 +169,102 @@ func (r *Service) Run(
 		zap.Int("tar_len", len(tar)),
 	)
 
+	var execution *_Execution
+	call := &_Call{path: path, function: function}
+	if execution, err = r.start(ctx, tar, environ, call); err != nil {
+		return nil, err
+	}
+	ctx = execution.ctx
+	globals := execution.globals
+	path, function = call.path, call.function
+
+	if call.entrypoint != nil {
+		if kwargs, err = call.entrypoint.Bind(args, kwargs); err != nil {
+			err = workflow.NewCustomError(
+				ctx,
+				yarpcerrors.CodeInvalidArgument.String(),
+				fmt.Sprintf("%s: invalid arguments: %s", function, err.Error()),
+			)
+			logger.Error("workflow-error", ext.ZapError(err)...)
+			return nil, r.processError(ctx, err)
+		}
+	}
+
+	if err = checkPayloadSize(ctx, globals.limits, "arguments", args, kwargsTuple(kwargs)); err != nil {
+		logger.Error("workflow-error", ext.ZapError(err)...)
+		return nil, r.processError(ctx, err)
+	}
+
+	t := execution.newThread()
+
+	// Run main user code
+	if res, err = star.Call(t, path, function, args, kwargs); err == nil {
+		err = checkPayloadSize(ctx, globals.limits, "result", res)
+	}
+	if err != nil {
+		logger.Error("workflow-error", ext.ZapError(err)...)
+		if globals.limitErr != nil {
+			err = errors.Join(globals.limitErr, err)
+		}
+
+		var canceledErr workflow.CanceledError
+		if errors.As(err, &canceledErr) {
+			globals.isCanceled = true
+			ctx, _ = workflow.NewDisconnectedContext(ctx)
+		}
+	}
+
+	// Run exit hooks
+	if _err := globals.exitHooks.Run(t); _err != nil {
+		logger.Error("exit-hook-error", ext.ZapError(_err)...)
+		err = errors.Join(err, _err)
+	}
+
+	err = r.processError(ctx, err)
+
+	if err != nil {
+		exec := workflow.GetInfo(ctx)
+		tags := map[string]string{
+			"w_id":   exec.ExecutionID(),
+			"run_id": exec.RunID(),
+			"error":  err.Error(),
+		}
+		scope := workflow.GetMetricsScope(ctx)
+		switch scope.(type) {
+		case tally.Scope:
+			scope.(tally.Scope).Tagged(tags).Gauge("workflow.error").Update(1)
+		case client.MetricsHandler:
+			scope.(client.MetricsHandler).WithTags(tags).Gauge("workflow.error").Update(1)
+		default:
+			logger.Warn("workflow-warning", zap.String("error", "unknown-metrics-scope-type"))
+		}
+	}
+	logger.Info("workflow-end")
+	return res, err
+}
+
+// _Execution holds the per-execution state shared by the Run and REPL workflows.
+type _Execution struct {
+	ctx     workflow.Context
+	globals *_Globals
+	meta    Meta
+}
+
+// start prepares a workflow execution: sets the default options, globals, package file system, plugins and
+// query handlers. The call of a Run execution, if any, is resolved from the package meta.json, see _Call.
+func (r *Service) start(ctx workflow.Context, tar []byte, environ *starlark.Dict, call *_Call) (*_Execution, error) {
+	logger := workflow.GetLogger(ctx)
+
 	if environ == nil {
 		environ = &starlark.Dict{}
 	}
 
-	ao := DefaultActivityOptions
-	ao.TaskList = r.ClientTaskList
+	// the worker options apply to the activities fetching the package, if any
+	ao, err := r.activityOptions(ctx, RetryConfig{})
+	if err != nil {
+		logger.Error("workflow-error", ext.ZapError(err)...)
+		return nil, err
+	}
 	ctx = workflow.WithActivityOptions(ctx, ao)
 
 	cwo := DefaultChildWorkflowOptions
@@ -142,8 +281,22 @@ func (r *Service) Run(
 	}
 	ctx = workflow.WithValue(ctx, contextKeyGlobals, globals)
 
+	tar, err = r.resolvePackage(ctx, tar)
+	if err != nil {
+		logger.Error("workflow-error", ext.ZapError(err)...)
+		return nil, err
+	}
+
+	digest := PackageRef(tar)
 	var fs star.FS
-	if fs, err = star.NewTarFS(tar); err != nil {
+	if r.cache != nil {
+		var hit bool
+		fs, hit, err = r.cache.TarFS(digest, tar)
+		incCacheCounter(ctx, "package", hit)
+	} else {
+		fs, err = star.NewTarFS(tar)
+	}
+	if err != nil {
 		logger.Error("workflow-error", ext.ZapError(err)...)
 		return nil, workflow.NewCustomError(
 			ctx,
@@ -152,28 +305,58 @@ func (r *Service) Run(
 		)
 	}
 
-	meta := Meta{}
-	if b, err := fs.Read("/meta.json"); err != nil {
-		if !errors.Is(err, star.ErrNotExist) {
+	if err := r.verifySignature(ctx, fs); err != nil {
+		logger.Error("workflow-error", ext.ZapError(err)...)
+		return nil, err
+	}
+
+	meta, err := ReadMeta(fs)
+	if err == nil {
+		err = meta.Validate()
+	}
+	if err != nil {
+		logger.Error("workflow-error", ext.ZapError(err)...)
+		return nil, workflow.NewCustomError(
+			ctx,
+			yarpcerrors.CodeInvalidArgument.String(),
+			err.Error(),
+		)
+	}
+	retry := meta.RetryConfig
+	if call != nil {
+		if err := call.resolve(ctx, meta, environ, r.Plugins); err != nil {
+			logger.Error("workflow-error", ext.ZapError(err)...)
 			return nil, err
 		}
-	} else {
-		if err := jsoniter.Unmarshal(b, &meta); err != nil {
-			return nil, err
+		if call.entrypoint != nil {
+			retry = retry.Override(RetryConfig{DefaultActivityOptions: call.entrypoint.Timeouts.Activity})
 		}
 	}
-	logger.Info("workflow-meta", zap.Any("meta", meta))
-
-	if path == "" {
-		path = meta.MainFile
+	globals.logLen = getLogLen(ctx, globals)
+	if ao, err = r.activityOptions(ctx, retry); err != nil {
+		logger.Error("workflow-error", ext.ZapError(err)...)
+		return nil, err
 	}
-	if function == "" {
-		function = meta.MainFunction
+	ctx = workflow.WithActivityOptions(ctx, ao)
+	repos, repoDigests, err := r.openRepositories(ctx, meta.Repositories)
+	if err != nil {
+		logger.Error("workflow-error", ext.ZapError(err)...)
+		return nil, err
 	}
+	fs = &star.RepoFS{FS: fs, Repos: repos}
+	digest = programsDigest(digest, repoDigests)
+	globals.limits = r.Limits.Tighten(meta.Limits).Tighten(getEnvironLimits(ctx, globals))
+	logger.Info(
+		"workflow-meta",
+		zap.Any("meta", meta),
+		zap.Any("limits", globals.limits),
+		zap.Any("activity_options", ao),
+	)
 
 	runInfo := RunInfo{
 		Info:    workflow.GetInfo(ctx),
 		Environ: environ,
+		FS:      fs,
 	}
 
 	plugins := starlark.StringDict{}
@@ -181,14 +364,15 @@ func (r *Service) Run(
 		plugins[pID] = p.Create(runInfo)
 	}
 
-	if err := workflow.SetQueryHandler(ctx, "logs", func() (any, error) {
-		logs := make([]any, globals.logs.Len())
-		var i int
-		for e := globals.logs.Front(); e != nil; e = e.Next() {
-			logs[i] = e.Value
-			i++
-		}
-		return logs, nil
+	if err := workflow.SetQueryHandler(ctx, LogsQueryName, func() (any, error) {
+		return logMessages(globals.logs), nil
+	}); err != nil {
+		logger.Error("workflow-error", ext.ZapError(err)...)
+		return nil, err
+	}
+
+	if err := workflow.SetQueryHandler(ctx, LogEntriesQueryName, func(q *LogsQuery) (any, error) {
+		return queryLogs(globals.logs, q)
 	}); err != nil {
 		logger.Error("workflow-error", ext.ZapError(err)...)
 		return nil, err
@@ -207,79 +391,113 @@ func (r *Service) Run(
 		return nil, err
 	}
 
-	t := CreateThread(ctx)
-	t.Load = star.ThreadLoad(fs, builtins, map[string]starlark.StringDict{"plugin": plugins})
-
-	// Run main user code
-	if res, err = star.Call(t, path, function, args, kwargs); err != nil {
-		logger.Error("workflow-error", ext.ZapError(err)...)
-
-		var canceledErr workflow.CanceledError
-		if errors.As(err, &canceledErr) {
-			globals.isCanceled = true
-			ctx, _ = workflow.NewDisconnectedContext(ctx)
-		}
+	// modules are loaded once per run and shared by all its threads
+	modules := map[string]starlark.StringDict{"plugin": plugins}
+	if r.cache != nil {
+		globals.modules = star.NewModuleCache(r.cache.ThreadLoad(fs, digest, builtins, modules))
+	} else {
+		globals.modules = star.NewModuleCache(star.ThreadLoad(fs, builtins, modules))
 	}
+	globals.modules.NewLatch = newLoadLatch
 
-	// Run exit hooks
-	if _err := globals.exitHooks.Run(t); _err != nil {
-		logger.Error("exit-hook-error", ext.ZapError(_err)...)
-		err = errors.Join(err, _err)
-	}
+	return &_Execution{
+		ctx:     ctx,
+		globals: globals,
+		meta:    meta,
+	}, nil
+}
 
-	err = r.processError(ctx, err)
+// newThread creates a starlark thread that loads modules from the package file system and plugins.
+func (r *_Execution) newThread() *starlark.Thread {
+	return CreateThread(r.ctx)
+}
 
-	if err != nil {
-		exec := workflow.GetInfo(ctx)
-		tags := map[string]string{
-			"w_id":   exec.ExecutionID(),
-			"run_id": exec.RunID(),
-			"error":  err.Error(),
-		}
-		scope := workflow.GetMetricsScope(ctx)
-		switch scope.(type) {
-		case tally.Scope:
-			scope.(tally.Scope).Tagged(tags).Gauge("workflow.error").Update(1)
-		case client.MetricsHandler:
-			scope.(client.MetricsHandler).WithTags(tags).Gauge("workflow.error").Update(1)
-		default:
-			logger.Warn("workflow-warning", zap.String("error", "unknown-metrics-scope-type"))
-		}
+// newLoadLatch makes threads wait, via a workflow future, for a module being loaded by another thread.
+func newLoadLatch(t *starlark.Thread) (func(t *starlark.Thread), func()) {
+	future, settable := workflow.NewFuture(GetContext(t))
+	wait := func(t *starlark.Thread) { _ = future.Get(GetContext(t), nil) }
+	release := func() { settable.Set(nil, nil) }
+	return wait, release
+}
+
+// incCacheCounter reports a hit or miss of the given cache, e.g. "cache.package.hit".
+func incCacheCounter(ctx workflow.Context, cache string, hit bool) {
+	name := fmt.Sprintf("cache.%s.miss", cache)
+	if hit {
+		name = fmt.Sprintf("cache.%s.hit", cache)
+	}
+	switch scope := workflow.GetMetricsScope(ctx).(type) {
+	case tally.Scope:
+		scope.Counter(name).Inc(1)
+	case client.MetricsHandler:
+		scope.Counter(name).Inc(1)
 	}
-	logger.Info("workflow-end")
-	return res, err
 }
 
+// processError converts the error into the CustomError the workflow fails with. The reason is the one of the
+// first CustomError in the chain, e.g. raised by workflow.error, or "unknown". The details are a dictionary of
+// the error message, the Starlark backtrace and the details of the CustomError, encoded with star.EncodeTyped.
 func (r *Service) processError(ctx workflow.Context, err error) error {
 	if err == nil {
 		return nil
 	}
 	logger := workflow.GetLogger(ctx)
 
-	details := map[string]any{"error": err.Error()}
+	details := starlark.NewDict(3)
+	_ = details.SetKey(starlark.String("error"), starlark.String(err.Error()))
 	var evalErr *starlark.EvalError
 	if errors.As(err, &evalErr) {
 		logger.Error("starlark-backtrace", zap.String("backtrace", evalErr.Backtrace()))
-		details["backtrace"] = evalErr.Backtrace()
+		_ = details.SetKey(starlark.String("backtrace"), starlark.String(evalErr.Backtrace()))
 	}
-	var workflowErr workflow.CustomError
 	var reason = yarpcerrors.CodeUnknown.String()
-	if errors.As(err, &workflowErr) {
+	if workflowErr, ok := workflow.AsCustomError(ctx, err); ok {
 		reason = workflowErr.Reason()
 		if workflowErr.HasDetails() {
-			var d any
-			if err := workflowErr.Details(&d); err != nil {
+			d, err := ErrorDetails(workflowErr)
+			if err != nil {
 				logger.Error("workflow-error", ext.ZapError(err)...)
-				d = fmt.Sprintf("internal: error details extraction failure: %s", err.Error())
+				d = starlark.String(fmt.Sprintf("internal: error details extraction failure: %s", err.Error()))
 			}
-			details["details"] = d
+			_ = details.SetKey(starlark.String("details"), d)
 		}
 	}
-	return workflow.NewCustomError(ctx, reason, details)
+	// Encode the details with star.EncodeTyped, e.g. tuples and big integers, as parent workflows read them back as
+	// Starlark values (see ErrorDetails). Then pass the encoded JSON through unchanged, keys in order: failure details
+	// are not always encoded by the Starlark data converter.
+	b, encErr := star.EncodeTyped(details)
+	if encErr != nil {
+		logger.Error("workflow-error", ext.ZapError(encErr)...)
+		return workflow.NewCustomError(ctx, reason, err.Error())
+	}
+	return workflow.NewCustomError(ctx, reason, json.RawMessage(b))
+}
+
+// ErrorDetails returns the details of the CustomError as a Starlark value. Details are decoded into a Go value
+// first: Temporal failure details are decoded by the failure converter rather than the Starlark data converter.
+func ErrorDetails(customErr workflow.CustomError) (starlark.Value, error) {
+	var d any
+	if err := customErr.Details(&d); err != nil {
+		return nil, err
+	}
+	if v, ok := d.(starlark.Value); ok {
+		return v, nil // details of an error raised by this workflow, e.g. by workflow.error
+	}
+	b, err := ext.JSON.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	var res starlark.Value
+	if err := star.Decode(b, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
 }
 
 func (r *Service) Register(registry worker.Registry) {
 	registry.RegisterWorkflow(r.Run)
+	registry.RegisterWorkflow(r.REPL)
+	registry.RegisterActivityWithOptions(r.FetchPackage, worker.RegisterActivityOptions{Name: fetchPackageActivity})
 	for _, plugin := range r.Plugins {
 		plugin.Register(registry)
 	}
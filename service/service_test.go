@@ -34,6 +34,9 @@ func (t *TestPlugin) Register(registry worker.Registry) {
 }
 
 func stringifyActivityWrapper(t *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := CheckPayloadSize(t, "activity arguments", args); err != nil {
+		return nil, err
+	}
 	ctx := GetContext(t)
 	var res starlark.String
 	if err := workflow.ExecuteActivity(ctx, "stringify_activity", args).Get(ctx, &res); err != nil {
@@ -42,6 +45,25 @@ func stringifyActivityWrapper(t *starlark.Thread, b *starlark.Builtin, args star
 	return res, nil
 }
 
+// tryCall calls the function and returns the error message, or None on success. Limit errors are raised as-is,
+// as by workflow.try_call.
+func tryCall(t *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("%s: missing argument for fn", b.Name())
+	}
+	fn, ok := args[0].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("%s: for parameter fn: got %s, want callable", b.Name(), args[0].Type())
+	}
+	if _, err := starlark.Call(t, fn, args[1:], kwargs); err != nil {
+		if IsLimitError(t, err) {
+			return nil, err
+		}
+		return starlark.String(err.Error()), nil
+	}
+	return starlark.None, nil
+}
+
 func stringifyActivity(ctx context.Context, args starlark.Tuple) (starlark.String, error) {
 	logger := activity.GetLogger(ctx)
 	logger.Info("stringify_activity", zap.String("args", args.String()))
@@ -66,6 +88,7 @@ var properties = map[string]star.PropertyFactory{}
 
 var testBuiltins = map[string]*starlark.Builtin{
 	"stringify_activity": starlark.NewBuiltin("stringify_activity", stringifyActivityWrapper),
+	"try_call":           starlark.NewBuiltin("try_call", tryCall),
 }
 
 type CadTest struct {
@@ -0,0 +1,33 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/cadence-workflow/starlark-worker/star"
+	"github.com/cadence-workflow/starlark-worker/workflow"
+	"go.uber.org/yarpc/yarpcerrors"
+	"go.uber.org/zap"
+)
+
+// verifySignature checks the package signature against the worker's trusted keys before the package is used.
+// Unsigned packages are accepted unless RequireSignedPackages is set; signed packages must verify whenever
+// trusted keys are configured.
+func (r *Service) verifySignature(ctx workflow.Context, fs star.FS) error {
+	logger := workflow.GetLogger(ctx)
+	keyID, err := star.VerifySignature(fs, r.TrustedKeys)
+	switch {
+	case err == nil:
+		logger.Info("package-signature", zap.String("key_id", keyID))
+		return nil
+	case errors.Is(err, star.ErrUnsigned):
+		if !r.RequireSignedPackages {
+			return nil
+		}
+	case errors.Is(err, star.ErrBadSignature):
+		if !r.RequireSignedPackages && len(r.TrustedKeys) == 0 {
+			logger.Warn("package-signature-unverified", zap.String("reason", err.Error()))
+			return nil
+		}
+	}
+	return workflow.NewCustomError(ctx, yarpcerrors.CodePermissionDenied.String(), err.Error())
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"bytes"
+	"crypto/ed25519"
+
+	"github.com/cadence-workflow/starlark-worker/ext"
+	"github.com/cadence-workflow/starlark-worker/star"
+	"go.starlark.net/starlark"
+)
+
+func signTar(tar []byte, key ed25519.PrivateKey) ([]byte, error) {
+	files := map[string][]byte{}
+	if err := ext.ReadTar(bytes.NewReader(tar), func(p string, content []byte) error {
+		files[p] = content
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	sig, err := star.Sign(files, key)
+	if err != nil {
+		return nil, err
+	}
+	files[star.SignaturePath] = sig
+	bb := bytes.Buffer{}
+	if err := ext.WriteTar(files, &bb); err != nil {
+		return nil, err
+	}
+	return bb.Bytes(), nil
+}
+
+func (r *CadTest) TestCadSignedPackage() {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	r.Require().NoError(err)
+	otherPub, _, err := ed25519.GenerateKey(nil)
+	r.Require().NoError(err)
+	signed, err := signTar(r.env.tar, priv)
+	r.Require().NoError(err)
+
+	for _, tc := range []struct {
+		name    string
+		tar     []byte
+		trusted []ed25519.PublicKey
+		strict  bool
+		err     string
+	}{
+		{name: "signed", tar: signed, trusted: []ed25519.PublicKey{pub}, strict: true},
+		{name: "unsigned", trusted: []ed25519.PublicKey{pub}},
+		{name: "unsigned-strict", trusted: []ed25519.PublicKey{pub}, strict: true, err: "permission-denied"},
+		{name: "untrusted", tar: signed, trusted: []ed25519.PublicKey{otherPub}, err: "permission-denied"},
+		{name: "no-trusted-keys", tar: signed},
+	} {
+		r.Run(tc.name, func() {
+			r.SetupTest()
+			if tc.tar != nil {
+				r.env.tar = tc.tar
+			}
+			r.env.service.TrustedKeys = tc.trusted
+			r.env.service.RequireSignedPackages = tc.strict
+			r.env.ExecuteFunction("/app.star", "plus", starlark.Tuple{starlark.MakeInt(2), starlark.MakeInt(3)}, nil, nil)
+
+			var res starlark.Int
+			if tc.err != "" {
+				r.Require().ErrorContains(r.env.GetResult(&res), tc.err)
+				return
+			}
+			r.Require().NoError(r.env.GetResult(&res))
+			r.Require().Equal(starlark.MakeInt(5), res)
+		})
+	}
+}
+
+func (r *TempTest) TestTempSignedPackage() {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	r.Require().NoError(err)
+	signed, err := signTar(r.env.tar, priv)
+	r.Require().NoError(err)
+
+	r.env.tar = signed
+	r.env.service.TrustedKeys = []ed25519.PublicKey{pub}
+	r.env.service.RequireSignedPackages = true
+	r.env.ExecuteFunction("/app.star", "plus", starlark.Tuple{starlark.MakeInt(2), starlark.MakeInt(3)}, nil, nil)
+
+	var res starlark.Int
+	r.Require().NoError(r.env.GetResult(&res))
+	r.Require().Equal(starlark.MakeInt(5), res)
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"go.starlark.net/resolve"
 	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
 	tmpactivity "go.temporal.io/sdk/activity"
 	temptestsuite "go.temporal.io/sdk/testsuite"
 	tmpworker "go.temporal.io/sdk/worker"
@@ -74,13 +75,16 @@ func (r cadRegistry) RegisterActivityWithOptions(a interface{}, opt worker.Regis
 	})
 }
 func (r cadRegistry) RegisterWorkflow(w interface{}) {
-	wf, _ := cadence.UpdateWorkflowFunctionContextArgument(w)
-	r.env.RegisterWorkflow(wf)
+	wf, name := cadence.UpdateWorkflowFunctionContextArgument(w)
+	r.env.RegisterWorkflowWithOptions(wf, cadworkflow.RegisterOptions{Name: name})
 }
 func (r cadRegistry) RegisterWorkflowWithOptions(w interface{}, options worker.RegisterWorkflowOptions) {
-	wf, _ := cadence.UpdateWorkflowFunctionContextArgument(w)
+	wf, name := cadence.UpdateWorkflowFunctionContextArgument(w)
+	if options.Name != "" {
+		name = options.Name
+	}
 	r.env.RegisterWorkflowWithOptions(wf, cadworkflow.RegisterOptions{
-		Name:                          options.Name,
+		Name:                          name,
 		EnableShortName:               options.EnableShortName,
 		DisableAlreadyRegisteredCheck: options.DisableAlreadyRegisteredCheck,
 	})
@@ -111,8 +115,8 @@ func (r *StarCadTestEnvironment) ExecuteFunction(
 	environ *starlark.Dict,
 ) {
 	env := r.env
-	wf, _ := cadence.UpdateWorkflowFunctionContextArgument(r.service.Run)
-	env.ExecuteWorkflow(wf, r.tar, filePath, fn, args, kw, environ)
+	_, name := cadence.UpdateWorkflowFunctionContextArgument(r.service.Run)
+	env.ExecuteWorkflow(name, r.tar, filePath, fn, args, kw, environ)
 }
 
 func (r *StarCadTestEnvironment) GetResult(valuePtr any) error {
@@ -153,12 +157,69 @@ func (r *StarCadTestEnvironment) getGlobals(filePath string) ([]*resolve.Binding
 	if err != nil {
 		return nil, err
 	}
+	if err := checkLoads(r.fs, filePath, code); err != nil {
+		return nil, err
+	}
 	if err := resolve.File(code, func(s string) bool { return true }, starlark.Universe.Has); err != nil {
 		return nil, err
 	}
 	return code.Module.(*resolve.Module).Globals, nil
 }
 
+// checkLoads makes sure the modules loaded by the given file, resolved the same way the worker does
+// (see star.ResolveLoad), exist in the package.
+func checkLoads(fs star.FS, filePath string, code *syntax.File) error {
+	for _, stmt := range code.Stmts {
+		load, ok := stmt.(*syntax.LoadStmt)
+		if !ok {
+			continue
+		}
+		module := load.ModuleName()
+		p, err := star.ResolveLoad(filePath, module)
+		if err != nil {
+			return err
+		}
+		if star.IsPlugin(p) {
+			continue
+		}
+		if alias, _, ok := star.SplitRepo(p); ok {
+			if repoFS, isRepoFS := fs.(*star.RepoFS); !isRepoFS || repoFS.Repos[alias] == nil {
+				continue // pinned by package reference, or not pinned: reported on run
+			}
+		}
+		if _, err := fs.Read(p); err != nil {
+			return fmt.Errorf("%s: load(%q): %w", filePath, module, err)
+		}
+	}
+	return nil
+}
+
+// withRepositories adds the external repositories pinned in the package meta.json to the package file system,
+// resolved the same way the worker does. Repositories pinned by package reference are left out.
+func withRepositories(fs star.FS, dirs map[string]string) (star.FS, error) {
+	meta, err := ReadMeta(fs)
+	if err != nil {
+		return nil, err
+	}
+	if len(meta.Repositories) == 0 {
+		return fs, nil
+	}
+	repos := map[string]star.FS{}
+	for alias, pin := range meta.Repositories {
+		if _, isRef := ParsePackageRef([]byte(pin)); isRef {
+			continue
+		}
+		tar, _, err := readRepository(dirs, alias, pin)
+		if err != nil {
+			return nil, err
+		}
+		if repos[alias], err = star.NewTarFS(tar); err != nil {
+			return nil, err
+		}
+	}
+	return &star.RepoFS{FS: fs, Repos: repos}, nil
+}
+
 type StarCadTestSuite struct {
 	testsuite.WorkflowTestSuite
 	tarCache map[string][]byte
@@ -168,6 +229,8 @@ type StarCadTestSuite struct {
 type StarCadTestEnvironmentParams struct {
 	RootDirectory string
 	Plugins       map[string]IPlugin
+	// Repositories are the external repository directories, see Service.Repositories.
+	Repositories map[string]string
 }
 
 // NewCadEnvironment creates a new StarTestEnvironment - test environment for the Starlark functions.
@@ -209,6 +272,10 @@ func (r *StarCadTestSuite) NewCadEnvironment(t *testing.T, p *StarCadTestEnviron
 		r.fsCache[p.RootDirectory] = fs
 	}
 
+	service.Repositories = p.Repositories
+	fs, err = withRepositories(fs, p.Repositories)
+	require.NoError(t, err)
+
 	return &StarCadTestEnvironment{env: env, service: service, tar: tar, fs: fs}
 }
 
@@ -268,13 +335,16 @@ func (r tempRegistry) RegisterActivityWithOptions(a interface{}, opt worker.Regi
 	})
 }
 func (r tempRegistry) RegisterWorkflow(w interface{}) {
-	wf, _ := temporal.UpdateWorkflowFunctionContextArgument(w)
-	r.env.RegisterWorkflow(wf)
+	wf, name := temporal.UpdateWorkflowFunctionContextArgument(w)
+	r.env.RegisterWorkflowWithOptions(wf, tmpworkflow.RegisterOptions{Name: name})
 }
 func (r tempRegistry) RegisterWorkflowWithOptions(w interface{}, options worker.RegisterWorkflowOptions) {
-	wf, _ := temporal.UpdateWorkflowFunctionContextArgument(w)
+	wf, name := temporal.UpdateWorkflowFunctionContextArgument(w)
+	if options.Name != "" {
+		name = options.Name
+	}
 	r.env.RegisterWorkflowWithOptions(wf, tmpworkflow.RegisterOptions{
-		Name:                          options.Name,
+		Name:                          name,
 		DisableAlreadyRegisteredCheck: options.DisableAlreadyRegisteredCheck,
 	})
 }
@@ -301,8 +371,8 @@ func (r *StarTempTestEnvironment) ExecuteFunction(
 	kw []starlark.Tuple,
 	environ *starlark.Dict,
 ) {
-	wf, _ := temporal.UpdateWorkflowFunctionContextArgument(r.service.Run)
-	r.env.ExecuteWorkflow(wf, r.tar, filePath, fn, args, kw, environ)
+	_, name := temporal.UpdateWorkflowFunctionContextArgument(r.service.Run)
+	r.env.ExecuteWorkflow(name, r.tar, filePath, fn, args, kw, environ)
 }
 
 func (r *StarTempTestEnvironment) GetResult(valuePtr any) error {
@@ -339,6 +409,9 @@ func (r *StarTempTestEnvironment) getGlobals(filePath string) ([]*resolve.Bindin
 	if err != nil {
 		return nil, err
 	}
+	if err := checkLoads(r.fs, filePath, code); err != nil {
+		return nil, err
+	}
 	if err := resolve.File(code, func(string) bool { return true }, starlark.Universe.Has); err != nil {
 		return nil, err
 	}
@@ -354,6 +427,8 @@ type StarTempTestSuite struct {
 type StarTempTestEnvironmentParams struct {
 	RootDirectory string
 	Plugins       map[string]IPlugin
+	// Repositories are the external repository directories, see Service.Repositories.
+	Repositories map[string]string
 }
 
 func (r *StarTempTestSuite) NewTempEnvironment(t *testing.T, p *StarTempTestEnvironmentParams) *StarTempTestEnvironment {
@@ -363,7 +438,7 @@ func (r *StarTempTestSuite) NewTempEnvironment(t *testing.T, p *StarTempTestEnvi
 		BackgroundActivityContext: ctx,
 	})
 	env.SetContextPropagators([]tmpworkflow.ContextPropagator{&temporal.HeadersContextPropagator{}})
-	env.SetDataConverter(temporal.DataConverter{})
+	env.SetDataConverter(temporal.NewDataConverter())
 	service, serviceErr := NewService(p.Plugins, "test", TemporalBackend)
 	require.NoError(t, serviceErr)
 
@@ -391,6 +466,10 @@ func (r *StarTempTestSuite) NewTempEnvironment(t *testing.T, p *StarTempTestEnvi
 		r.fsCache[p.RootDirectory] = fs
 	}
 
+	service.Repositories = p.Repositories
+	fs, err = withRepositories(fs, p.Repositories)
+	require.NoError(t, err)
+
 	return &StarTempTestEnvironment{
 		env:     env,
 		service: service,
@@ -1,43 +1,39 @@
 package service
 
 import (
-	"strconv"
+	"fmt"
 
 	"github.com/cadence-workflow/starlark-worker/workflow"
 	"go.starlark.net/starlark"
-	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 const (
-	threadLocalContextKey = "context"
-	envLogLen             = starlark.String("STAR_CORE_LOG_LEN")
-	defaultLogLen         = 1000
+	threadLocalContextKey    = "context"
+	threadLocalStepBudgetKey = "step_budget"
+	mainThreadName           = "main"
 )
 
 func CreateThread(ctx workflow.Context) *starlark.Thread {
-	logger := workflow.GetLogger(ctx)
 	globals := getGlobals(ctx)
 
-	ll := defaultLogLen
-	if v, found := globals.getEnviron(envLogLen); found {
-		var err error
-		if ll, err = strconv.Atoi(v.GoString()); err != nil {
-			logger.Error("invalid environ", zap.String("environ_name", envLogLen.GoString()), zap.String("environ_value", v.GoString()))
-			ll = defaultLogLen
-		}
+	name := mainThreadName
+	if globals.threads > 0 {
+		name = fmt.Sprintf("thread-%d", globals.threads)
 	}
+	globals.threads++
 
-	logs := globals.logs
 	t := &starlark.Thread{
+		Name: name,
 		Print: func(t *starlark.Thread, msg string) {
-			logger.Info(msg)
-			logs.PushBack(msg)
-			if logs.Len() > ll {
-				logs.Remove(logs.Front())
-			}
+			_ = WriteLog(t, zapcore.InfoLevel, msg, nil) // no fields to encode: never fails
 		},
 	}
+	if globals.modules != nil {
+		t.Load = globals.modules.Load
+	}
 	t.SetLocal(threadLocalContextKey, ctx)
+	setStepBudget(t, globals.limits)
 	return t
 }
 
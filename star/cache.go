@@ -0,0 +1,86 @@
+package star
+
+import (
+	"github.com/cadence-workflow/starlark-worker/ext"
+	"go.starlark.net/starlark"
+)
+
+const (
+	// DefaultFSCacheSize is the default size (bytes of uncompressed files) of the package file system cache.
+	DefaultFSCacheSize = 512 << 20
+	// DefaultProgramCacheSize is the default size (bytes of source code) of the compiled program cache.
+	DefaultProgramCacheSize = 128 << 20
+)
+
+// Cache caches parsed packages by content digest and compiled programs by (digest, path), so executions and
+// replays of the same package skip decompressing the tar and compiling the sources.
+type Cache struct {
+	fs       *ext.LRU[string, *_TarFS]
+	programs *ext.LRU[programKey, *_Program]
+
+	// OnProgram is called on every compiled program lookup, e.g. to report hit/miss metrics.
+	OnProgram func(t *starlark.Thread, hit bool)
+}
+
+type programKey struct {
+	digest string
+	path   string
+}
+
+type _Program struct {
+	prog *starlark.Program
+	size int64
+}
+
+func NewCache(fsSize int64, programSize int64) *Cache {
+	return &Cache{
+		fs:       ext.NewLRU[string, *_TarFS](fsSize, func(fs *_TarFS) int64 { return fs.size }),
+		programs: ext.NewLRU[programKey, *_Program](programSize, func(p *_Program) int64 { return p.size }),
+	}
+}
+
+// TarFS returns the package file system of the given tar, identified by its content digest.
+// Reports whether the file system is found in the cache.
+func (r *Cache) TarFS(digest string, tar []byte) (FS, bool, error) {
+	if fs, found := r.fs.Get(digest); found {
+		return fs, true, nil
+	}
+	fs, err := newTarFS(tar)
+	if err != nil {
+		return nil, false, err
+	}
+	r.fs.Add(digest, fs)
+	return fs, false, nil
+}
+
+// ThreadLoad is similar to the ThreadLoad function, but reuses the programs compiled from the package with
+// the given digest. The predeclared names must be the same for all the threads loading from the cache.
+func (r *Cache) ThreadLoad(
+	fs FS,
+	digest string,
+	predeclared starlark.StringDict,
+	modules map[string]starlark.StringDict,
+) func(*starlark.Thread, string) (starlark.StringDict, error) {
+	return threadLoad(fs, modules, func(t *starlark.Thread, path string, src []byte) (starlark.StringDict, error) {
+		key := programKey{digest: digest, path: path}
+		p, hit := r.programs.Get(key)
+		if r.OnProgram != nil {
+			r.OnProgram(t, hit)
+		}
+		if !hit {
+			_, prog, err := starlark.SourceProgramOptions(FileOptions, path, src, predeclared.Has)
+			if err != nil {
+				return nil, err
+			}
+			p = &_Program{prog: prog, size: int64(len(src))}
+			r.programs.Add(key, p)
+		}
+		return initProgram(t, p.prog, predeclared)
+	})
+}
+
+// FSStats returns the file system cache counters.
+func (r *Cache) FSStats() ext.LRUStats { return r.fs.Stats() }
+
+// ProgramStats returns the compiled program cache counters.
+func (r *Cache) ProgramStats() ext.LRUStats { return r.programs.Stats() }
@@ -0,0 +1,88 @@
+package star
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/cadence-workflow/starlark-worker/ext"
+	"github.com/stretchr/testify/require"
+	"go.starlark.net/starlark"
+)
+
+func TestCache(t *testing.T) {
+	files := map[string][]byte{
+		"/lib.star":  []byte("def plus(a, b):\n    return a + b\n"),
+		"/main.star": []byte("load(\"/lib.star\", \"plus\")\nres = plus(x, 2)\n"),
+	}
+	bb := bytes.Buffer{}
+	require.NoError(t, ext.WriteTar(files, &bb))
+	tar := bb.Bytes()
+
+	cache := NewCache(1<<20, 1<<20)
+	var hits, misses int
+	cache.OnProgram = func(_ *starlark.Thread, hit bool) {
+		if hit {
+			hits++
+		} else {
+			misses++
+		}
+	}
+	predeclared := starlark.StringDict{"x": starlark.MakeInt(40)}
+
+	for i := 0; i < 3; i++ {
+		fs, hit, err := cache.TarFS("digest", tar)
+		require.NoError(t, err)
+		require.Equal(t, i > 0, hit)
+
+		// a new thread per run: the module globals are not shared, the compiled programs are
+		thread := &starlark.Thread{}
+		thread.Load = cache.ThreadLoad(fs, "digest", predeclared, nil)
+		globals, err := thread.Load(thread, "/main.star")
+		require.NoError(t, err)
+		require.Equal(t, starlark.MakeInt(42), globals["res"])
+	}
+	require.Equal(t, 4, hits)
+	require.Equal(t, 2, misses)
+	require.Equal(t, ext.LRUStats{Hits: 2, Misses: 1}, cache.FSStats())
+	require.Equal(t, ext.LRUStats{Hits: 4, Misses: 2}, cache.ProgramStats())
+
+	// compile errors are not cached
+	bb.Reset()
+	require.NoError(t, ext.WriteTar(map[string][]byte{"/bad.star": []byte("def")}, &bb))
+	badFS, _, err := cache.TarFS("bad", bb.Bytes())
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		thread := &starlark.Thread{}
+		thread.Load = cache.ThreadLoad(badFS, "bad", nil, nil)
+		_, err = thread.Load(thread, "/bad.star")
+		require.Error(t, err)
+	}
+	require.Equal(t, ext.LRUStats{Hits: 4, Misses: 4}, cache.ProgramStats())
+
+	// both the cached and the uncached loads freeze the modules reached via load(), and return no globals on failure
+	bb.Reset()
+	require.NoError(t, ext.WriteTar(map[string][]byte{
+		"/lib.star":  []byte("items = [1]\n"),
+		"/mut.star":  []byte("load(\"./lib.star\", \"items\")\nitems.append(2)\n"),
+		"/main.star": []byte("items = [1]\n"),
+		"/fail.star": []byte("items = [1]\nfail(\"boom\")\n"),
+	}, &bb))
+	mutFS, _, err := cache.TarFS("mut", bb.Bytes())
+	require.NoError(t, err)
+	for _, load := range []func(*starlark.Thread, string) (starlark.StringDict, error){
+		cache.ThreadLoad(mutFS, "mut", nil, nil),
+		ThreadLoad(mutFS, nil, nil),
+	} {
+		thread := &starlark.Thread{Load: load}
+		_, err := thread.Load(thread, "/mut.star")
+		require.ErrorContains(t, err, "frozen")
+
+		g, err := thread.Load(thread, "/main.star")
+		require.NoError(t, err)
+		require.NoError(t, g["items"].(*starlark.List).Append(starlark.MakeInt(2)))
+
+		g, err = thread.Load(thread, "/fail.star")
+		require.ErrorContains(t, err, "boom")
+		require.Nil(t, g)
+	}
+}
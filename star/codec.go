@@ -16,9 +16,41 @@ var (
 	b64     = base64.StdEncoding
 )
 
-type UnsupportedTypeError error
+// Codec dictionaries: JSON objects with the "__codec__" key encode starlark values that have no JSON counterpart.
+// Tuples, sets and dicts with non-string keys (or a "__codec__" key) hold their elements in "items", bytes hold
+// the base64 content in "data": {"__codec__": "tuple", "__codec_version__": 1, "items": [1, 2]}. Only EncodeTyped
+// writes them, Decode reads them all. The version marks them apart from the user dicts of the same layout
+// recorded before they were introduced, which are decoded as dicts. See also: codecDictReplacer
+const (
+	codecKey        = "__codec__"
+	codecVersionKey = "__codec_version__"
+	codecVersion    = 1
+	codecTuple      = "tuple"
+	codecSet        = "set"
+	codecBytes      = "bytes"
+	codecDict       = "dict"
+)
+
+// UnsupportedTypeError is the error of values, or outputs, of a type the codecs do not support: callers may fall
+// back to another encoding. Other errors, e.g. of colliding dict keys, must not fall back.
+type UnsupportedTypeError struct{ error }
 
+// Encode encodes the value to the plain JSON Go code decodes: tuples and sets are lists, bytes are base64 strings,
+// dict keys are strings. Dataclasses and the types of RegisterCodec are encoded as codec dictionaries.
+// See also: EncodeTyped
 func Encode(v any) ([]byte, error) {
+	return encode(v, false)
+}
+
+// EncodeTyped encodes the value to JSON type-preserving, for the values only Starlark code decodes: tuples, sets,
+// nested bytes and dicts with non-string keys are also encoded as codec dictionaries, restored by Decode.
+// The top-level bytes (a base64 string) and tuple (a list, the positional arguments format) are encoded as
+// by Encode.
+func EncodeTyped(v any) ([]byte, error) {
+	return encode(v, true)
+}
+
+func encode(v any, typed bool) ([]byte, error) {
 	switch v := v.(type) {
 	case starlark.Bytes:
 		// bytes: base 64
@@ -36,7 +68,7 @@ func Encode(v any) ([]byte, error) {
 		var res bytes.Buffer
 		res.WriteRune('[')
 		for i, tuple := range v {
-			r, err := Encode(tuple)
+			r, err := encode(tuple, typed)
 			if err != nil {
 				return nil, err
 			}
@@ -53,17 +85,166 @@ func Encode(v any) ([]byte, error) {
 		}
 		switch v := v.(type) {
 		case starlark.Value:
-			r, err := _encode.CallInternal(nil, starlark.Tuple{v}, nil)
+			if tuple, ok := v.(*starlark.Tuple); ok {
+				v = *tuple
+			}
+			var err error
+			if tuple, ok := v.(starlark.Tuple); ok {
+				v, err = codecList(tuple, typed)
+			} else {
+				v, err = codecValue(v, typed)
+			}
 			if err != nil {
 				return nil, err
 			}
-			return []byte(r.(starlark.String)), err
+			return encodeJSON(v)
 		default:
-			return nil, UnsupportedTypeError(
+			return nil, UnsupportedTypeError{
 				fmt.Errorf("unsupported value type: expected: starlark type, actual: (%T) %v", v, v),
-			)
+			}
+		}
+	}
+}
+
+// EncodeJSON encodes the value to the standard JSON, without codec dictionaries: tuples and sets are lists,
+// bytes are base64 strings at the top-level only, dict keys must be strings.
+func EncodeJSON(v starlark.Value) ([]byte, error) {
+	if _, ok := v.(starlark.Bytes); ok || isNilValue(v) {
+		return Encode(v)
+	}
+	return encodeJSON(v)
+}
+
+func encodeJSON(v starlark.Value) ([]byte, error) {
+	r, err := _encode.CallInternal(nil, starlark.Tuple{v}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(r.(starlark.String)), nil
+}
+
+// codecValue returns a copy of the value where the values JSON can't represent are replaced with codec dictionaries
+// if typed, or with their plain JSON counterparts otherwise: lists and base64 strings.
+func codecValue(v starlark.Value, typed bool) (starlark.Value, error) {
+	switch v := v.(type) {
+	case starlark.Tuple:
+		if !typed {
+			return codecList(v, typed)
+		}
+		return codecItems(codecTuple, v)
+	case *starlark.Set:
+		if !typed {
+			return codecList(v, typed)
+		}
+		return codecItems(codecSet, v)
+	case starlark.Bytes:
+		if !typed {
+			return starlark.String(b64.EncodeToString([]byte(v))), nil
+		}
+		return typedCodecDict(codecBytes, "data", starlark.String(b64.EncodeToString([]byte(v)))), nil
+	case *_Dataclass:
+		res, err := codecStringDict(StringDictToDict(v.attrs), typed)
+		if err != nil {
+			return nil, err
+		}
+		SetStringKey(res, codecKey, starlark.String(DataclassType))
+		return res, nil
+	case *starlark.Dict:
+		if !typed {
+			return codecStringDict(v, typed)
+		}
+		for _, item := range v.Items() {
+			if k, ok := item[0].(starlark.String); !ok || k == codecKey {
+				items := starlark.NewList(nil)
+				for _, item := range v.Items() {
+					kv, err := codecList(item, typed)
+					if err != nil {
+						return nil, err
+					}
+					_ = items.Append(kv)
+				}
+				return typedCodecDict(codecDict, "items", items), nil
+			}
+		}
+		return codecStringDict(v, typed)
+	case *starlark.List:
+		return codecList(v, typed)
+	case starlark.NoneType, starlark.Bool, starlark.Int, starlark.Float, starlark.String:
+		return v, nil
+	default:
+		if res, ok, err := codecCustom(v, typed); ok {
+			return res, err
+		}
+		return v, nil
+	}
+}
+
+func codecItems(codec string, v starlark.Iterable) (starlark.Value, error) {
+	items, err := codecList(v, true)
+	if err != nil {
+		return nil, err
+	}
+	return typedCodecDict(codec, "items", items), nil
+}
+
+// typedCodecDict returns the versioned codec dictionary of the given codec and content.
+func typedCodecDict(codec string, key string, v starlark.Value) *starlark.Dict {
+	res := starlark.NewDict(3)
+	SetStringKey(res, codecKey, starlark.String(codec))
+	SetStringKey(res, codecVersionKey, starlark.MakeInt(codecVersion))
+	SetStringKey(res, key, v)
+	return res
+}
+
+// isTypedCodecDict reports whether the dict is a versioned codec dictionary with the given content key.
+func isTypedCodecDict(dict *starlark.Dict, key string) bool {
+	if dict.Len() != 3 {
+		return false
+	}
+	version, found, _ := dict.Get(starlark.String(codecVersionKey))
+	if !found || version != starlark.MakeInt(codecVersion) {
+		return false
+	}
+	_, found, _ = dict.Get(starlark.String(key))
+	return found
+}
+
+func codecList(v starlark.Iterable, typed bool) (*starlark.List, error) {
+	var elems []starlark.Value
+	it := v.Iterate()
+	defer it.Done()
+	var el starlark.Value
+	for it.Next(&el) {
+		r, err := codecValue(el, typed)
+		if err != nil {
+			return nil, err
 		}
+		elems = append(elems, r)
 	}
+	return starlark.NewList(elems), nil
+}
+
+// codecStringDict returns a copy of the dict with string keys: keys of other types are converted to strings,
+// e.g. 1 to "1", as by the Python json module. Fails if converted keys collide, e.g. 1 and "1".
+func codecStringDict(v *starlark.Dict, typed bool) (*starlark.Dict, error) {
+	res := starlark.NewDict(v.Len() + 1)
+	for _, item := range v.Items() {
+		r, err := codecValue(item[1], typed)
+		if err != nil {
+			return nil, err
+		}
+		k, ok := item[0].(starlark.String)
+		if !ok {
+			k = starlark.String(item[0].String())
+		}
+		if _, found, _ := res.Get(k); found {
+			return nil, fmt.Errorf("dict key collision: %s encodes to the key %s of another entry", item[0], k)
+		}
+		if err := res.SetKey(k, r); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
 }
 
 func Decode(line []byte, out any) (err error) {
@@ -128,12 +309,8 @@ func Decode(line []byte, out any) (err error) {
 			return fmt.Errorf("incompatible data: output type: %T", out)
 		}
 	default:
-		_out = _out.Elem()
-		starlarkValueType := reflect.TypeOf((*starlark.Value)(nil)).Elem()
-		if !_out.Type().AssignableTo(starlarkValueType) {
-			return UnsupportedTypeError(
-				fmt.Errorf("unsupported output type: expected: %v assignable, actual: %v", starlarkValueType, _out.Type()),
-			)
+		if err := checkValueOutput(_out); err != nil {
+			return err
 		}
 		var value starlark.Value
 		if value, err = _decode.CallInternal(nil, starlark.Tuple{starlark.String(line)}, nil); err != nil {
@@ -142,47 +319,122 @@ func Decode(line []byte, out any) (err error) {
 		if value, err = replaceDict(value, codecDictReplacer); err != nil {
 			return err
 		}
+		return setValue(out, value)
+	}
+	return nil
+}
 
-		switch out := out.(type) {
-		case *starlark.Tuple:
-			switch value := value.(type) {
-			case *starlark.List:
-				*out = tupleFromList(value)
-			case starlark.NoneType:
-				*out = nil
-			default:
-				return fmt.Errorf("incompatible data: output type: %T", out)
-			}
+var starlarkValueType = reflect.TypeOf((*starlark.Value)(nil)).Elem()
+
+// checkValueOutput fails with UnsupportedTypeError unless the output is a pointer to a starlark value.
+func checkValueOutput(out reflect.Value) error {
+	if t := out.Type().Elem(); !t.AssignableTo(starlarkValueType) {
+		return UnsupportedTypeError{
+			fmt.Errorf("unsupported output type: expected: %v assignable, actual: %v", starlarkValueType, t),
+		}
+	}
+	return nil
+}
+
+// setValue sets the decoded value to the output starlark value pointer. Tuples are also decoded from lists.
+func setValue(out any, value starlark.Value) error {
+	switch out := out.(type) {
+	case *starlark.Tuple:
+		switch value := value.(type) {
+		case *starlark.List:
+			*out = tupleFromList(value)
+		case starlark.Tuple:
+			*out = value
+		case starlark.NoneType:
+			*out = nil
 		default:
-			_out.Set(reflect.ValueOf(value))
+			return fmt.Errorf("incompatible data: output type: %T", out)
+		}
+	default:
+		elem := reflect.ValueOf(out).Elem()
+		switch v := reflect.ValueOf(value); {
+		case v.Type().AssignableTo(elem.Type()):
+			elem.Set(v)
+		case value == starlark.None:
+			elem.SetZero() // e.g. a nil *starlark.Dict
+		default:
+			return fmt.Errorf("incompatible data: output type: %T", out)
 		}
 	}
 	return nil
 }
 
-// codecDictReplacer replaces special "codec dictionaries" with custom starlark objects, such us Dataclass.
+// codecDictReplacer replaces special "codec dictionaries" with custom starlark objects, such us Dataclass, tuple,
+// set or the types of RegisterCodec. Dictionaries with an unknown codec, or not matching the codec layout, are
+// returned as-is.
 // See also: replaceDict
 func codecDictReplacer(dict *starlark.Dict) (starlark.Value, error) {
-	codec, found, err := dict.Get(starlark.String("__codec__"))
+	codec, found, err := dict.Get(starlark.String(codecKey))
 	if err != nil {
 		return nil, err
 	}
 	if !found {
 		return dict, nil
 	}
-	if codec == starlark.String(DataclassType) {
+	switch codec {
+	case starlark.String(DataclassType):
 		// Create a shallow copy without __codec__
 		tempDict := starlark.NewDict(dict.Len() - 1)
 		for _, item := range dict.Items() {
 			if len(item) != 2 {
 				continue
 			}
-			if keyStr, ok := item[0].(starlark.String); ok && keyStr == "__codec__" {
+			if keyStr, ok := item[0].(starlark.String); ok && keyStr == codecKey {
 				continue
 			}
 			_ = tempDict.SetKey(item[0], item[1])
 		}
 		return NewDataclassFromDict(tempDict), nil
+	case starlark.String(codecBytes):
+		data, _, _ := dict.Get(starlark.String("data"))
+		if s, ok := data.(starlark.String); ok && isTypedCodecDict(dict, "data") {
+			res, err := b64.DecodeString(string(s))
+			if err != nil {
+				return nil, err
+			}
+			return starlark.Bytes(res), nil
+		}
+	case starlark.String(codecTuple), starlark.String(codecSet), starlark.String(codecDict):
+		v, _, _ := dict.Get(starlark.String("items"))
+		items, ok := v.(*starlark.List)
+		if !ok || !isTypedCodecDict(dict, "items") {
+			return dict, nil
+		}
+		switch codec {
+		case starlark.String(codecTuple):
+			return tupleFromList(items), nil
+		case starlark.String(codecSet):
+			res := starlark.NewSet(items.Len())
+			for i := 0; i < items.Len(); i++ {
+				if err := res.Insert(items.Index(i)); err != nil {
+					return nil, err
+				}
+			}
+			return res, nil
+		default:
+			res := starlark.NewDict(items.Len())
+			for i := 0; i < items.Len(); i++ {
+				kv, ok := items.Index(i).(*starlark.List)
+				if !ok || kv.Len() != 2 {
+					return nil, fmt.Errorf("bad %s codec item: %v", codecDict, items.Index(i))
+				}
+				if err := res.SetKey(kv.Index(0), kv.Index(1)); err != nil {
+					return nil, err
+				}
+			}
+			return res, nil
+		}
+	default:
+		if name, ok := codec.(starlark.String); ok {
+			if res, ok, err := decodeCustom(string(name), dict); ok {
+				return res, err
+			}
+		}
 	}
 	return dict, nil
 }
@@ -230,8 +482,8 @@ func replaceDict(value starlark.Value, replacer func(d *starlark.Dict) (starlark
 		}
 		return value, nil
 
-	case starlark.String, starlark.Bool, starlark.Int, starlark.Float, starlark.NoneType:
-		// For the rest of JSON types, just return value as-is
+	case starlark.String, starlark.Bool, starlark.Int, starlark.Float, starlark.NoneType, starlark.Bytes:
+		// For the rest of JSON (and MessagePack) types, just return value as-is
 		return value, nil
 
 	default:
@@ -0,0 +1,89 @@
+package star
+
+import (
+	"fmt"
+	"sync"
+
+	"go.starlark.net/starlark"
+)
+
+// CodecEncodeFunc returns the serializable representation of the value: any value Encode supports, including
+// other codec types.
+type CodecEncodeFunc func(v starlark.Value) (starlark.Value, error)
+
+// CodecDecodeFunc restores the value from the decoded representation returned by the CodecEncodeFunc.
+type CodecDecodeFunc func(v starlark.Value) (starlark.Value, error)
+
+type _Codec struct {
+	encode CodecEncodeFunc
+	decode CodecDecodeFunc
+}
+
+var codecs = struct {
+	sync.RWMutex
+	byName map[string]_Codec
+}{byName: map[string]_Codec{}}
+
+// RegisterCodec makes the starlark type with the given name, see starlark.Value Type, serializable with
+// Encode, EncodeTyped and Decode. Values are encoded as codec dictionaries: {"__codec__": name, "value": encode(v)}.
+// Plugins register their codecs on init, so that workers and clients decode the same types.
+//
+// RegisterCodec panics if the name is already registered or is a built-in codec.
+func RegisterCodec(name string, encode CodecEncodeFunc, decode CodecDecodeFunc) {
+	switch name {
+	case "", codecTuple, codecSet, codecBytes, codecDict, DataclassType:
+		panic(fmt.Errorf("reserved codec name: %q", name))
+	}
+	if encode == nil || decode == nil {
+		panic(fmt.Errorf("nil codec function: %s", name))
+	}
+	codecs.Lock()
+	defer codecs.Unlock()
+	if _, found := codecs.byName[name]; found {
+		panic(fmt.Errorf("codec is already registered: %s", name))
+	}
+	codecs.byName[name] = _Codec{encode: encode, decode: decode}
+}
+
+func getCodec(name string) (_Codec, bool) {
+	codecs.RLock()
+	defer codecs.RUnlock()
+	c, found := codecs.byName[name]
+	return c, found
+}
+
+// codecCustom returns the codec dictionary of a value of a registered type.
+func codecCustom(v starlark.Value, typed bool) (starlark.Value, bool, error) {
+	c, found := getCodec(v.Type())
+	if !found {
+		return nil, false, nil
+	}
+	r, err := c.encode(v)
+	if err != nil {
+		return nil, true, fmt.Errorf("%s codec: %w", v.Type(), err)
+	}
+	if r, err = codecValue(r, typed); err != nil {
+		return nil, true, err
+	}
+	res := starlark.NewDict(2)
+	SetStringKey(res, codecKey, starlark.String(v.Type()))
+	SetStringKey(res, "value", r)
+	return res, true, nil
+}
+
+// decodeCustom restores the value of a registered type from its codec dictionary.
+func decodeCustom(name string, dict *starlark.Dict) (starlark.Value, bool, error) {
+	c, found := getCodec(name)
+	if !found || dict.Len() != 2 {
+		return nil, false, nil
+	}
+	v, found, _ := dict.Get(starlark.String("value"))
+	if !found {
+		return nil, false, nil
+	}
+	res, err := c.decode(v)
+	if err != nil {
+		return nil, true, fmt.Errorf("%s codec: %w", name, err)
+	}
+	return res, true, nil
+}
@@ -0,0 +1,76 @@
+package star
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.starlark.net/starlark"
+)
+
+type _TestPoint struct{ x, y int }
+
+func (r *_TestPoint) String() string        { return fmt.Sprintf("point(%d, %d)", r.x, r.y) }
+func (r *_TestPoint) Type() string          { return "test_point" }
+func (r *_TestPoint) Freeze()               {}
+func (r *_TestPoint) Truth() starlark.Bool  { return true }
+func (r *_TestPoint) Hash() (uint32, error) { return 0, fmt.Errorf("unhashable") }
+
+func TestRegisterCodec(t *testing.T) {
+	RegisterCodec("test_point", func(v starlark.Value) (starlark.Value, error) {
+		p := v.(*_TestPoint)
+		return starlark.Tuple{starlark.MakeInt(p.x), starlark.MakeInt(p.y)}, nil
+	}, func(v starlark.Value) (starlark.Value, error) {
+		var p _TestPoint
+		seq := v.(starlark.Indexable) // a tuple, or a list if encoded by Encode
+		args := make(starlark.Tuple, seq.Len())
+		for i := range args {
+			args[i] = seq.Index(i)
+		}
+		if err := starlark.UnpackPositionalArgs("test_point", args, nil, 2, &p.x, &p.y); err != nil {
+			return nil, err
+		}
+		return &p, nil
+	})
+
+	t.Run("round-trip", func(t *testing.T) {
+		input := starlark.NewDict(1)
+		SetStringKey(input, "p", &_TestPoint{x: 1, y: 2})
+		for _, tc := range []struct {
+			encode func(v any) ([]byte, error)
+			json   string
+		}{
+			{Encode, `{"p":{"__codec__":"test_point","value":[1,2]}}`},
+			{EncodeTyped, `{"p":{"__codec__":"test_point","value":{"__codec__":"tuple","__codec_version__":1,"items":[1,2]}}}`},
+		} {
+			res, err := tc.encode(input)
+			require.NoError(t, err)
+			require.Equal(t, tc.json, string(res))
+
+			var out *starlark.Dict
+			require.NoError(t, Decode(res, &out))
+			p, _, _ := out.Get(starlark.String("p"))
+			require.Equal(t, &_TestPoint{x: 1, y: 2}, p)
+		}
+	})
+
+	t.Run("decode-error", func(t *testing.T) {
+		var out starlark.Value
+		err := Decode([]byte(`{"__codec__":"test_point","value":{"__codec__":"tuple","__codec_version__":1,"items":[1]}}`), &out)
+		require.ErrorContains(t, err, "test_point codec")
+	})
+
+	t.Run("unregistered", func(t *testing.T) {
+		// codec dictionaries of unknown types are decoded as-is
+		var out starlark.Value
+		require.NoError(t, Decode([]byte(`{"__codec__":"other","value":1}`), &out))
+		require.Equal(t, `{"__codec__": "other", "value": 1}`, out.String())
+	})
+
+	t.Run("reserved", func(t *testing.T) {
+		noop := func(v starlark.Value) (starlark.Value, error) { return v, nil }
+		require.Panics(t, func() { RegisterCodec("test_point", noop, noop) })
+		require.Panics(t, func() { RegisterCodec(DataclassType, noop, noop) })
+		require.Panics(t, func() { RegisterCodec("tuple", noop, noop) })
+	})
+}
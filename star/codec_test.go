@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/stretchr/testify/require"
 	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
 	"testing"
 )
 
@@ -280,3 +281,117 @@ func TestDecode(t *testing.T) {
 		require.Equal(t, starlark.String("dataclass"), codecVal)
 	})
 }
+
+func TestCodecRoundTrip(t *testing.T) {
+	eval := func(t *testing.T, expr string) starlark.Value {
+		v, err := starlark.EvalOptions(&syntax.FileOptions{Set: true}, &starlark.Thread{}, "test", expr, starlark.StringDict{
+			"dataclass": DataclassConstructor,
+		})
+		require.NoError(t, err)
+		return v
+	}
+
+	for _, tc := range []struct {
+		name string
+		expr string
+		json string
+	}{
+		{"tuple", `[(1, "a")]`, `[{"__codec__":"tuple","__codec_version__":1,"items":[1,"a"]}]`},
+		{"set", `{"s": set([3, 1])}`, `{"s":{"__codec__":"set","__codec_version__":1,"items":[3,1]}}`},
+		{"bytes", `[b"abc"]`, `[{"__codec__":"bytes","__codec_version__":1,"data":"YWJj"}]`},
+		{"int-keys", `{1: "a", 2: "b"}`, `{"__codec__":"dict","__codec_version__":1,"items":[[1,"a"],[2,"b"]]}`},
+		{"tuple-keys", `{(1, 2): "a"}`, `{"__codec__":"dict","__codec_version__":1,"items":[[{"__codec__":"tuple","__codec_version__":1,"items":[1,2]},"a"]]}`},
+		{"codec-key", `{"__codec__": "tuple", "items": []}`, `{"__codec__":"dict","__codec_version__":1,"items":[["__codec__","tuple"],["items",[]]]}`},
+		{"dataclass", `dataclass(t=(1,), b=b"x")`, `{"__codec__":"dataclass","b":{"__codec__":"bytes","__codec_version__":1,"data":"eA=="},"t":{"__codec__":"tuple","__codec_version__":1,"items":[1]}}`},
+		{"top-level-tuple", `(1, (2,))`, `[1,{"__codec__":"tuple","__codec_version__":1,"items":[2]}]`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			input := eval(t, tc.expr)
+			res, err := EncodeTyped(input)
+			require.NoError(t, err)
+			require.Equal(t, tc.json, string(res))
+
+			var out starlark.Value
+			require.NoError(t, Decode(res, &out))
+			if _, ok := input.(starlark.Tuple); ok {
+				// top-level tuples are lists, the positional arguments format
+				var tuple starlark.Tuple
+				require.NoError(t, Decode(res, &tuple))
+				out = tuple
+			}
+			eq, err := starlark.Equal(input, out)
+			require.NoError(t, err)
+			require.True(t, eq, "%s != %s", input, out)
+		})
+	}
+
+	t.Run("backward-compatible", func(t *testing.T) {
+		// plain JSON and unknown or malformed codec dictionaries are decoded as-is
+		var out starlark.Value
+		require.NoError(t, Decode([]byte(`[[1,2],{"__codec__":"tuple"},{"__codec__":"other","items":[]}]`), &out))
+		require.Equal(t, `[[1, 2], {"__codec__": "tuple"}, {"__codec__": "other", "items": []}]`, out.String())
+	})
+
+	t.Run("old-format", func(t *testing.T) {
+		// user dictionaries of histories written before the typed format are not converted
+		var out starlark.Value
+		require.NoError(t, Decode([]byte(`[{"__codec__":"tuple","items":[1]},{"__codec__":"bytes","data":"YWJj"},{"__codec__":"dict","items":[["a",1]]}]`), &out))
+		require.Equal(t, `[{"__codec__": "tuple", "items": [1]}, {"__codec__": "bytes", "data": "YWJj"}, {"__codec__": "dict", "items": [["a", 1]]}]`, out.String())
+	})
+
+	t.Run("key-collision", func(t *testing.T) {
+		// plain JSON keys are strings: 1 and "1" would collide
+		_, err := Encode(eval(t, `{1: "a", "1": "b"}`))
+		require.ErrorContains(t, err, "dict key collision")
+		_, ok := err.(UnsupportedTypeError)
+		require.False(t, ok, "collisions must not fall back to another encoder")
+
+		res, err := EncodeTyped(eval(t, `{1: "a", "1": "b"}`))
+		require.NoError(t, err)
+		require.Equal(t, `{"__codec__":"dict","__codec_version__":1,"items":[[1,"a"],["1","b"]]}`, string(res))
+	})
+
+	t.Run("big-int", func(t *testing.T) {
+		// integers of any size are encoded and decoded exactly
+		for _, n := range []string{
+			"9007199254740993",                        // 2^53 + 1, not a float64
+			"-9223372036854775808",                    // min int64
+			"18446744073709551615",                    // max uint64
+			"340282366920938463463374607431768211457", // 2^128 + 1
+		} {
+			input := eval(t, n)
+			res, err := Encode(input)
+			require.NoError(t, err)
+			require.Equal(t, n, string(res))
+
+			var out starlark.Value
+			require.NoError(t, Decode([]byte(`{"id":`+n+`}`), &out))
+			id, _, _ := out.(*starlark.Dict).Get(starlark.String("id"))
+			require.Equal(t, n, id.String())
+		}
+	})
+
+	t.Run("plain", func(t *testing.T) {
+		// Encode writes the plain JSON Go code decodes: no codec dictionaries but the dataclass ones
+		for expr, expected := range map[string]string{
+			`[(1, "a")]`:                 `[[1,"a"]]`,
+			`{"s": set([3, 1])}`:         `{"s":[3,1]}`,
+			`[b"abc"]`:                   `["YWJj"]`,
+			`(1, (2,))`:                  `[1,[2]]`,
+			`dataclass(t=(1,), b=b"x")`:  `{"__codec__":"dataclass","b":"eA==","t":[1]}`,
+			`{"__codec__": "x", "a": 1}`: `{"__codec__":"x","a":1}`,
+			`{1: "a", (2, 3): "b"}`:      `{"(2, 3)":"b","1":"a"}`,
+		} {
+			res, err := Encode(eval(t, expr))
+			require.NoError(t, err)
+			require.Equal(t, expected, string(res), expr)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		// the standard JSON encoding has no codec dictionaries
+		res, err := EncodeJSON(eval(t, `{"t": (1, 2)}`))
+		require.NoError(t, err)
+		require.Equal(t, `{"t":[1,2]}`, string(res))
+	})
+}
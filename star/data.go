@@ -0,0 +1,173 @@
+package star
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"go.starlark.net/starlark"
+	"gopkg.in/yaml.v3"
+)
+
+// decodeYAML decodes a YAML document into Starlark values, keeping the mapping key order.
+func decodeYAML(data []byte) (starlark.Value, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Kind == 0 { // empty document
+		return starlark.None, nil
+	}
+	return yamlToStarlark(&doc)
+}
+
+func yamlToStarlark(n *yaml.Node) (starlark.Value, error) {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		return yamlToStarlark(n.Content[0])
+	case yaml.AliasNode:
+		return yamlToStarlark(n.Alias)
+	case yaml.SequenceNode:
+		res := make([]starlark.Value, len(n.Content))
+		for i, c := range n.Content {
+			v, err := yamlToStarlark(c)
+			if err != nil {
+				return nil, err
+			}
+			res[i] = v
+		}
+		return starlark.NewList(res), nil
+	case yaml.MappingNode:
+		res := starlark.NewDict(len(n.Content) / 2)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, err := yamlToStarlark(n.Content[i])
+			if err != nil {
+				return nil, err
+			}
+			v, err := yamlToStarlark(n.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			if err := res.SetKey(k, v); err != nil {
+				return nil, fmt.Errorf("line %d: %w", n.Content[i].Line, err)
+			}
+		}
+		return res, nil
+	default:
+		// keep big ints exact: plain integers out of the int64 range are resolved as floats
+		if tag := n.ShortTag(); tag == "!!int" || (tag == "!!float" && n.Style&yaml.TaggedStyle == 0) {
+			if i, ok := new(big.Int).SetString(n.Value, 0); ok {
+				return starlark.MakeBigInt(i), nil
+			}
+		}
+		var v any
+		if err := n.Decode(&v); err != nil {
+			return nil, err
+		}
+		return goToStarlark(v)
+	}
+}
+
+// decodeTOML decodes a TOML document into a Starlark dict. Table keys are sorted.
+func decodeTOML(data []byte) (starlark.Value, error) {
+	var v map[string]any
+	if err := toml.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return goToStarlark(v)
+}
+
+// decodeCSV decodes a CSV document into a list of dicts keyed by the header row.
+func decodeCSV(data []byte) (starlark.Value, error) {
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return starlark.NewList(nil), nil
+	}
+	header := records[0]
+	rows := make([]starlark.Value, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := starlark.NewDict(len(header))
+		for i, name := range header {
+			_ = row.SetKey(starlark.String(name), starlark.String(record[i])) // string keys: never fails
+		}
+		rows = append(rows, row)
+	}
+	return starlark.NewList(rows), nil
+}
+
+// goToStarlark converts decoded Go values (scalars, slices and maps) into Starlark values.
+// Map keys are sorted to keep the result deterministic. Times are formatted as RFC 3339 strings.
+func goToStarlark(v any) (starlark.Value, error) {
+	switch v := v.(type) {
+	case nil:
+		return starlark.None, nil
+	case bool:
+		return starlark.Bool(v), nil
+	case string:
+		return starlark.String(v), nil
+	case int:
+		return starlark.MakeInt(v), nil
+	case int64:
+		return starlark.MakeInt64(v), nil
+	case uint64:
+		return starlark.MakeUint64(v), nil
+	case *big.Int:
+		return starlark.MakeBigInt(v), nil
+	case float64:
+		return starlark.Float(v), nil
+	case []byte:
+		return starlark.Bytes(v), nil
+	case time.Time:
+		return starlark.String(v.Format(time.RFC3339Nano)), nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		res := make([]starlark.Value, rv.Len())
+		for i := range res {
+			el, err := goToStarlark(rv.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			res[i] = el
+		}
+		return starlark.NewList(res), nil
+	case reflect.Map:
+		type entry struct {
+			k starlark.Value
+			v reflect.Value
+		}
+		entries := make([]entry, 0, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			k, err := goToStarlark(iter.Key().Interface())
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry{k: k, v: iter.Value()})
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].k.String() < entries[j].k.String() })
+		res := starlark.NewDict(len(entries))
+		for _, e := range entries {
+			v, err := goToStarlark(e.v.Interface())
+			if err != nil {
+				return nil, err
+			}
+			if err := res.SetKey(e.k, v); err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+	default:
+		return nil, fmt.Errorf("unsupported data value: %T", v)
+	}
+}
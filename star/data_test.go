@@ -0,0 +1,51 @@
+package star
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.starlark.net/starlark"
+)
+
+func TestLoadDataFile(t *testing.T) {
+	for _, tc := range []struct {
+		path     string
+		data     string
+		name     string
+		expected string
+	}{
+		{"/a.txt", "foo", "txt", `"foo"`},
+		{"/a.json", `{"b": 1, "a": [true, null]}`, "json", `{"b": 1, "a": [True, None]}`},
+		{
+			"/a.yaml",
+			"b: 1\na:\n  - x\n  - 2.5\n  - &n {k: v}\n  - *n\n10: ten\nbig: 123456789012345678901234567890\n",
+			"yaml",
+			`{"b": 1, "a": ["x", 2.5, {"k": "v"}, {"k": "v"}], 10: "ten", "big": 123456789012345678901234567890}`,
+		},
+		{"/a.yml", "", "yaml", `None`},
+		{
+			"/a.toml",
+			"b = 1\na = \"x\"\n[t]\nlist = [1, 2]\nd = 2024-01-02\n[[rows]]\nk = \"v\"\n",
+			"toml",
+			`{"a": "x", "b": 1, "rows": [{"k": "v"}], "t": {"d": "2024-01-02T00:00:00Z", "list": [1, 2]}}`,
+		},
+		{"/a.csv", "id,alias\n100,foo\n101,bar\n", "csv", `[{"id": "100", "alias": "foo"}, {"id": "101", "alias": "bar"}]`},
+		{"/a.csv", "", "csv", `[]`},
+		{"/a.bin", "\x00\x01", "bytes", `b"\x00\x01"`},
+	} {
+		res, err := loadDataFile(tc.path, []byte(tc.data))
+		require.NoError(t, err, tc.path)
+		require.Equal(t, starlark.Bytes(tc.data), res["bytes"], tc.path)
+		require.NotNil(t, res[tc.name], tc.path)
+		require.Equal(t, tc.expected, res[tc.name].String(), tc.path)
+	}
+
+	for _, tc := range []struct{ path, data string }{
+		{"/a.yaml", "a: [1"},
+		{"/a.toml", "a = "},
+		{"/a.csv", "a,b\n1\n"},
+	} {
+		_, err := loadDataFile(tc.path, []byte(tc.data))
+		require.ErrorContains(t, err, tc.path)
+	}
+}
@@ -72,9 +72,7 @@ func (r *_Dataclass) SetField(name string, val starlark.Value) error {
 }
 
 func (r *_Dataclass) MarshalJSON() ([]byte, error) {
-	dict := StringDictToDict(r.attrs)
-	SetStringKey(dict, "__codec__", starlark.String(DataclassType))
-	return Encode(dict)
+	return Encode(r) // see codecValue
 }
 
 func MakeDataclass(_ *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
@@ -8,22 +8,36 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
+	"strings"
 )
 
 var ErrNotExist = errors.New("file does not exist")
 
 type FS interface {
 	Read(path string) ([]byte, error)
+	// List returns the sorted names of the directory entries. Names of subdirectories end with "/".
+	List(dir string) ([]string, error)
 }
 
 type _TarFS struct {
 	files map[string][]byte
+	size  int64
 }
 
 var _ FS = (*_TarFS)(nil)
 
 func NewTarFS(tar []byte) (FS, error) {
+	fs, err := newTarFS(tar)
+	if err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+func newTarFS(tar []byte) (*_TarFS, error) {
 	files := map[string][]byte{}
+	var size int64
 	br := bytes.NewReader(tar)
 	if err := ext.ReadTar(br, func(p string, content []byte) error {
 		p = path.Clean("/" + p)          // sanitize path: make it absolute and clean
@@ -31,11 +45,12 @@ func NewTarFS(tar []byte) (FS, error) {
 			return fmt.Errorf("400: tar file collision: %s", p)
 		}
 		files[p] = content
+		size += int64(len(content))
 		return nil
 	}); err != nil {
 		return nil, err
 	}
-	return &_TarFS{files: files}, nil
+	return &_TarFS{files: files, size: size}, nil
 }
 
 func (r *_TarFS) Read(p string) ([]byte, error) {
@@ -50,13 +65,172 @@ func (r *_TarFS) Read(p string) ([]byte, error) {
 	}
 }
 
+func (r *_TarFS) List(dir string) ([]string, error) {
+	dir = path.Clean("/" + dir)
+	prefix := dir + "/"
+	if dir == "/" {
+		prefix = dir
+	}
+	entries := map[string]bool{}
+	for p := range r.files {
+		if !strings.HasPrefix(p, prefix) {
+			continue
+		}
+		name := p[len(prefix):]
+		if i := strings.IndexByte(name, '/'); i >= 0 {
+			name = name[:i+1] // subdirectory
+		}
+		entries[name] = true
+	}
+	if len(entries) == 0 && dir != "/" {
+		if _, found := r.files[dir]; found {
+			return nil, fmt.Errorf("400: not a directory: %s", dir)
+		}
+		return nil, fmt.Errorf("404: directory not found: %s, %w", dir, ErrNotExist)
+	}
+	res := make([]string, 0, len(entries))
+	for name := range entries {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
 type LocalFS struct {
 	Root string
 }
 
 var _ FS = &LocalFS{}
 
-func (r *LocalFS) Read(path string) ([]byte, error) {
-	path = filepath.Join(r.Root, path)
-	return os.ReadFile(path)
+func (r *LocalFS) Read(p string) ([]byte, error) {
+	// paths are relative to the root: reject those that escape it, e.g. "../x"
+	if rel := path.Clean(strings.TrimLeft(filepath.ToSlash(p), "/")); rel == ".." || strings.HasPrefix(rel, "../") {
+		return nil, fmt.Errorf("400: out-of-root path: %s", p)
+	}
+	return os.ReadFile(filepath.Join(r.Root, filepath.FromSlash(path.Clean("/"+p))))
+}
+
+func (r *LocalFS) List(dir string) ([]string, error) {
+	dir = path.Clean("/" + dir)
+	entries, err := os.ReadDir(filepath.Join(r.Root, filepath.FromSlash(dir)))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("404: directory not found: %s, %w", dir, ErrNotExist)
+		}
+		return nil, err
+	}
+	res := make([]string, len(entries))
+	for i, e := range entries {
+		res[i] = e.Name()
+		if e.IsDir() {
+			res[i] += "/"
+		}
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+// RepoFS is the file system of a package and its external repositories: paths "@alias//path" are served by
+// the repository file system of the alias, see SplitRepo.
+type RepoFS struct {
+	FS
+	Repos map[string]FS
+}
+
+var _ FS = (*RepoFS)(nil)
+
+func (r *RepoFS) Read(p string) ([]byte, error) {
+	fs, p, err := r.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	return fs.Read(p)
+}
+
+func (r *RepoFS) List(dir string) ([]string, error) {
+	fs, dir, err := r.resolve(dir)
+	if err != nil {
+		return nil, err
+	}
+	return fs.List(dir)
+}
+
+func (r *RepoFS) resolve(p string) (FS, string, error) {
+	alias, repoPath, ok := SplitRepo(p)
+	if !ok {
+		return r.FS, p, nil
+	}
+	if fs, found := r.Repos[alias]; found {
+		return fs, repoPath, nil
+	}
+	return nil, "", fmt.Errorf("404: repository not found: %s (not pinned in %s), %w", alias, MetaFile, ErrNotExist)
+}
+
+// Exists reports whether the file or directory exists.
+func Exists(fs FS, p string) (bool, error) {
+	if _, err := fs.List(p); err == nil {
+		return true, nil // directory
+	}
+	if _, err := fs.Read(p); err != nil {
+		if errors.Is(err, ErrNotExist) || errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Glob returns the sorted absolute paths of the files matching the pattern. The pattern syntax is the one of
+// path.Match, extended with "**" matching any number of directories, e.g. "/fixtures/**/*.json".
+func Glob(fs FS, pattern string) ([]string, error) {
+	pattern = path.Clean("/" + pattern)
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	ps := strings.Split(pattern, "/")
+	var res []string
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		entries, err := fs.List(dir)
+		if err != nil {
+			return err
+		}
+		for _, name := range entries {
+			p := path.Join(dir, name)
+			if strings.HasSuffix(name, "/") {
+				if err := walk(p); err != nil {
+					return err
+				}
+			} else if matchGlob(ps, strings.Split(p, "/")) {
+				res = append(res, p)
+			}
+		}
+		return nil
+	}
+	if err := walk("/"); err != nil {
+		return nil, err
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+func matchGlob(pattern []string, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchGlob(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], name[0]); !ok {
+		return false
+	}
+	return matchGlob(pattern[1:], name[1:])
 }
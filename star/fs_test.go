@@ -5,6 +5,8 @@ import (
 	"errors"
 	"github.com/cadence-workflow/starlark-worker/ext"
 	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -31,3 +33,73 @@ func TestTarFS(t *testing.T) {
 	require.Error(t, err)
 	require.True(t, errors.Is(err, ErrNotExist))
 }
+
+func TestLocalFSRead(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "lib"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "lib", "a.txt"), []byte("a"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret"), 0o644))
+	fs := &LocalFS{Root: root}
+
+	for _, p := range []string{"/lib/a.txt", "lib/a.txt", "/lib/../lib/a.txt"} {
+		data, err := fs.Read(p)
+		require.NoError(t, err, p)
+		require.Equal(t, []byte("a"), data, p)
+	}
+	for _, p := range []string{"../secret.txt", "/../secret.txt", "lib/../../secret.txt", ".."} {
+		data, err := fs.Read(p)
+		require.ErrorContains(t, err, "out-of-root path", p)
+		require.Nil(t, data, p)
+	}
+}
+
+func TestFSList(t *testing.T) {
+	files := map[string][]byte{
+		"/a.txt":             []byte("a"),
+		"/dir/b.json":        []byte("b"),
+		"/dir/sub/c.json":    []byte("c"),
+		"/dir/sub/deep/d.md": []byte("d"),
+	}
+	bb := bytes.Buffer{}
+	require.NoError(t, ext.WriteTar(files, &bb))
+	tarFS, err := NewTarFS(bb.Bytes())
+	require.NoError(t, err)
+
+	root := t.TempDir()
+	for p, content := range files {
+		p = filepath.Join(root, filepath.FromSlash(p))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		require.NoError(t, os.WriteFile(p, content, 0o644))
+	}
+
+	for name, fs := range map[string]FS{"tar": tarFS, "local": &LocalFS{Root: root}} {
+		names, err := fs.List("/")
+		require.NoError(t, err, name)
+		require.Equal(t, []string{"a.txt", "dir/"}, names, name)
+
+		names, err = fs.List("dir")
+		require.NoError(t, err, name)
+		require.Equal(t, []string{"b.json", "sub/"}, names, name)
+
+		_, err = fs.List("/nonexistent")
+		require.ErrorIs(t, err, ErrNotExist, name)
+
+		for p, expected := range map[string]bool{"/a.txt": true, "/dir/sub": true, "/dir/x.txt": false} {
+			found, err := Exists(fs, p)
+			require.NoError(t, err, name)
+			require.Equal(t, expected, found, "%s: %s", name, p)
+		}
+
+		paths, err := Glob(fs, "/dir/**/*.json")
+		require.NoError(t, err, name)
+		require.Equal(t, []string{"/dir/b.json", "/dir/sub/c.json"}, paths, name)
+
+		paths, err = Glob(fs, "/*/sub/*")
+		require.NoError(t, err, name)
+		require.Equal(t, []string{"/dir/sub/c.json"}, paths, name)
+
+		_, err = Glob(fs, "/[")
+		require.Error(t, err, name)
+	}
+}
@@ -0,0 +1,106 @@
+package star
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+const (
+	// MetaFile is the package metadata file, see Manifest for its "package" section.
+	MetaFile = "meta.json"
+	// IgnoreFile lists the exclude patterns of the package, one per line.
+	IgnoreFile = ".starignore"
+)
+
+// Manifest is the "package" section of the meta.json file in the package root directory: the files to pack in
+// addition to the ones reachable via load() from the entry file.
+//
+// Patterns use the Glob syntax relative to the package root. Exclude patterns, also read from .starignore, follow
+// the .gitignore conventions: a pattern without "/" matches at any depth, a pattern ending with "/" matches
+// a whole directory, and lines starting with "#" are comments.
+type Manifest struct {
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+
+	// Repositories are the external repository pins of meta.json: files loaded as "@alias//path" are not packed,
+	// they are resolved on the worker.
+	Repositories map[string]string `json:"-"`
+}
+
+// ReadManifest reads the package manifest of the given root directory. The manifest is empty if neither meta.json
+// nor .starignore exist.
+func ReadManifest(root string) (Manifest, error) {
+	var meta struct {
+		Package      Manifest          `json:"package"`
+		Repositories map[string]string `json:"repositories"`
+	}
+	if b, err := os.ReadFile(filepath.Join(root, MetaFile)); err == nil {
+		if err := jsoniter.Unmarshal(b, &meta); err != nil {
+			return Manifest{}, err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return Manifest{}, err
+	}
+	res := meta.Package
+	res.Repositories = meta.Repositories
+	if b, err := os.ReadFile(filepath.Join(root, IgnoreFile)); err == nil {
+		s := bufio.NewScanner(bytes.NewReader(b))
+		for s.Scan() {
+			if line := strings.TrimSpace(s.Text()); line != "" && !strings.HasPrefix(line, "#") {
+				res.Exclude = append(res.Exclude, line)
+			}
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return Manifest{}, err
+	}
+	return res, nil
+}
+
+// Files returns the absolute package paths of the included files that are not excluded.
+func (r Manifest) Files(fs FS) ([]string, error) {
+	seen := map[string]bool{}
+	var res []string
+	for _, pattern := range r.Include {
+		paths, err := Glob(fs, pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range paths {
+			if !seen[p] && !r.Excluded(p) {
+				seen[p] = true
+				res = append(res, p)
+			}
+		}
+	}
+	return res, nil
+}
+
+// Excluded reports whether the given package path matches an exclude pattern.
+func (r Manifest) Excluded(p string) bool {
+	name := strings.Split(path.Clean("/"+p), "/")
+	for _, pattern := range r.Exclude {
+		if matchGlob(excludePattern(pattern), name) {
+			return true
+		}
+	}
+	return false
+}
+
+func excludePattern(pattern string) []string {
+	dir := strings.HasSuffix(pattern, "/")
+	pattern = strings.TrimSuffix(pattern, "/")
+	if !strings.Contains(pattern, "/") {
+		pattern = "**/" + pattern // match at any depth
+	}
+	if dir {
+		pattern += "/**"
+	}
+	return strings.Split(path.Clean("/"+pattern), "/")
+}
@@ -0,0 +1,47 @@
+package star
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifest(t *testing.T) {
+	root := t.TempDir()
+	for p, content := range map[string]string{
+		"meta.json":              `{"package": {"include": ["templates/**", "fixtures/*.json", "secrets/*"], "exclude": ["*.bak"]}}`,
+		".starignore":            "# comment\n\nsecrets/\n/fixtures/large.json\n",
+		"templates/a.tmpl":       "a",
+		"templates/x/b.tmpl":     "b",
+		"templates/x/b.tmpl.bak": "b",
+		"fixtures/small.json":    "{}",
+		"fixtures/large.json":    "{}",
+		"secrets/key":            "key",
+	} {
+		p = filepath.Join(root, p)
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0o644))
+	}
+
+	m, err := ReadManifest(root)
+	require.NoError(t, err)
+	require.Equal(t, Manifest{
+		Include: []string{"templates/**", "fixtures/*.json", "secrets/*"},
+		Exclude: []string{"*.bak", "secrets/", "/fixtures/large.json"},
+	}, m)
+
+	files, err := m.Files(&LocalFS{Root: root})
+	require.NoError(t, err)
+	require.Equal(t, []string{"/templates/a.tmpl", "/templates/x/b.tmpl", "/fixtures/small.json"}, files)
+
+	require.True(t, m.Excluded("a/b/c.bak"))
+	require.True(t, m.Excluded("/secrets/x/y"))
+	require.False(t, m.Excluded("/a/fixtures/large.json"))
+
+	// no manifest
+	m, err = ReadManifest(t.TempDir())
+	require.NoError(t, err)
+	require.Equal(t, Manifest{}, m)
+}
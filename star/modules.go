@@ -0,0 +1,131 @@
+package star
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"go.starlark.net/starlark"
+)
+
+const loadStackKey = "star.load_stack"
+
+// ModuleCache memoizes the modules loaded by a group of threads, e.g. all the threads of a run: each module is
+// executed once and shared by every thread that loads it; the globals of the modules reached via load() are
+// frozen. Load cycles, within a thread or across the threads waiting for each other's modules, are reported
+// with the load chain.
+type ModuleCache struct {
+	mu      sync.Mutex
+	load    func(*starlark.Thread, string) (starlark.StringDict, error)
+	modules map[string]*_Module
+	waiting map[*starlark.Thread]*_Module
+
+	// NewLatch makes threads wait for a module being loaded by another thread. By default, a Go channel is used;
+	// workflows must provide a latch based on workflow futures instead.
+	NewLatch func(t *starlark.Thread) (wait func(t *starlark.Thread), release func())
+}
+
+type _Module struct {
+	path    string
+	owner   *starlark.Thread // the thread loading the module
+	globals starlark.StringDict
+	err     error
+	done    bool
+	wait    func(t *starlark.Thread)
+}
+
+// NewModuleCache returns a cache of the modules loaded with the given load function, see ThreadLoad.
+func NewModuleCache(load func(*starlark.Thread, string) (starlark.StringDict, error)) *ModuleCache {
+	return &ModuleCache{load: load, modules: map[string]*_Module{}, waiting: map[*starlark.Thread]*_Module{}}
+}
+
+// Load is the starlark.Thread Load function.
+func (r *ModuleCache) Load(t *starlark.Thread, module string) (starlark.StringDict, error) {
+	if IsPlugin(module) {
+		return r.load(t, module)
+	}
+	from := "/"
+	if t.CallStackDepth() > 0 {
+		from = t.CallFrame(0).Pos.Filename()
+	}
+	p, err := ResolveLoad(from, module)
+	if err != nil {
+		return nil, err
+	}
+
+	stack, _ := t.Local(loadStackKey).([]string)
+	for i, s := range stack {
+		if s == p {
+			chain := append(append([]string{}, stack[i:]...), p)
+			return nil, fmt.Errorf("load cycle: %s", strings.Join(chain, " -> "))
+		}
+	}
+
+	loaded := t.CallStackDepth() > 0 // reached via load() rather than the entry module of a call
+	r.mu.Lock()
+	m, found := r.modules[p]
+	if found {
+		if !m.done {
+			if err := r.checkWait(t, m); err != nil {
+				r.mu.Unlock()
+				return nil, err
+			}
+			r.waiting[t] = m
+			r.mu.Unlock()
+			m.wait(t)
+			r.mu.Lock()
+			delete(r.waiting, t)
+		}
+		if loaded && m.globals != nil {
+			m.globals.Freeze()
+		}
+		r.mu.Unlock()
+		return m.globals, m.err
+	}
+	m = &_Module{path: p, owner: t}
+	var release func()
+	m.wait, release = r.newLatch(t)
+	r.modules[p] = m
+	r.mu.Unlock()
+
+	t.SetLocal(loadStackKey, append(stack, p))
+	defer t.SetLocal(loadStackKey, stack)
+
+	globals, err := r.load(t, p)
+	r.mu.Lock()
+	m.globals, m.err = globals, err
+	if loaded && m.globals != nil {
+		m.globals.Freeze()
+	}
+	m.done = true
+	m.owner = nil
+	r.mu.Unlock()
+	release()
+	return m.globals, m.err
+}
+
+// checkWait returns a load cycle error if the modules being loaded by the thread are awaited, directly or
+// through other threads, by the loader of the given module: waiting for it would never return.
+func (r *ModuleCache) checkWait(t *starlark.Thread, m *_Module) error {
+	chain := []string{m.path}
+	for w := m; w.owner != nil; {
+		next, found := r.waiting[w.owner]
+		if !found {
+			return nil
+		}
+		chain = append(chain, next.path)
+		if next.owner == t {
+			return fmt.Errorf("load cycle: %s -> %s", next.path, strings.Join(chain, " -> "))
+		}
+		w = next
+	}
+	return nil
+}
+
+func (r *ModuleCache) newLatch(t *starlark.Thread) (func(t *starlark.Thread), func()) {
+	if r.NewLatch != nil {
+		return r.NewLatch(t)
+	}
+	ch := make(chan struct{})
+	return func(*starlark.Thread) { <-ch }, func() { close(ch) }
+}
@@ -0,0 +1,112 @@
+package star
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/cadence-workflow/starlark-worker/ext"
+	"github.com/stretchr/testify/require"
+	"go.starlark.net/starlark"
+)
+
+func TestModuleCache(t *testing.T) {
+	files := map[string][]byte{
+		"/a.star":     []byte("load(\"./lib.star\", \"items\")\na = items\n"),
+		"/b.star":     []byte("load(\"//lib.star\", \"items\")\nb = items\n"),
+		"/lib.star":   []byte("count()\nitems = [1, 2]\n"),
+		"/mut.star":   []byte("load(\"./lib.star\", \"items\")\nitems.append(3)\n"),
+		"/cycle.star": []byte("load(\"./x/c1.star\", \"c\")\n"),
+		"/entry.star": []byte("items = [1]\n"),
+		"/x/c1.star":  []byte("load(\"./c2.star\", \"c\")\n"),
+		"/x/c2.star":  []byte("load(\"./c1.star\", \"c\")\n"),
+	}
+	bb := bytes.Buffer{}
+	require.NoError(t, ext.WriteTar(files, &bb))
+	fs, err := NewTarFS(bb.Bytes())
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var executions int
+	predeclared := starlark.StringDict{
+		"count": starlark.NewBuiltin("count", func(*starlark.Thread, *starlark.Builtin, starlark.Tuple, []starlark.Tuple) (starlark.Value, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			executions++
+			return starlark.None, nil
+		}),
+	}
+	cache := NewModuleCache(ThreadLoad(fs, predeclared, nil))
+
+	// threads loading concurrently share the module, executed once
+	var wg sync.WaitGroup
+	results := make([]starlark.StringDict, 8)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			thread := &starlark.Thread{Load: cache.Load}
+			path := "/a.star"
+			if i%2 == 1 {
+				path = "/b.star"
+			}
+			g, err := thread.Load(thread, path)
+			require.NoError(t, err)
+			results[i] = g
+		}(i)
+	}
+	wg.Wait()
+	require.Equal(t, 1, executions)
+	require.Same(t, results[0]["a"], results[1]["b"])
+
+	// loaded globals are frozen
+	thread := &starlark.Thread{Load: cache.Load}
+	_, err = thread.Load(thread, "/mut.star")
+	require.ErrorContains(t, err, "frozen")
+
+	_, err = thread.Load(thread, "/cycle.star")
+	require.ErrorContains(t, err, "load cycle: /x/c1.star -> /x/c2.star -> /x/c1.star")
+
+	// the entry module is not frozen
+	g, err := thread.Load(thread, "/entry.star")
+	require.NoError(t, err)
+	require.NoError(t, g["items"].(*starlark.List).Append(starlark.MakeInt(3)))
+}
+
+func TestModuleCacheThreadCycle(t *testing.T) {
+	files := map[string][]byte{
+		"/p.star": []byte("barrier()\nload(\"./q.star\", \"q\")\np = 1\n"),
+		"/q.star": []byte("barrier()\nload(\"./p.star\", \"p\")\nq = 1\n"),
+	}
+	bb := bytes.Buffer{}
+	require.NoError(t, ext.WriteTar(files, &bb))
+	fs, err := NewTarFS(bb.Bytes())
+	require.NoError(t, err)
+
+	// both threads hold their module before loading the other one
+	var barrier sync.WaitGroup
+	barrier.Add(2)
+	predeclared := starlark.StringDict{
+		"barrier": starlark.NewBuiltin("barrier", func(*starlark.Thread, *starlark.Builtin, starlark.Tuple, []starlark.Tuple) (starlark.Value, error) {
+			barrier.Done()
+			barrier.Wait()
+			return starlark.None, nil
+		}),
+	}
+	cache := NewModuleCache(ThreadLoad(fs, predeclared, nil))
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, path := range []string{"/p.star", "/q.star"} {
+		wg.Add(1)
+		go func(i int, path string) {
+			defer wg.Done()
+			thread := &starlark.Thread{Load: cache.Load}
+			_, errs[i] = thread.Load(thread, path)
+		}(i, path)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		require.ErrorContains(t, err, "load cycle")
+	}
+}
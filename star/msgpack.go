@@ -0,0 +1,276 @@
+package star
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/vmihailenco/msgpack/v5/msgpcode"
+	"go.starlark.net/starlark"
+)
+
+// msgpackBigIntExt is the MessagePack extension type of integers out of the int64 and uint64 ranges: the decimal
+// representation of the integer.
+const msgpackBigIntExt int8 = 1
+
+// EncodeMsgPack is the MessagePack counterpart of Encode: it writes the value to the encoder with the same
+// supported types and codec dictionaries. Top-level bytes are written as MessagePack binary.
+func EncodeMsgPack(enc *msgpack.Encoder, v any) error {
+	return encodeMsgPack(enc, v, false)
+}
+
+// EncodeMsgPackTyped is the MessagePack counterpart of EncodeTyped.
+func EncodeMsgPackTyped(enc *msgpack.Encoder, v any) error {
+	return encodeMsgPack(enc, v, true)
+}
+
+func encodeMsgPack(enc *msgpack.Encoder, v any, typed bool) error {
+	var value starlark.Value
+	switch v := v.(type) {
+	case starlark.Bytes:
+		return enc.EncodeBytes([]byte(v))
+	case []starlark.Tuple:
+		// keywords: list
+		if v == nil {
+			return enc.EncodeNil()
+		}
+		elems := make([]starlark.Value, len(v))
+		for i, tuple := range v {
+			l, err := codecList(tuple, typed)
+			if err != nil {
+				return err
+			}
+			elems[i] = l
+		}
+		value = starlark.NewList(elems)
+	default:
+		if isNilValue(v) {
+			return enc.EncodeNil()
+		}
+		switch v := v.(type) {
+		case starlark.Value:
+			if tuple, ok := v.(*starlark.Tuple); ok {
+				v = *tuple
+			}
+			var err error
+			if tuple, ok := v.(starlark.Tuple); ok {
+				value, err = codecList(tuple, typed)
+			} else {
+				value, err = codecValue(v, typed)
+			}
+			if err != nil {
+				return err
+			}
+		default:
+			return UnsupportedTypeError{
+				fmt.Errorf("unsupported value type: expected: starlark type, actual: (%T) %v", v, v),
+			}
+		}
+	}
+	return writeMsgPack(enc, value)
+}
+
+// writeMsgPack writes a value returned by codecValue.
+func writeMsgPack(enc *msgpack.Encoder, v starlark.Value) error {
+	switch v := v.(type) {
+	case starlark.NoneType:
+		return enc.EncodeNil()
+	case starlark.Bool:
+		return enc.EncodeBool(bool(v))
+	case starlark.Int:
+		if n, ok := v.Int64(); ok {
+			return enc.EncodeInt(n)
+		}
+		if n, ok := v.Uint64(); ok {
+			return enc.EncodeUint(n)
+		}
+		s := v.BigInt().Text(10)
+		if err := enc.EncodeExtHeader(msgpackBigIntExt, len(s)); err != nil {
+			return err
+		}
+		_, err := enc.Writer().Write([]byte(s))
+		return err
+	case starlark.Float:
+		return enc.EncodeFloat64(float64(v))
+	case starlark.String:
+		return enc.EncodeString(string(v))
+	case starlark.Bytes:
+		return enc.EncodeBytes([]byte(v))
+	case *starlark.List:
+		if err := enc.EncodeArrayLen(v.Len()); err != nil {
+			return err
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := writeMsgPack(enc, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *starlark.Dict:
+		// codec values: string keys only
+		items := v.Items()
+		sort.Slice(items, func(i, j int) bool {
+			return items[i][0].(starlark.String) < items[j][0].(starlark.String)
+		})
+		if err := enc.EncodeMapLen(len(items)); err != nil {
+			return err
+		}
+		for _, item := range items {
+			if err := enc.EncodeString(string(item[0].(starlark.String))); err != nil {
+				return err
+			}
+			if err := writeMsgPack(enc, item[1]); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		// other types, e.g. structs, are written as their JSON representation
+		b, err := encodeJSON(v)
+		if err != nil {
+			return err
+		}
+		value, err := _decode.CallInternal(nil, starlark.Tuple{starlark.String(b)}, nil)
+		if err != nil {
+			return err
+		}
+		return writeMsgPack(enc, value)
+	}
+}
+
+// DecodeMsgPack is the MessagePack counterpart of Decode: it reads the next value of the decoder into the output
+// pointer. Unsupported outputs fail with UnsupportedTypeError before reading the value.
+func DecodeMsgPack(dec *msgpack.Decoder, out any) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("decode-panic: %v", rec)
+		}
+	}()
+	_out := reflect.ValueOf(out)
+	if _out.Kind() != reflect.Pointer {
+		return fmt.Errorf("illegal output kind: expected: pointer, actual: %s", _out.Kind().String())
+	}
+	switch out.(type) {
+	case *[]byte, *starlark.Bytes, *[]starlark.Tuple:
+	default:
+		if err := checkValueOutput(_out); err != nil {
+			return err
+		}
+	}
+
+	value, err := readMsgPack(dec)
+	if err != nil {
+		return err
+	}
+	if value, err = replaceDict(value, codecDictReplacer); err != nil {
+		return err
+	}
+	switch out := out.(type) {
+	case *[]byte:
+		b, ok := value.(starlark.Bytes)
+		if !ok {
+			return fmt.Errorf("incompatible data: output type: %T", out)
+		}
+		*out = []byte(b)
+	case *starlark.Bytes:
+		b, ok := value.(starlark.Bytes)
+		if !ok {
+			return fmt.Errorf("incompatible data: output type: %T", out)
+		}
+		*out = b
+	case *[]starlark.Tuple:
+		switch value := value.(type) {
+		case starlark.NoneType:
+			*out = nil
+		case *starlark.List:
+			*out = keywordsFromList(value)
+		default:
+			return fmt.Errorf("incompatible data: output type: %T", out)
+		}
+	default:
+		return setValue(out, value)
+	}
+	return nil
+}
+
+func readMsgPack(dec *msgpack.Decoder) (starlark.Value, error) {
+	c, err := dec.PeekCode()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case c == msgpcode.Nil:
+		return starlark.None, dec.DecodeNil()
+	case c == msgpcode.False || c == msgpcode.True:
+		v, err := dec.DecodeBool()
+		return starlark.Bool(v), err
+	case c == msgpcode.Uint64:
+		v, err := dec.DecodeUint64()
+		return starlark.MakeUint64(v), err
+	case msgpcode.IsFixedNum(c), c >= msgpcode.Uint8 && c <= msgpcode.Uint32, c >= msgpcode.Int8 && c <= msgpcode.Int64:
+		v, err := dec.DecodeInt64()
+		return starlark.MakeInt64(v), err
+	case c == msgpcode.Float || c == msgpcode.Double:
+		v, err := dec.DecodeFloat64()
+		return starlark.Float(v), err
+	case msgpcode.IsString(c):
+		v, err := dec.DecodeString()
+		return starlark.String(v), err
+	case msgpcode.IsBin(c):
+		v, err := dec.DecodeBytes()
+		return starlark.Bytes(v), err
+	case msgpcode.IsFixedArray(c), c == msgpcode.Array16, c == msgpcode.Array32:
+		n, err := dec.DecodeArrayLen()
+		if err != nil {
+			return nil, err
+		}
+		elems := make([]starlark.Value, n)
+		for i := range elems {
+			if elems[i], err = readMsgPack(dec); err != nil {
+				return nil, err
+			}
+		}
+		return starlark.NewList(elems), nil
+	case msgpcode.IsFixedMap(c), c == msgpcode.Map16, c == msgpcode.Map32:
+		n, err := dec.DecodeMapLen()
+		if err != nil {
+			return nil, err
+		}
+		res := starlark.NewDict(n)
+		for i := 0; i < n; i++ {
+			k, err := readMsgPack(dec)
+			if err != nil {
+				return nil, err
+			}
+			v, err := readMsgPack(dec)
+			if err != nil {
+				return nil, err
+			}
+			if err := res.SetKey(k, v); err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+	case msgpcode.IsExt(c):
+		id, n, err := dec.DecodeExtHeader()
+		if err != nil {
+			return nil, err
+		}
+		if id != msgpackBigIntExt {
+			return nil, fmt.Errorf("unsupported msgpack extension type: %d", id)
+		}
+		b := make([]byte, n)
+		if err := dec.ReadFull(b); err != nil {
+			return nil, err
+		}
+		v, ok := new(big.Int).SetString(string(b), 10)
+		if !ok {
+			return nil, fmt.Errorf("bad msgpack big integer: %q", b)
+		}
+		return starlark.MakeBigInt(v), nil
+	default:
+		return nil, fmt.Errorf("unsupported msgpack code: 0x%x", c)
+	}
+}
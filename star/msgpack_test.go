@@ -0,0 +1,99 @@
+package star
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+func TestMsgPack(t *testing.T) {
+	encode := func(t *testing.T, v any) []byte {
+		var buf bytes.Buffer
+		require.NoError(t, EncodeMsgPackTyped(msgpack.NewEncoder(&buf), v))
+		return buf.Bytes()
+	}
+	decode := func(t *testing.T, b []byte, out any) {
+		require.NoError(t, DecodeMsgPack(msgpack.NewDecoder(bytes.NewReader(b)), out))
+	}
+
+	for _, expr := range []string{
+		`None`,
+		`[True, 1, -1, 3.14, "abc", b"abc"]`,
+		`{"a": [1, {"b": None}], "c": (1, 2), 1: set(["x"])}`,
+		`[9223372036854775807, 18446744073709551615, -340282366920938463463374607431768211457]`,
+		`dataclass(id=101, tags=("a",))`,
+	} {
+		t.Run(expr, func(t *testing.T) {
+			input, err := starlark.EvalOptions(&syntax.FileOptions{Set: true}, &starlark.Thread{}, "test", expr, starlark.StringDict{
+				"dataclass": DataclassConstructor,
+			})
+			require.NoError(t, err)
+
+			var out starlark.Value
+			decode(t, encode(t, input), &out)
+			eq, err := starlark.Equal(input, out)
+			require.NoError(t, err)
+			require.True(t, eq, "%s != %s", input, out)
+		})
+	}
+
+	t.Run("bytes", func(t *testing.T) {
+		// top-level bytes are MessagePack binary
+		b := encode(t, starlark.Bytes("abc"))
+		require.Equal(t, []byte{0xc4, 3, 'a', 'b', 'c'}, b)
+
+		var out1 []byte
+		decode(t, b, &out1)
+		require.Equal(t, []byte("abc"), out1)
+		var out2 starlark.Bytes
+		decode(t, b, &out2)
+		require.Equal(t, starlark.Bytes("abc"), out2)
+	})
+
+	t.Run("tuple", func(t *testing.T) {
+		// top-level tuples are arrays, decoded into tuples or lists
+		input := starlark.Tuple{starlark.String("pi"), starlark.Float(3.14)}
+		var out starlark.Tuple
+		decode(t, encode(t, &input), &out)
+		require.Equal(t, input, out)
+	})
+
+	t.Run("keywords", func(t *testing.T) {
+		input := []starlark.Tuple{{starlark.String("pi"), starlark.Float(3.14)}}
+		var out []starlark.Tuple
+		decode(t, encode(t, input), &out)
+		require.Equal(t, input, out)
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		// values are read one by one
+		var buf bytes.Buffer
+		enc := msgpack.NewEncoder(&buf)
+		require.NoError(t, EncodeMsgPack(enc, starlark.String("a")))
+		require.NoError(t, EncodeMsgPack(enc, starlark.MakeInt(1)))
+		dec := msgpack.NewDecoder(&buf)
+		var out1 starlark.String
+		var out2 starlark.Int
+		require.NoError(t, DecodeMsgPack(dec, &out1))
+		require.NoError(t, DecodeMsgPack(dec, &out2))
+		require.Equal(t, starlark.String("a"), out1)
+		require.Equal(t, starlark.MakeInt(1), out2)
+	})
+
+	t.Run("go-types", func(t *testing.T) {
+		// go types are not supported
+		err := EncodeMsgPack(msgpack.NewEncoder(&bytes.Buffer{}), "abc")
+		_, ok := err.(UnsupportedTypeError)
+		require.True(t, ok, fmt.Sprintf("bad error type: %T", err))
+
+		var out any
+		err = DecodeMsgPack(msgpack.NewDecoder(bytes.NewReader(encode(t, starlark.String("abc")))), &out)
+		_, ok = err.(UnsupportedTypeError)
+		require.True(t, ok, fmt.Sprintf("bad error type: %T", err))
+	})
+}
@@ -0,0 +1,138 @@
+package star
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// SignaturePath is the package file that holds the package signature.
+const SignaturePath = "/signature"
+
+var (
+	// ErrUnsigned is returned by VerifySignature for packages without a signature.
+	ErrUnsigned = errors.New("package is not signed")
+	// ErrBadSignature is returned by VerifySignature for packages whose signature does not match a trusted key.
+	ErrBadSignature = errors.New("bad package signature")
+)
+
+// Signature is the content of the SignaturePath file: an ed25519 signature of the package digest,
+// see SignatureDigest.
+type Signature struct {
+	KeyID     string `json:"key_id"`
+	Signature []byte `json:"signature"`
+}
+
+// KeyID identifies a public key: the first 8 bytes of its SHA-256 digest, hex-encoded.
+func KeyID(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// SignatureDigest returns the signed digest of the package files: SHA-256 over the sorted list of file paths and
+// their content digests. The signature file itself is excluded. Independent of the tar layout and compression.
+func SignatureDigest(files map[string][]byte) []byte {
+	paths := make([]string, 0, len(files))
+	clean := make(map[string][]byte, len(files))
+	for p, content := range files {
+		p = path.Clean("/" + p)
+		if p == SignaturePath {
+			continue
+		}
+		paths = append(paths, p)
+		clean[p] = content
+	}
+	sort.Strings(paths)
+	h := sha256.New()
+	for _, p := range paths {
+		sum := sha256.Sum256(clean[p])
+		_, _ = fmt.Fprintf(h, "%s\x00%s\n", p, hex.EncodeToString(sum[:]))
+	}
+	return h.Sum(nil)
+}
+
+// Sign returns the content of the SignaturePath file for the given package files.
+func Sign(files map[string][]byte, key ed25519.PrivateKey) ([]byte, error) {
+	return jsoniter.Marshal(Signature{
+		KeyID:     KeyID(key.Public().(ed25519.PublicKey)),
+		Signature: ed25519.Sign(key, SignatureDigest(files)),
+	})
+}
+
+// VerifySignature checks the package signature against the trusted keys. Returns the ID of the key that signed
+// the package, ErrUnsigned if the package has no signature, or ErrBadSignature.
+func VerifySignature(fs FS, trusted []ed25519.PublicKey) (string, error) {
+	tfs, ok := fs.(*_TarFS)
+	if !ok {
+		return "", fmt.Errorf("signature verification is not supported by %T", fs)
+	}
+	b, found := tfs.files[SignaturePath]
+	if !found {
+		return "", ErrUnsigned
+	}
+	var sig Signature
+	if err := jsoniter.Unmarshal(b, &sig); err != nil {
+		return "", fmt.Errorf("%w: %s", ErrBadSignature, err.Error())
+	}
+	digest := SignatureDigest(tfs.files)
+	for _, key := range trusted {
+		if KeyID(key) == sig.KeyID && ed25519.Verify(key, digest, sig.Signature) {
+			return sig.KeyID, nil
+		}
+	}
+	return "", fmt.Errorf("%w: key_id: %s", ErrBadSignature, sig.KeyID)
+}
+
+// LoadPrivateKey reads a PEM-encoded PKCS #8 ed25519 private key, e.g. generated by
+// `openssl genpkey -algorithm ed25519`.
+func LoadPrivateKey(file string) (ed25519.PrivateKey, error) {
+	block, err := readPEM(file)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if res, ok := key.(ed25519.PrivateKey); ok {
+		return res, nil
+	}
+	return nil, fmt.Errorf("not an ed25519 private key: %T: %s", key, file)
+}
+
+// LoadPublicKey reads a PEM-encoded PKIX ed25519 public key, e.g. generated by `openssl pkey -pubout`.
+func LoadPublicKey(file string) (ed25519.PublicKey, error) {
+	block, err := readPEM(file)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if res, ok := key.(ed25519.PublicKey); ok {
+		return res, nil
+	}
+	return nil, fmt.Errorf("not an ed25519 public key: %T: %s", key, file)
+}
+
+func readPEM(file string) (*pem.Block, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found: %s", file)
+	}
+	return block, nil
+}
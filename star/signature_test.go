@@ -0,0 +1,78 @@
+package star
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cadence-workflow/starlark-worker/ext"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	otherPub, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	files := map[string][]byte{
+		"meta.json": []byte("{}"),
+		"app.star":  []byte("def main():\n    return 1\n"),
+	}
+	newFS := func(files map[string][]byte) FS {
+		bb := bytes.Buffer{}
+		require.NoError(t, ext.WriteTar(files, &bb))
+		fs, err := NewTarFS(bb.Bytes())
+		require.NoError(t, err)
+		return fs
+	}
+
+	_, err = VerifySignature(newFS(files), []ed25519.PublicKey{pub})
+	require.ErrorIs(t, err, ErrUnsigned)
+
+	sig, err := Sign(files, priv)
+	require.NoError(t, err)
+	files["signature"] = sig
+
+	keyID, err := VerifySignature(newFS(files), []ed25519.PublicKey{otherPub, pub})
+	require.NoError(t, err)
+	require.Equal(t, KeyID(pub), keyID)
+
+	_, err = VerifySignature(newFS(files), []ed25519.PublicKey{otherPub})
+	require.ErrorIs(t, err, ErrBadSignature)
+
+	// any change of the package content invalidates the signature
+	files["app.star"] = []byte("def main():\n    return 2\n")
+	_, err = VerifySignature(newFS(files), []ed25519.PublicKey{pub})
+	require.ErrorIs(t, err, ErrBadSignature)
+}
+
+func TestLoadKeys(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	require.NoError(t, err)
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	require.NoError(t, err)
+	privFile := filepath.Join(dir, "key.pem")
+	pubFile := filepath.Join(dir, "key.pub.pem")
+	require.NoError(t, os.WriteFile(privFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}), 0o600))
+	require.NoError(t, os.WriteFile(pubFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0o644))
+
+	loadedPriv, err := LoadPrivateKey(privFile)
+	require.NoError(t, err)
+	require.Equal(t, priv, loadedPriv)
+
+	loadedPub, err := LoadPublicKey(pubFile)
+	require.NoError(t, err)
+	require.Equal(t, pub, loadedPub)
+
+	_, err = LoadPublicKey(privFile)
+	require.Error(t, err)
+}
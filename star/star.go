@@ -4,38 +4,144 @@ import (
 	"fmt"
 	"go.starlark.net/starlark"
 	"go.starlark.net/syntax"
+	"path"
 	"path/filepath"
 	"strings"
 )
 
 const PluginPrefix = "@"
 
+// RepoSeparator separates the repository alias from the path in external repository paths: "@alias//path".
+const RepoSeparator = "//"
+
+// IsPlugin reports whether the load path is a plugin module, e.g. "@plugin", rather than a file of
+// an external repository, e.g. "@shared//retry.star".
+func IsPlugin(p string) bool {
+	return strings.HasPrefix(p, PluginPrefix) && !strings.Contains(p, RepoSeparator)
+}
+
+// SplitRepo splits an external repository path "@alias//path" into the alias and the absolute path within
+// the repository.
+func SplitRepo(p string) (alias string, repoPath string, ok bool) {
+	if !strings.HasPrefix(p, PluginPrefix) {
+		return "", "", false
+	}
+	alias, repoPath, ok = strings.Cut(p[len(PluginPrefix):], RepoSeparator)
+	if !ok || alias == "" {
+		return "", "", false
+	}
+	return alias, path.Clean("/" + repoPath), true
+}
+
 var FileOptions = &syntax.FileOptions{}
 
 func ThreadLoad(
 	fs FS,
 	predeclared starlark.StringDict,
 	modules map[string]starlark.StringDict,
+) func(*starlark.Thread, string) (starlark.StringDict, error) {
+	return threadLoad(fs, modules, func(t *starlark.Thread, path string, src []byte) (starlark.StringDict, error) {
+		_, prog, err := starlark.SourceProgramOptions(FileOptions, path, src, predeclared.Has)
+		if err != nil {
+			return nil, err
+		}
+		return initProgram(t, prog, predeclared)
+	})
+}
+
+// initProgram executes the compiled module and returns its globals, frozen if the module is reached via load().
+func initProgram(t *starlark.Thread, prog *starlark.Program, predeclared starlark.StringDict) (starlark.StringDict, error) {
+	g, err := prog.Init(t, predeclared)
+	if err != nil {
+		return nil, err
+	}
+	if t.CallStackDepth() > 0 {
+		g.Freeze()
+	}
+	return g, nil
+}
+
+func threadLoad(
+	fs FS,
+	modules map[string]starlark.StringDict,
+	exec func(t *starlark.Thread, path string, src []byte) (starlark.StringDict, error),
 ) func(*starlark.Thread, string) (starlark.StringDict, error) {
 	return func(t *starlark.Thread, path string) (starlark.StringDict, error) {
-		if strings.HasPrefix(path, PluginPrefix) {
+		if IsPlugin(path) {
 			if mod, found := modules[path[1:]]; !found {
 				return nil, fmt.Errorf("module-not-found: %v", path)
 			} else {
 				return mod, nil
 			}
 		}
-		// TODO: andrii: support relative path (relative to the thread's call stack)
+		from := "/"
+		if t.CallStackDepth() > 0 { // load statement: the innermost frame is the loading module
+			from = t.CallFrame(0).Pos.Filename()
+		}
+		path, err := ResolveLoad(from, path)
+		if err != nil {
+			return nil, err
+		}
 		if src, err := fs.Read(path); err != nil {
 			return nil, err
 		} else if strings.HasSuffix(path, ".star") || strings.HasSuffix(path, ".py") {
-			return starlark.ExecFileOptions(FileOptions, t, path, src, predeclared)
+			return exec(t, path, src)
 		} else {
 			return loadDataFile(path, src)
 		}
 	}
 }
 
+// ResolveLoad returns the package path of the module loaded by the given file. Paths starting with "./" or "../"
+// are relative to the loading file, others are relative to the package root: "//lib/x.star", "/lib/x.star" and
+// "lib/x.star" are the same module. Relative paths escaping the package root are rejected.
+//
+// External repository paths, "@alias//path", are relative to the repository root. Within a repository file,
+// relative and root paths refer to the same repository.
+func ResolveLoad(from string, module string) (string, error) {
+	if IsPlugin(module) {
+		return module, nil
+	}
+	if alias, p, ok := SplitRepo(module); ok {
+		return repoPath(alias, p), nil
+	}
+	if alias, p, ok := SplitRepo(from); ok { // loaded from a repository file
+		res, err := resolvePath(p, module)
+		if err != nil {
+			return "", err
+		}
+		return repoPath(alias, res), nil
+	}
+	return resolvePath(from, module)
+}
+
+func resolvePath(from string, module string) (string, error) {
+	if !strings.HasPrefix(module, "./") && !strings.HasPrefix(module, "../") {
+		return path.Clean("/" + module), nil
+	}
+	dir := strings.Split(strings.Trim(path.Dir(path.Clean("/"+from)), "/"), "/")
+	if dir[0] == "" {
+		dir = nil
+	}
+	for _, seg := range strings.Split(module, "/") {
+		switch seg {
+		case "", ".":
+		case "..":
+			if len(dir) == 0 {
+				return "", fmt.Errorf("400: out-of-root load: %s from %s", module, from)
+			}
+			dir = dir[:len(dir)-1]
+		default:
+			dir = append(dir, seg)
+		}
+	}
+	return "/" + strings.Join(dir, "/"), nil
+}
+
+func repoPath(alias string, p string) string {
+	return PluginPrefix + alias + "/" + p // p is absolute: "@alias//path"
+}
+
 func Call(
 	t *starlark.Thread,
 	path string,
@@ -58,18 +164,29 @@ func Call(
 	return starlark.Call(t, fn, args, kwargs)
 }
 
+// loadDataFile returns the module of a data file: the raw content as "bytes", and the decoded content named
+// after the file format: "txt", "json", "yaml" (.yaml, .yml), "toml" or "csv" (a list of dicts keyed by the
+// header row). Files of other formats only expose the raw content.
 func loadDataFile(path string, data []byte) (starlark.StringDict, error) {
-	ext := filepath.Ext(path)
-	switch ext {
+	res := starlark.StringDict{"bytes": starlark.Bytes(data)}
+	var err error
+	switch ext := filepath.Ext(path); ext {
 	case ".txt":
-		return starlark.StringDict{"txt": starlark.String(data)}, nil
+		res["txt"] = starlark.String(data)
 	case ".json":
 		var v starlark.Value
-		if err := Decode(data, &v); err != nil {
-			return nil, err
+		if err = Decode(data, &v); err == nil {
+			res["json"] = v
 		}
-		return starlark.StringDict{"json": v}, nil
-	default:
-		return nil, fmt.Errorf("unsupported data file extension: %s (%s)", ext, path)
+	case ".yaml", ".yml":
+		res["yaml"], err = decodeYAML(data)
+	case ".toml":
+		res["toml"], err = decodeTOML(data)
+	case ".csv":
+		res["csv"], err = decodeCSV(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
 	}
+	return res, nil
 }
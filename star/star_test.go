@@ -0,0 +1,72 @@
+package star
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/cadence-workflow/starlark-worker/ext"
+	"github.com/stretchr/testify/require"
+	"go.starlark.net/starlark"
+)
+
+func TestResolveLoad(t *testing.T) {
+	for _, tc := range []struct {
+		from, module, expected string
+	}{
+		{"/app.star", "//lib/x.star", "/lib/x.star"},
+		{"/app.star", "/lib/x.star", "/lib/x.star"},
+		{"/app.star", "lib/x.star", "/lib/x.star"},
+		{"/app.star", "./lib/x.star", "/lib/x.star"},
+		{"/a/b/app.star", "./x.star", "/a/b/x.star"},
+		{"/a/b/app.star", "../x.star", "/a/x.star"},
+		{"/a/b/app.star", "../../x.star", "/x.star"},
+		{"/a/b/app.star", "./c/../x.star", "/a/b/x.star"},
+		{"a/app.star", "./x.star", "/a/x.star"},
+		{"<repl>", "./x.star", "/x.star"},
+		{"/a/app.star", "@plugin", "@plugin"},
+		{"/a/app.star", "@shared//retry.star", "@shared//retry.star"},
+		{"/a/app.star", "@shared//lib/../retry.star", "@shared//retry.star"},
+		{"@shared//lib/x.star", "./y.star", "@shared//lib/y.star"},
+		{"@shared//lib/x.star", "../y.star", "@shared//y.star"},
+		{"@shared//lib/x.star", "//y.star", "@shared//y.star"},
+		{"@shared//lib/x.star", "@other//y.star", "@other//y.star"},
+		{"@shared//lib/x.star", "@plugin", "@plugin"},
+	} {
+		actual, err := ResolveLoad(tc.from, tc.module)
+		require.NoError(t, err, tc)
+		require.Equal(t, tc.expected, actual, tc)
+	}
+
+	for _, tc := range []struct{ from, module string }{
+		{"/app.star", "../x.star"},
+		{"/a/app.star", "../../x.star"},
+		{"/a/app.star", "./../b/../../x.star"},
+		{"@shared//x.star", "../y.star"},
+	} {
+		_, err := ResolveLoad(tc.from, tc.module)
+		require.ErrorContains(t, err, "out-of-root", tc)
+	}
+}
+
+func TestThreadLoadRelative(t *testing.T) {
+	files := map[string][]byte{
+		"/main.star":       []byte("load(\"./lib/a.star\", \"a\")\nres = a\n"),
+		"/lib/a.star":      []byte("load(\"./b.star\", \"b\")\nload(\"../data/c.txt\", c = \"txt\")\na = b + c\n"),
+		"/lib/b.star":      []byte("b = \"b\"\n"),
+		"/data/c.txt":      []byte("c"),
+		"/lib/escape.star": []byte("load(\"../../x.star\", \"x\")\n"),
+	}
+	bb := bytes.Buffer{}
+	require.NoError(t, ext.WriteTar(files, &bb))
+	fs, err := NewTarFS(bb.Bytes())
+	require.NoError(t, err)
+
+	thread := &starlark.Thread{}
+	thread.Load = ThreadLoad(fs, nil, nil)
+	globals, err := thread.Load(thread, "/main.star")
+	require.NoError(t, err)
+	require.Equal(t, starlark.String("bc"), globals["res"])
+
+	_, err = thread.Load(thread, "/lib/escape.star")
+	require.ErrorContains(t, err, "out-of-root")
+}
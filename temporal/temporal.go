@@ -49,7 +49,13 @@ func NewZapLoggerAdapter(z *zap.Logger) *internal.ZapLoggerAdapter {
 // This instance is injected into the workflow.Context under the `BackendContextKey`
 // so that backend-specific behavior can be triggered dynamically.
 func NewWorkflow() workflow.Workflow {
-	return &internal.TemporalWorkflow{}
+	return &internal.TemporalWorkflow{DataConverter: NewDataConverter()}
+}
+
+// NewDataConverter returns the data converter of the clients and workers NewClient creates, logging to the
+// global zap logger. Payloads are encoded with the encoded.Default* format, keys and blob store.
+func NewDataConverter() DataConverter {
+	return DataConverter{Logger: zap.L()}
 }
 
 // NewTemporalWorker creates a new Temporal worker given a URL, namespace, and task queue.
@@ -109,7 +115,7 @@ func NewClient(location string, namespace string) (client.Client, error) {
 	options := client.Options{
 		HostPort:           location,
 		Namespace:          namespace,
-		DataConverter:      DataConverter{},
+		DataConverter:      NewDataConverter(),
 		MetricsHandler:     tally.NewMetricsHandler(scope),
 		ContextPropagators: []temp.ContextPropagator{&HeadersContextPropagator{}},
 	}
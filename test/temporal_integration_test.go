@@ -87,8 +87,8 @@ func (r *TempSuite) TestAtExit() {
 		tempErr := werr.Unwrap().(*temporalsdk.ApplicationError)
 
 		require.True(errors.As(err, &tempErr))
-		require.Equal("assert\nExpected : 200\nActual   : 404 (type: assert\nExpected : 200\nActual   : 404, retryable: true)", tempErr.Message())
-		require.Equal("TemporalCustomError", tempErr.Type())
+		require.Equal("assert\nExpected : 200\nActual   : 404", tempErr.Message())
+		require.Equal("assert\nExpected : 200\nActual   : 404", tempErr.Type())
 	})
 
 	// make sure the test run did not leak any resources on the test server
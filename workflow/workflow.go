@@ -179,6 +179,26 @@ type (
 	//
 	// Used extensively in graceful shutdowns, parent-child propagation, and timed operations.
 	CanceledError = internal.CanceledError
+
+	// ReceiveChannel is a read-only workflow channel, such as the one returned by GetSignalChannel.
+	//
+	// Example:
+	//   var chunk string
+	//   workflow.GetSignalChannel(ctx, "input").Receive(ctx, &chunk)
+	ReceiveChannel = internal.ReceiveChannel
+
+	// Selector waits on several workflow channels at once, e.g. a signal channel and the context cancellation.
+	//
+	// Example:
+	//   workflow.NewSelector(ctx).
+	//       AddReceive(input, func(c workflow.ReceiveChannel, more bool) { c.Receive(ctx, &chunk) }).
+	//       AddDone(ctx, func() { canceled = true }).
+	//       Select(ctx)
+	Selector = internal.Selector
+
+	// PayloadTooLargeError is returned by the data converters when an encoded payload exceeds the size limit
+	// even after compression, before the payload is submitted to the server.
+	PayloadTooLargeError = internal.PayloadTooLargeError
 )
 
 func GetBackend(ctx Context) (Workflow, bool) {
@@ -264,6 +284,37 @@ func SetQueryHandler(ctx Context, queryType string, handler interface{}) error {
 	return nil
 }
 
+func GetSignalChannel(ctx Context, signalName string) ReceiveChannel {
+	if backend, ok := GetBackend(ctx); ok {
+		return backend.GetSignalChannel(ctx, signalName)
+	}
+	return nil
+}
+
+func NewSelector(ctx Context) Selector {
+	if backend, ok := GetBackend(ctx); ok {
+		return backend.NewSelector(ctx)
+	}
+	return nil
+}
+
+// Err returns the cancellation error of the context, nil if the context is not canceled.
+func Err(ctx Context) error {
+	if backend, ok := GetBackend(ctx); ok {
+		return backend.Err(ctx)
+	}
+	return nil
+}
+
+// NewContinueAsNewError returns the error that completes the current run of the workflow and starts a new run
+// of the given workflow, a registered function or its name, with the given arguments.
+func NewContinueAsNewError(ctx Context, wfn interface{}, args ...interface{}) error {
+	if backend, ok := GetBackend(ctx); ok {
+		return backend.NewContinueAsNewError(ctx, wfn, args...)
+	}
+	return nil
+}
+
 func WithWorkflowDomain(ctx Context, name string) Context {
 	if backend, ok := GetBackend(ctx); ok {
 		return backend.WithWorkflowDomain(ctx, name)
@@ -334,6 +385,38 @@ func IsCanceledError(ctx Context, err error) bool {
 	return false
 }
 
+// IsTimeoutError checks if the error is a timeout, e.g. of an activity or a child workflow.
+func IsTimeoutError(ctx Context, err error) bool {
+	if backend, ok := GetBackend(ctx); ok {
+		return backend.IsTimeoutError(ctx, err)
+	}
+	return false
+}
+
+// ToWorkflowError converts the error into the one the workflow function returns to the backend, so that the
+// failure keeps the reason and details of a CustomError.
+func ToWorkflowError(ctx Context, err error) error {
+	if backend, ok := GetBackend(ctx); ok {
+		return backend.ToWorkflowError(ctx, err)
+	}
+	return err
+}
+
+// AsCustomError finds the first CustomError in the error chain, e.g. of a failed activity or child workflow.
+func AsCustomError(ctx Context, err error) (CustomError, bool) {
+	if backend, ok := GetBackend(ctx); ok {
+		return backend.AsCustomError(ctx, err)
+	}
+	return nil, false
+}
+
+func IsReplaying(ctx Context) bool {
+	if backend, ok := GetBackend(ctx); ok {
+		return backend.IsReplaying(ctx)
+	}
+	return false
+}
+
 func WithRetryPolicy(ctx Context, retryPolicy RetryPolicy) Context {
 	if backend, ok := GetBackend(ctx); ok {
 		return backend.WithRetryPolicy(ctx, retryPolicy)